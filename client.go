@@ -86,6 +86,26 @@ func NewTCPClient(opts ...ClientOption) Client {
 	return newClient(TCP_CLIENT, opts...)
 }
 
+// NewTCPTLSClient function builds a tcp client which dials tls connections. Its tls config is
+// built by the WithClientTLS* options on the base of WithClientTLSConfig. Its sessions behave
+// exactly like the ones of NewTCPClient.
+func NewTCPTLSClient(opts ...ClientOption) Client {
+	c := newClient(TCP_CLIENT, opts...)
+
+	config, err := c.tlsOpts.buildClientConfig(c.tlsConfig)
+	if err != nil {
+		panic(fmt.Sprintf("@serverAddr:%s, tls config error{%s}", c.addr, jerrors.ErrorStack(err)))
+	}
+	c.tlsConfig = config
+
+	return c
+}
+
+// NewUnixClient function builds a unix domain socket client. Its server address is the socket file path.
+func NewUnixClient(opts ...ClientOption) Client {
+	return newClient(UNIX_CLIENT, opts...)
+}
+
 // NewUdpClient function builds a connected udp client
 func NewUDPClient(opts ...ClientOption) Client {
 	return newClient(UDP_CLIENT, opts...)
@@ -102,11 +122,12 @@ func NewWSClient(opts ...ClientOption) Client {
 	return c
 }
 
-// NewWSSClient function builds a wss client.
+// NewWSSClient function builds a wss client. Its tls config is the one of WithClientTLSConfig
+// if it is set, otherwise it is built from the certificate file of WithRootCertificateFile.
 func NewWSSClient(opts ...ClientOption) Client {
 	c := newClient(WSS_CLIENT, opts...)
 
-	if c.cert == "" {
+	if c.tlsConfig == nil && c.cert == "" {
 		panic(fmt.Sprintf("@cert:%s", c.cert))
 	}
 	if !strings.HasPrefix(c.addr, "wss://") {
@@ -130,7 +151,11 @@ func (c *client) dialTCP() Session {
 		if c.IsClosed() {
 			return nil
 		}
-		conn, err = net.DialTimeout("tcp", c.addr, connectTimeout)
+		if c.tlsConfig != nil {
+			conn, err = tls.DialWithDialer(&net.Dialer{Timeout: connectTimeout}, "tcp", c.addr, c.tlsConfig)
+		} else {
+			conn, err = net.DialTimeout("tcp", c.addr, connectTimeout)
+		}
 		if err == nil && gxnet.IsSameAddr(conn.RemoteAddr(), conn.LocalAddr()) {
 			conn.Close()
 			err = errSelfConnect
@@ -145,6 +170,26 @@ func (c *client) dialTCP() Session {
 	}
 }
 
+func (c *client) dialUnix() Session {
+	var (
+		err  error
+		conn net.Conn
+	)
+
+	for {
+		if c.IsClosed() {
+			return nil
+		}
+		conn, err = net.DialTimeout("unix", c.addr, connectTimeout)
+		if err == nil {
+			return newTCPSession(conn, c)
+		}
+
+		log.Info("net.DialTimeout(unix, addr:%s, timeout:%v) = error{%s}", c.addr, connectTimeout, jerrors.ErrorStack(err))
+		<-wheel.After(connInterval)
+	}
+}
+
 func (c *client) dialUDP() Session {
 	var (
 		err       error
@@ -249,43 +294,48 @@ func (c *client) dialWSS() Session {
 
 	dialer.EnableCompression = true
 
-	config = &tls.Config{
-		InsecureSkipVerify: true,
-	}
-
-	if c.cert != "" {
-		certPEMBlock, err := ioutil.ReadFile(c.cert)
-		if err != nil {
-			panic(fmt.Sprintf("ioutil.ReadFile(cert:%s) = error{%s}", c.cert, jerrors.ErrorStack(err)))
+	if c.tlsConfig != nil {
+		// the tls config of WithClientTLSConfig takes the place of the certificate file
+		config = c.tlsConfig.Clone()
+	} else {
+		config = &tls.Config{
+			InsecureSkipVerify: true,
 		}
 
-		var cert tls.Certificate
-		for {
-			var certDERBlock *pem.Block
-			certDERBlock, certPEMBlock = pem.Decode(certPEMBlock)
-			if certDERBlock == nil {
-				break
+		if c.cert != "" {
+			certPEMBlock, err := ioutil.ReadFile(c.cert)
+			if err != nil {
+				panic(fmt.Sprintf("ioutil.ReadFile(cert:%s) = error{%s}", c.cert, jerrors.ErrorStack(err)))
 			}
-			if certDERBlock.Type == "CERTIFICATE" {
-				cert.Certificate = append(cert.Certificate, certDERBlock.Bytes)
+
+			var cert tls.Certificate
+			for {
+				var certDERBlock *pem.Block
+				certDERBlock, certPEMBlock = pem.Decode(certPEMBlock)
+				if certDERBlock == nil {
+					break
+				}
+				if certDERBlock.Type == "CERTIFICATE" {
+					cert.Certificate = append(cert.Certificate, certDERBlock.Bytes)
+				}
 			}
+			config.Certificates = make([]tls.Certificate, 1)
+			config.Certificates[0] = cert
 		}
-		config.Certificates = make([]tls.Certificate, 1)
-		config.Certificates[0] = cert
-	}
 
-	certPool = x509.NewCertPool()
-	for _, c := range config.Certificates {
-		roots, err = x509.ParseCertificates(c.Certificate[len(c.Certificate)-1])
-		if err != nil {
-			panic(fmt.Sprintf("error parsing server's root cert: %s\n", jerrors.ErrorStack(err)))
-		}
-		for _, root = range roots {
-			certPool.AddCert(root)
+		certPool = x509.NewCertPool()
+		for _, c := range config.Certificates {
+			roots, err = x509.ParseCertificates(c.Certificate[len(c.Certificate)-1])
+			if err != nil {
+				panic(fmt.Sprintf("error parsing server's root cert: %s\n", jerrors.ErrorStack(err)))
+			}
+			for _, root = range roots {
+				certPool.AddCert(root)
+			}
 		}
+		config.InsecureSkipVerify = true
+		config.RootCAs = certPool
 	}
-	config.InsecureSkipVerify = true
-	config.RootCAs = certPool
 
 	// dialer.EnableCompression = true
 	dialer.TLSClientConfig = config
@@ -318,6 +368,8 @@ func (c *client) dial() Session {
 	switch c.endPointType {
 	case TCP_CLIENT:
 		return c.dialTCP()
+	case UNIX_CLIENT:
+		return c.dialUnix()
 	case UDP_CLIENT:
 		return c.dialUDP()
 	case WS_CLIENT:
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+import (
+	jerrors "github.com/juju/errors"
+)
+
+// runBench calls a method by @concurrency goroutines until @requests calls are finished
+// or @duration runs out, and prints the throughput and the latency percentiles.
+func runBench(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	requests := fs.Int("n", 1000, "total number of calls, unlimited if -d is set and it is not greater than 0")
+	concurrency := fs.Int("c", 10, "number of concurrent callers")
+	duration := fs.Duration("d", 0, "max duration of the test, unlimited if it is 0")
+	connNum := fs.Int("conn", 4, "number of sessions")
+	if err := fs.Parse(args); err != nil {
+		return jerrors.Trace(err)
+	}
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		return jerrors.New("usage: bench [-n requests] [-c concurrency] [-d duration] Service.Method [arg]")
+	}
+	if *concurrency < 1 {
+		return jerrors.Errorf("illegal concurrency{%d}", *concurrency)
+	}
+	if *requests <= 0 && *duration <= 0 {
+		return jerrors.New("either -n or -d should be set")
+	}
+	service, method, err := parseMethod(fs.Arg(0))
+	if err != nil {
+		return jerrors.Trace(err)
+	}
+	argStr := "null"
+	if fs.NArg() == 2 {
+		argStr = fs.Arg(1)
+	}
+	arg, err := parseArg(argStr)
+	if err != nil {
+		return jerrors.Trace(err)
+	}
+
+	client, err := newClient(*connNum)
+	if err != nil {
+		return jerrors.Trace(err)
+	}
+	defer client.Close()
+
+	var (
+		wg        sync.WaitGroup
+		lock      sync.Mutex
+		latencies []time.Duration
+		issued    int64
+		failed    int64
+		firstErr  error
+		deadline  time.Time
+	)
+	if *duration > 0 {
+		deadline = time.Now().Add(*duration)
+	}
+	start := time.Now()
+	for i := 0; i < *concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var local []time.Duration
+			for {
+				if *requests > 0 && atomic.AddInt64(&issued, 1) > int64(*requests) {
+					break
+				}
+				if !deadline.IsZero() && time.Now().After(deadline) {
+					break
+				}
+				ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+				t := time.Now()
+				err := client.CallWithContext(ctx, service, method, arg, newReply())
+				cost := time.Since(t)
+				cancel()
+				if err != nil {
+					if atomic.AddInt64(&failed, 1) == 1 {
+						lock.Lock()
+						firstErr = err
+						lock.Unlock()
+					}
+					continue
+				}
+				local = append(local, cost)
+			}
+			lock.Lock()
+			latencies = append(latencies, local...)
+			lock.Unlock()
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	stats := summarize(latencies, int(failed))
+	fmt.Printf("calls: %d, succeeded: %d, failed: %d, elapsed: %s, throughput: %.1f calls/s\n",
+		stats.total, stats.succeeded, stats.failed, elapsed, float64(stats.total)/elapsed.Seconds())
+	if firstErr != nil {
+		fmt.Printf("first error: %s\n", firstErr)
+	}
+	if stats.succeeded == 0 {
+		return nil
+	}
+
+	fmt.Printf("latency: min %s, avg %s, max %s\n", stats.min, stats.avg, stats.max)
+	for i, p := range benchPercentiles {
+		fmt.Printf("    p%-5g %s\n", p, stats.percentiles[i])
+	}
+
+	return nil
+}
+
+// benchPercentiles are the latency percentiles printed by bench.
+var benchPercentiles = []float64{50, 90, 95, 99, 99.9}
+
+// benchStats is the summary of the calls of a bench. The latencies are of the succeeded calls.
+type benchStats struct {
+	total       int
+	succeeded   int
+	failed      int
+	min         time.Duration
+	avg         time.Duration
+	max         time.Duration
+	percentiles []time.Duration // of benchPercentiles
+}
+
+// summarize sorts @latencies of the succeeded calls, and aggregates them with @failed calls.
+func summarize(latencies []time.Duration, failed int) benchStats {
+	stats := benchStats{
+		total:     len(latencies) + failed,
+		succeeded: len(latencies),
+		failed:    failed,
+	}
+	if len(latencies) == 0 {
+		return stats
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	var sum time.Duration
+	for _, l := range latencies {
+		sum += l
+	}
+	stats.min, stats.max = latencies[0], latencies[len(latencies)-1]
+	stats.avg = sum / time.Duration(len(latencies))
+	for _, p := range benchPercentiles {
+		stats.percentiles = append(stats.percentiles, percentile(latencies, p))
+	}
+
+	return stats
+}
+
+// percentile returns the @p percentile of the sorted @latencies by the nearest rank method,
+// or 0 if @latencies is empty.
+func percentile(latencies []time.Duration, p float64) time.Duration {
+	if len(latencies) == 0 {
+		return 0
+	}
+	rank := int(p/100*float64(len(latencies)) + 0.999999)
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(latencies) {
+		rank = len(latencies)
+	}
+
+	return latencies[rank-1]
+}
@@ -0,0 +1,427 @@
+// gettyctl invokes the methods of a getty rpc server ad hoc.
+//
+//	gettyctl [flags] call Service.Method '{"json": "argument"}'
+//	gettyctl [flags] list [Service]
+//	gettyctl [flags] ping [-n count] [-i interval]
+//	gettyctl [flags] bench [-n requests] [-c concurrency] [-d duration] Service.Method '{"json": "argument"}'
+//
+// The argument and the reply are json in json codec, or base64 encoded protobuf messages in
+// protobuf codec. The argument is read from stdin if it is "-".
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+import (
+	"github.com/AlexStocks/getty/rpc"
+	"github.com/AlexStocks/goext/database/registry"
+	"github.com/AlexStocks/goext/database/registry/etcdv3"
+	"github.com/AlexStocks/goext/database/registry/zookeeper"
+	log "github.com/AlexStocks/log4go"
+	jerrors "github.com/juju/errors"
+)
+
+var (
+	addr      = flag.String("addr", "127.0.0.1:10000", "server address host:port, or socket file path in unix transport")
+	transport = flag.String("transport", "tcp", `"tcp", "ws", "wss" or "unix"`)
+	wsPath    = flag.String("ws-path", "/", "websocket request url path")
+	codec     = flag.String("codec", "json", `"json" or "protobuf"`)
+	timeout   = flag.Duration("timeout", 5*time.Second, "timeout of connecting and of every call")
+	logConf   = flag.String("log", "", "log4go config file. logs are discarded if it is empty")
+
+	tlsEnable  = flag.Bool("tls", false, "use tls")
+	certFile   = flag.String("cert", "", "client certificate file for mutual tls")
+	keyFile    = flag.String("key", "", "client private key file for mutual tls")
+	caFile     = flag.String("ca", "", "CA file to verify the server certificate")
+	serverName = flag.String("server-name", "", "server name to verify the server certificate")
+	insecure   = flag.Bool("insecure", false, "skip verifying the server certificate")
+
+	authType   = flag.String("auth", "none", `auth handshake: "none", "token", "hmac" or "tls"`)
+	token      = flag.String("token", "", "bearer token of token auth")
+	hmacKeyID  = flag.String("hmac-key-id", "", "key id of hmac auth")
+	hmacSecret = flag.String("hmac-secret", "", "secret of hmac auth")
+
+	registryType    = flag.String("registry", "", `look up the server address in the registry: "etcd" or "zookeeper"`)
+	registryAddr    = flag.String("registry-addr", "127.0.0.1:2379", "comma separated registry addresses")
+	registryRoot    = flag.String("registry-root", "getty", "registry root path")
+	registryGroup   = flag.String("registry-group", "idc-bj", "service group, which is the IDC of the server config")
+	registryService = flag.String("registry-service", "", "service name returned by GettyRPCService.Service")
+	registryVersion = flag.String("registry-version", "", "service version returned by GettyRPCService.Version")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `Usage: gettyctl [flags] command [args]
+
+Commands:
+  call Service.Method arg       invoke a method and print its reply
+  list [Service]                list services and methods by reflection
+  ping [-n count] [-i interval] send heartbeats and print their round trip time
+  bench [-n requests] [-c concurrency] [-d duration] Service.Method arg
+                                run a load test and print latency percentiles
+
+Flags:
+`)
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	if *logConf != "" {
+		log.LoadConfiguration(*logConf)
+	} else {
+		log.Close()
+	}
+
+	var err error
+	args := flag.Args()
+	switch args[0] {
+	case "call":
+		err = runCall(args[1:])
+	case "list":
+		err = runList(args[1:])
+	case "ping":
+		err = runPing(args[1:])
+	case "bench":
+		err = runBench(args[1:])
+	default:
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+////////////////////////////////////////////
+// client
+////////////////////////////////////////////
+
+// serverAddress returns the address of @addr, or of the first node of the registry service.
+func serverAddress() (string, error) {
+	if *registryType == "" {
+		return *addr, nil
+	}
+	if *registryService == "" {
+		return "", jerrors.New("registry lookup needs -registry-service")
+	}
+
+	var (
+		err      error
+		registry gxregistry.Registry
+	)
+	opts := []gxregistry.Option{
+		gxregistry.WithAddrs(strings.Split(*registryAddr, ",")...),
+		gxregistry.WithTimeout(*timeout),
+		gxregistry.WithRoot(*registryRoot),
+	}
+	switch *registryType {
+	case "etcd":
+		registry, err = gxetcd.NewRegistry(opts...)
+	case "zookeeper":
+		registry, err = gxzookeeper.NewRegistry(opts...)
+	default:
+		return "", jerrors.Errorf("illegal registry type{%s}", *registryType)
+	}
+	if err != nil {
+		return "", jerrors.Trace(err)
+	}
+	defer registry.Close()
+
+	services, err := registry.GetServices(gxregistry.ServiceAttr{
+		Group:   *registryGroup,
+		Service: *registryService,
+		Version: *registryVersion,
+		Role:    gxregistry.SRT_Provider,
+	})
+	if err != nil {
+		return "", jerrors.Trace(err)
+	}
+	for _, service := range services {
+		if len(service.Nodes) != 0 {
+			node := service.Nodes[0]
+			return net.JoinHostPort(node.Address, strconv.Itoa(int(node.Port))), nil
+		}
+	}
+
+	return "", jerrors.Errorf("no node of service{%s} in registry", *registryService)
+}
+
+// newClient connects to the server by @connNum sessions and waits for them to be ready.
+func newClient(connNum int) (*rpc.Client, error) {
+	address, err := serverAddress()
+	if err != nil {
+		return nil, jerrors.Trace(err)
+	}
+
+	conf := rpc.NewClientConfig()
+	conf.AppName = "gettyctl"
+	conf.ProfilePort = 0 // no admin server
+	conf.Transport = *transport
+	conf.WSPath = *wsPath
+	conf.ConnectionNum = connNum
+	conf.FailFastTimeout = timeout.String()
+	if *transport == rpc.TransportUnix {
+		conf.ServerHost = address
+	} else {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, jerrors.Annotatef(err, "net.SplitHostPort(%s)", address)
+		}
+		conf.ServerHost = host
+		if conf.ServerPort, err = strconv.Atoi(port); err != nil {
+			return nil, jerrors.Annotatef(err, "illegal port{%s}", port)
+		}
+	}
+	conf.TLS = rpc.TLSConfig{
+		Enable:             *tlsEnable || *transport == rpc.TransportWSS,
+		CertFile:           *certFile,
+		KeyFile:            *keyFile,
+		CAFile:             *caFile,
+		ServerName:         *serverName,
+		InsecureSkipVerify: *insecure,
+	}
+	conf.Auth = rpc.AuthConfig{Type: *authType, Token: *token, KeyID: *hmacKeyID, Secret: *hmacSecret}
+	conf.GettySessionParam.SessionName = "gettyctl"
+	conf.GettySessionParam.MaxMsgLen = 1024 * 1024
+
+	client, err := rpc.NewClientWithConfig(conf)
+	if err != nil {
+		return nil, jerrors.Trace(err)
+	}
+	switch *codec {
+	case "json":
+		client.SetCodecType(rpc.JSON)
+	case "protobuf":
+		client.SetCodecType(rpc.ProtoBuffer)
+	default:
+		client.Close()
+		return nil, jerrors.Errorf("illegal codec{%s}", *codec)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	if err = client.WaitReady(ctx); err != nil {
+		client.Close()
+		return nil, jerrors.Annotatef(err, "connect to %s", address)
+	}
+
+	return client, nil
+}
+
+////////////////////////////////////////////
+// message
+////////////////////////////////////////////
+
+// rawProto is an encoded protobuf message.
+type rawProto []byte
+
+func (m *rawProto) Marshal() ([]byte, error) {
+	return *m, nil
+}
+
+func (m *rawProto) Unmarshal(data []byte) error {
+	*m = append((*m)[:0], data...)
+	return nil
+}
+
+// parseMethod splits "Service.Method".
+func parseMethod(s string) (string, string, error) {
+	idx := strings.LastIndex(s, ".")
+	if idx <= 0 || idx == len(s)-1 {
+		return "", "", jerrors.Errorf("illegal method{%s}, which should be Service.Method", s)
+	}
+
+	return s[:idx], s[idx+1:], nil
+}
+
+// parseArg returns the argument of a call, which is read from stdin if @s is "-".
+func parseArg(s string) (interface{}, error) {
+	if s == "-" {
+		data, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, jerrors.Trace(err)
+		}
+		s = string(data)
+	}
+
+	if *codec == "protobuf" {
+		data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+		if err != nil {
+			return nil, jerrors.Annotate(err, "protobuf argument should be base64 encoded")
+		}
+		msg := rawProto(data)
+		return &msg, nil
+	}
+
+	if !json.Valid([]byte(s)) {
+		return nil, jerrors.Errorf("illegal json argument{%s}", s)
+	}
+	return json.RawMessage(s), nil
+}
+
+func newReply() interface{} {
+	if *codec == "protobuf" {
+		return new(rawProto)
+	}
+
+	return new(json.RawMessage)
+}
+
+func printReply(reply interface{}) {
+	switch r := reply.(type) {
+	case *rawProto:
+		fmt.Println(base64.StdEncoding.EncodeToString(*r))
+	case *json.RawMessage:
+		printJSON(*r)
+	}
+}
+
+func printJSON(v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "json.MarshalIndent() = error{%s}\n", err)
+		return
+	}
+	fmt.Println(string(data))
+}
+
+////////////////////////////////////////////
+// commands
+////////////////////////////////////////////
+
+func runCall(args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return jerrors.New("usage: call Service.Method [arg]")
+	}
+	service, method, err := parseMethod(args[0])
+	if err != nil {
+		return jerrors.Trace(err)
+	}
+	argStr := "null"
+	if len(args) == 2 {
+		argStr = args[1]
+	}
+	arg, err := parseArg(argStr)
+	if err != nil {
+		return jerrors.Trace(err)
+	}
+
+	client, err := newClient(1)
+	if err != nil {
+		return jerrors.Trace(err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	reply := newReply()
+	if err = client.CallWithContext(ctx, service, method, arg, reply); err != nil {
+		return jerrors.Trace(err)
+	}
+	printReply(reply)
+
+	return nil
+}
+
+func runList(args []string) error {
+	if len(args) > 1 {
+		return jerrors.New("usage: list [Service]")
+	}
+
+	client, err := newClient(1)
+	if err != nil {
+		return jerrors.Trace(err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	if len(args) == 1 {
+		desc, err := client.DescribeService(ctx, args[0])
+		if err != nil {
+			return jerrors.Trace(err)
+		}
+		printJSON(desc)
+		return nil
+	}
+
+	services, err := client.ListServices(ctx)
+	if err != nil {
+		return jerrors.Trace(err)
+	}
+	for _, service := range services {
+		fmt.Printf("%s (service: %s, version: %s)\n", service.Name, service.Service, service.Version)
+		for _, method := range service.Methods {
+			fmt.Printf("    %s(%s) %s\n", method.Name, method.ArgType, method.ReplyType)
+		}
+	}
+
+	return nil
+}
+
+func runPing(args []string) error {
+	fs := flag.NewFlagSet("ping", flag.ContinueOnError)
+	count := fs.Int("n", 4, "number of heartbeats, infinite if it is not greater than 0")
+	interval := fs.Duration("i", time.Second, "interval between heartbeats")
+	if err := fs.Parse(args); err != nil {
+		return jerrors.Trace(err)
+	}
+
+	client, err := newClient(1)
+	if err != nil {
+		return jerrors.Trace(err)
+	}
+	defer client.Close()
+
+	var (
+		sent, received         int
+		minRTT, maxRTT, sumRTT time.Duration
+	)
+	for i := 0; *count <= 0 || i < *count; i++ {
+		if i > 0 {
+			time.Sleep(*interval)
+		}
+		sent++
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		rtt, err := client.Ping(ctx)
+		cancel()
+		if err != nil {
+			fmt.Printf("seq=%d error: %s\n", i, err)
+			continue
+		}
+		received++
+		sumRTT += rtt
+		if minRTT == 0 || rtt < minRTT {
+			minRTT = rtt
+		}
+		if rtt > maxRTT {
+			maxRTT = rtt
+		}
+		fmt.Printf("seq=%d rtt=%s\n", i, rtt)
+	}
+
+	fmt.Printf("--- %d heartbeats sent, %d received", sent, received)
+	if received > 0 {
+		fmt.Printf(", rtt min/avg/max = %s/%s/%s", minRTT, sumRTT/time.Duration(received), maxRTT)
+	}
+	fmt.Println()
+
+	return nil
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseMethod(t *testing.T) {
+	tests := []struct {
+		s       string
+		service string
+		method  string
+		ok      bool
+	}{
+		{"Arith.Add", "Arith", "Add", true},
+		{"pkg.Arith.Add", "pkg.Arith", "Add", true},
+		{"", "", "", false},
+		{"Arith", "", "", false},
+		{".Add", "", "", false},
+		{"Arith.", "", "", false},
+		{".", "", "", false},
+	}
+	for _, test := range tests {
+		service, method, err := parseMethod(test.s)
+		if (err == nil) != test.ok || service != test.service || method != test.method {
+			t.Errorf("parseMethod(%q) = (%q, %q, error{%v}), want (%q, %q, ok:%t)",
+				test.s, service, method, err, test.service, test.method, test.ok)
+		}
+	}
+}
+
+// withCodec sets the codec flag to @c until the end of the test.
+func withCodec(t *testing.T, c string) {
+	saved := *codec
+	*codec = c
+	t.Cleanup(func() { *codec = saved })
+}
+
+func TestParseArg(t *testing.T) {
+	tests := []struct {
+		codec string
+		s     string
+		want  interface{}
+		ok    bool
+	}{
+		{"json", `{"a": 1}`, json.RawMessage(`{"a": 1}`), true},
+		{"json", "null", json.RawMessage("null"), true},
+		{"json", "[1, 2", nil, false},
+		{"json", "", nil, false},
+		{"protobuf", "CAE=", &rawProto{0x08, 0x01}, true},
+		{"protobuf", " CAE=\n", &rawProto{0x08, 0x01}, true},
+		{"protobuf", "not base64!", nil, false},
+	}
+	for _, test := range tests {
+		withCodec(t, test.codec)
+		arg, err := parseArg(test.s)
+		if (err == nil) != test.ok || (test.ok && !reflect.DeepEqual(arg, test.want)) {
+			t.Errorf("parseArg(%q) in %s codec = (%v, error{%v}), want (%v, ok:%t)",
+				test.s, test.codec, arg, err, test.want, test.ok)
+		}
+	}
+}
+
+func TestParseArgStdin(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("os.Pipe() = error{%v}", err)
+	}
+	w.WriteString(`{"a": 1}`)
+	w.Close()
+	saved := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = saved }()
+
+	withCodec(t, "json")
+	arg, err := parseArg("-")
+	if want := json.RawMessage(`{"a": 1}`); err != nil || !reflect.DeepEqual(arg, want) {
+		t.Errorf("parseArg(-) = (%s, error{%v}), want %s", arg, err, want)
+	}
+}
+
+// durations returns the durations of @ms milliseconds.
+func durations(ms ...int) []time.Duration {
+	var d []time.Duration
+	for _, m := range ms {
+		d = append(d, time.Duration(m)*time.Millisecond)
+	}
+
+	return d
+}
+
+func TestPercentile(t *testing.T) {
+	var hundred []int
+	for i := 1; i <= 100; i++ {
+		hundred = append(hundred, i)
+	}
+	tests := []struct {
+		latencies []time.Duration
+		p         float64
+		want      time.Duration
+	}{
+		{nil, 50, 0},
+		{durations(), 99, 0},
+		{durations(7), 0, 7 * time.Millisecond},
+		{durations(7), 50, 7 * time.Millisecond},
+		{durations(7), 100, 7 * time.Millisecond},
+		{durations(hundred...), 0, time.Millisecond},
+		{durations(hundred...), 1, time.Millisecond},
+		{durations(hundred...), 50, 50 * time.Millisecond},
+		{durations(hundred...), 50.5, 51 * time.Millisecond},
+		{durations(hundred...), 99, 99 * time.Millisecond},
+		{durations(hundred...), 99.9, 100 * time.Millisecond},
+		{durations(hundred...), 100, 100 * time.Millisecond},
+		{durations(1, 2, 3, 4), 25, time.Millisecond},
+		{durations(1, 2, 3, 4), 26, 2 * time.Millisecond},
+		{durations(1, 2, 3, 4), 75, 3 * time.Millisecond},
+	}
+	for _, test := range tests {
+		if got := percentile(test.latencies, test.p); got != test.want {
+			t.Errorf("percentile(%d latencies, %g) = %s, want %s", len(test.latencies), test.p, got, test.want)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	tests := []struct {
+		latencies []time.Duration
+		failed    int
+		want      benchStats
+	}{
+		{nil, 0, benchStats{}},
+		{nil, 3, benchStats{total: 3, failed: 3}},
+		{
+			durations(4, 1, 3, 2), 1,
+			benchStats{
+				total:       5,
+				succeeded:   4,
+				failed:      1,
+				min:         time.Millisecond,
+				avg:         2500 * time.Microsecond,
+				max:         4 * time.Millisecond,
+				percentiles: durations(2, 4, 4, 4, 4),
+			},
+		},
+		{
+			durations(5), 0,
+			benchStats{
+				total:       1,
+				succeeded:   1,
+				min:         5 * time.Millisecond,
+				avg:         5 * time.Millisecond,
+				max:         5 * time.Millisecond,
+				percentiles: durations(5, 5, 5, 5, 5),
+			},
+		},
+	}
+	for _, test := range tests {
+		if got := summarize(test.latencies, test.failed); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("summarize(%v, %d) = %+v, want %+v", test.latencies, test.failed, got, test.want)
+		}
+	}
+}
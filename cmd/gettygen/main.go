@@ -0,0 +1,421 @@
+// gettygen generates a typed rpc client and a server registration helper from a Go interface,
+// so that the typos of service & method names and the mismatches of argument types become
+// build errors. Put a go:generate directive beside the interface:
+//
+//	//go:generate gettygen -type ArithService -service Arith
+//	type ArithService interface {
+//		Add(ctx context.Context, req *AddReq, rsp *AddRsp) error
+//		Sum(nums []int, sum *int) error
+//	}
+//
+// Every method must have the signature of an rpc service method: an optional context.Context,
+// the argument, the pointer of the reply, and an error result. gettygen writes
+// arithservice_getty.go, which contains:
+//
+//	const ArithServiceName = "Arith"
+//	func NewArithClient(client *rpc.Client) *ArithClient
+//	func (c *ArithClient) Add(ctx context.Context, arg *AddReq, opts ...rpc.CallOption) (*AddRsp, error)
+//	func RegisterArithService(server *rpc.Server, impl ArithService) error
+//
+// RegisterArithService registers a dispatch table which calls @impl without reflection.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+import (
+	jerrors "github.com/juju/errors"
+)
+
+const (
+	rpcImportPath = "github.com/AlexStocks/getty/rpc"
+)
+
+var (
+	typeName    = flag.String("type", "", "name of the service interface, required")
+	serviceName = flag.String("service", "", "rpc service name, whose default value is the interface name")
+	version     = flag.String("version", "v1", "service version returned by GettyRPCService.Version")
+	output      = flag.String("output", "", "output file name, whose default value is <type>_getty.go in lower case")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `Usage: gettygen -type Interface [flags] [package directory]
+
+The package directory is "." in default.
+
+Flags:
+`)
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if *typeName == "" || flag.NArg() > 1 {
+		usage()
+		os.Exit(2)
+	}
+	dir := "."
+	if flag.NArg() == 1 {
+		dir = flag.Arg(0)
+	}
+	if err := generate(dir); err != nil {
+		fmt.Fprintf(os.Stderr, "gettygen: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+////////////////////////////////////////////
+// parse
+////////////////////////////////////////////
+
+// method is an rpc method of the interface. Arg & Reply are the sources of their type expressions.
+type method struct {
+	Name    string
+	HasCtx  bool
+	Arg     string
+	ArgElem string // element type of Arg if Arg is a pointer, or Arg itself
+	Reply   string // without the leading '*'
+	Comment string
+}
+
+type generator struct {
+	fset    *token.FileSet
+	file    *ast.File
+	pkg     string
+	iface   *ast.InterfaceType
+	methods []method
+	imports map[string]string // path -> alias, "" if the alias is the default package name
+}
+
+func generate(dir string) error {
+	g := &generator{fset: token.NewFileSet(), imports: make(map[string]string)}
+	if err := g.find(dir); err != nil {
+		return jerrors.Trace(err)
+	}
+	if err := g.parseMethods(); err != nil {
+		return jerrors.Trace(err)
+	}
+	src, err := g.render()
+	if err != nil {
+		return jerrors.Trace(err)
+	}
+
+	name := *output
+	if name == "" {
+		name = strings.ToLower(*typeName) + "_getty.go"
+	}
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(dir, name)
+	}
+
+	return jerrors.Trace(ioutil.WriteFile(name, src, 0644))
+}
+
+// find looks up the interface declaration in the go files of @dir.
+func (g *generator) find(dir string) error {
+	pkgs, err := parser.ParseDir(g.fset, dir, func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, parser.ParseComments)
+	if err != nil {
+		return jerrors.Trace(err)
+	}
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Files {
+			for _, decl := range file.Decls {
+				gen, ok := decl.(*ast.GenDecl)
+				if !ok || gen.Tok != token.TYPE {
+					continue
+				}
+				for _, spec := range gen.Specs {
+					ts := spec.(*ast.TypeSpec)
+					if ts.Name.Name != *typeName {
+						continue
+					}
+					iface, ok := ts.Type.(*ast.InterfaceType)
+					if !ok {
+						return jerrors.Errorf("%s: %s is not an interface", g.fset.Position(ts.Pos()), *typeName)
+					}
+					g.file, g.pkg, g.iface = file, file.Name.Name, iface
+					return nil
+				}
+			}
+		}
+	}
+
+	return jerrors.Errorf("can not find interface %s in directory %s", *typeName, dir)
+}
+
+func (g *generator) parseMethods() error {
+	for _, field := range g.iface.Methods.List {
+		pos := g.fset.Position(field.Pos())
+		if len(field.Names) == 0 {
+			return jerrors.Errorf("%s: embedded interface is not supported", pos)
+		}
+		ft := field.Type.(*ast.FuncType)
+		name := field.Names[0].Name
+		// the methods of GettyRPCService are provided by the generated handler
+		if (name == "Service" || name == "Version") && ft.Params.NumFields() == 0 {
+			continue
+		}
+
+		var params []ast.Expr
+		for _, p := range ft.Params.List {
+			n := len(p.Names)
+			if n == 0 {
+				n = 1
+			}
+			for i := 0; i < n; i++ {
+				params = append(params, p.Type)
+			}
+		}
+		m := method{Name: name, Comment: strings.TrimSpace(field.Doc.Text())}
+		if len(params) == 3 {
+			if !g.isContext(params[0]) {
+				return jerrors.Errorf("%s: the first parameter of method %s is not context.Context", pos, name)
+			}
+			m.HasCtx = true
+			params = params[1:]
+		}
+		if len(params) != 2 {
+			return jerrors.Errorf("%s: method %s should have the parameters ([ctx context.Context,] arg, reply) ", pos, name)
+		}
+		reply, ok := params[1].(*ast.StarExpr)
+		if !ok {
+			return jerrors.Errorf("%s: the reply of method %s is not a pointer", pos, name)
+		}
+		if ft.Results.NumFields() != 1 || !isIdent(ft.Results.List[0].Type, "error") {
+			return jerrors.Errorf("%s: method %s should return an error only", pos, name)
+		}
+
+		var err error
+		if m.Arg, err = g.typeString(params[0]); err != nil {
+			return jerrors.Trace(err)
+		}
+		m.ArgElem = m.Arg
+		if star, ok := params[0].(*ast.StarExpr); ok {
+			if m.ArgElem, err = g.typeString(star.X); err != nil {
+				return jerrors.Trace(err)
+			}
+		}
+		if m.Reply, err = g.typeString(reply.X); err != nil {
+			return jerrors.Trace(err)
+		}
+		g.methods = append(g.methods, m)
+	}
+	if len(g.methods) == 0 {
+		return jerrors.Errorf("interface %s has no rpc method", *typeName)
+	}
+
+	return nil
+}
+
+func isIdent(expr ast.Expr, name string) bool {
+	ident, ok := expr.(*ast.Ident)
+	return ok && ident.Name == name
+}
+
+// isContext checks whether @expr is context.Context of the standard library.
+func (g *generator) isContext(expr ast.Expr) bool {
+	sel, ok := expr.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Context" {
+		return false
+	}
+	x, ok := sel.X.(*ast.Ident)
+	if !ok {
+		return false
+	}
+	p, _ := g.importOf(x.Name)
+	return p == "context"
+}
+
+// importOf returns the import path and the alias of the package which is named @name in the
+// file of the interface.
+func (g *generator) importOf(name string) (string, string) {
+	for _, spec := range g.file.Imports {
+		p, _ := strconv.Unquote(spec.Path.Value)
+		if spec.Name != nil {
+			if spec.Name.Name == name {
+				return p, name
+			}
+			continue
+		}
+		if defaultPackageName(p) == name {
+			return p, ""
+		}
+	}
+
+	return "", ""
+}
+
+// defaultPackageName guesses the package name of import path @p by its last element.
+func defaultPackageName(p string) string {
+	name := path.Base(p)
+	if strings.HasPrefix(name, "go-") {
+		name = name[len("go-"):]
+	}
+	if idx := strings.IndexAny(name, ".-"); idx > 0 {
+		name = name[:idx]
+	}
+
+	return name
+}
+
+// typeString returns the source of the type expression @expr, and records the packages it uses.
+func (g *generator) typeString(expr ast.Expr) (string, error) {
+	var err error
+	ast.Inspect(expr, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if x, ok := sel.X.(*ast.Ident); ok {
+			p, alias := g.importOf(x.Name)
+			if p == "" {
+				err = jerrors.Errorf("%s: can not find the import of package %s", g.fset.Position(x.Pos()), x.Name)
+				return false
+			}
+			g.imports[p] = alias
+		}
+		return false
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, g.fset, expr); err != nil {
+		return "", jerrors.Trace(err)
+	}
+
+	return buf.String(), nil
+}
+
+////////////////////////////////////////////
+// render
+////////////////////////////////////////////
+
+func (g *generator) render() ([]byte, error) {
+	service := *serviceName
+	if service == "" {
+		service = *typeName
+	}
+	if !token.IsIdentifier(service) {
+		return nil, jerrors.Errorf("service name %s is not a go identifier", service)
+	}
+	var (
+		constName = service + "ServiceName"
+		client    = service + "Client"
+		handler   = lowerFirst(*typeName) + "Handler"
+		buf       bytes.Buffer
+	)
+	w := func(format string, args ...interface{}) {
+		fmt.Fprintf(&buf, format, args...)
+	}
+
+	w("// Code generated by gettygen -type %s. DO NOT EDIT.\n\n", *typeName)
+	w("package %s\n\n", g.pkg)
+	g.imports["context"] = ""
+	g.imports[rpcImportPath] = ""
+	var std, other []string
+	for p, alias := range g.imports {
+		spec := strconv.Quote(p)
+		if alias != "" {
+			spec = alias + " " + spec
+		}
+		if strings.Contains(strings.SplitN(p, "/", 2)[0], ".") {
+			other = append(other, spec)
+		} else {
+			std = append(std, spec)
+		}
+	}
+	for _, specs := range [][]string{std, other} {
+		if len(specs) == 0 {
+			continue
+		}
+		sort.Strings(specs)
+		w("import (\n\t%s\n)\n\n", strings.Join(specs, "\n\t"))
+	}
+
+	w("// %s is the rpc service name of %s.\n", constName, *typeName)
+	w("const %s = %q\n\n", constName, service)
+
+	w("////////////////////////////////////////////\n// %s\n////////////////////////////////////////////\n\n", client)
+	w("// %s is the typed rpc client of %s.\n", client, *typeName)
+	w("type %s struct {\n\tclient *rpc.Client\n}\n\n", client)
+	w("func New%s(client *rpc.Client) *%s {\n\treturn &%s{client: client}\n}\n\n", client, client, client)
+	for _, m := range g.methods {
+		if m.Comment != "" {
+			w("// %s\n", strings.Replace(m.Comment, "\n", "\n// ", -1))
+		}
+		w("func (c *%s) %s(ctx context.Context, arg %s, opts ...rpc.CallOption) (*%s, error) {\n",
+			client, m.Name, m.Arg, m.Reply)
+		w("\treply := new(%s)\n", m.Reply)
+		w("\tif err := c.client.CallWithContext(ctx, %s, %q, arg, reply, opts...); err != nil {\n", constName, m.Name)
+		w("\t\treturn nil, err\n\t}\n\n\treturn reply, nil\n}\n\n")
+	}
+
+	w("////////////////////////////////////////////\n// %s server\n////////////////////////////////////////////\n\n", *typeName)
+	w("// Register%s publishes @impl as the %s service of @server, whose methods are\n", *typeName, service)
+	w("// dispatched without reflection.\n")
+	w("func Register%s(server *rpc.Server, impl %s) error {\n", *typeName, *typeName)
+	w("\treturn server.RegisterDispatchTable(%s, &%s{impl: impl}, rpc.DispatchTable{\n", constName, handler)
+	for _, m := range g.methods {
+		arg := "arg.(*" + m.ArgElem + ")"
+		if m.Arg == m.ArgElem {
+			arg = "*" + arg
+		}
+		ctx := ""
+		if m.HasCtx {
+			ctx = "ctx, "
+		}
+		w("\t\t%q: {\n", m.Name)
+		w("\t\t\tNewArg:   func() interface{} { return new(%s) },\n", m.ArgElem)
+		w("\t\t\tNewReply: func() interface{} { return new(%s) },\n", m.Reply)
+		w("\t\t\tCall: func(ctx context.Context, arg, reply interface{}) error {\n")
+		w("\t\t\t\treturn impl.%s(%s%s, reply.(*%s))\n\t\t\t},\n\t\t},\n", m.Name, ctx, arg, m.Reply)
+	}
+	w("\t})\n}\n\n")
+	w("// %s implements GettyRPCService for %s. Its rpc methods describe\n", handler, *typeName)
+	w("// the service, and the calls are dispatched by the table of Register%s.\n", *typeName)
+	w("type %s struct {\n\timpl %s\n}\n\n", handler, *typeName)
+	w("func (h *%s) Service() string {\n\treturn %s\n}\n\n", handler, constName)
+	w("func (h *%s) Version() string {\n\treturn %q\n}\n", handler, *version)
+	for _, m := range g.methods {
+		w("\nfunc (h *%s) %s(ctx context.Context, arg %s, reply *%s) error {\n", handler, m.Name, m.Arg, m.Reply)
+		if m.HasCtx {
+			w("\treturn h.impl.%s(ctx, arg, reply)\n}\n", m.Name)
+		} else {
+			w("\treturn h.impl.%s(arg, reply)\n}\n", m.Name)
+		}
+	}
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, jerrors.Annotatef(err, "format.Source(%s)", buf.String())
+	}
+
+	return src, nil
+}
+
+func lowerFirst(s string) string {
+	r, n := utf8.DecodeRuneInString(s)
+	return string(unicode.ToLower(r)) + s[n:]
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+// gen runs gettygen in @dir, and returns the generated source.
+func gen(t *testing.T, dir, typ, service, ver string) []byte {
+	out := filepath.Join(t.TempDir(), "out.go")
+	saved := [...]string{*typeName, *serviceName, *version, *output}
+	*typeName, *serviceName, *version, *output = typ, service, ver, out
+	defer func() {
+		*typeName, *serviceName, *version, *output = saved[0], saved[1], saved[2], saved[3]
+	}()
+
+	if err := generate(dir); err != nil {
+		t.Fatalf("generate(%s) = error{%v}", dir, err)
+	}
+	src, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatalf("ReadFile(%s) = error{%v}", out, err)
+	}
+
+	return src
+}
+
+func TestGenerateGolden(t *testing.T) {
+	src := gen(t, "testdata/arith", "ArithService", "Arith", "v2")
+	golden := "testdata/arith/arithservice_getty.go.golden"
+	if *update {
+		if err := ioutil.WriteFile(golden, src, 0644); err != nil {
+			t.Fatalf("WriteFile(%s) = error{%v}", golden, err)
+		}
+	}
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("ReadFile(%s) = error{%v}", golden, err)
+	}
+	if !bytes.Equal(src, want) {
+		t.Errorf("generated source differs from %s, pls run go test -update if it is expected:\n%s", golden, src)
+	}
+
+	// the generated source compiles with the sample interface
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skipf("go command is not found: %v", err)
+	}
+	dir, err := ioutil.TempDir(".", "_compile")
+	if err != nil {
+		t.Fatalf("TempDir() = error{%v}", err)
+	}
+	defer os.RemoveAll(dir)
+	sample, err := ioutil.ReadFile("testdata/arith/arith.go")
+	if err != nil {
+		t.Fatalf("ReadFile(arith.go) = error{%v}", err)
+	}
+	for name, data := range map[string][]byte{"arith.go": sample, "arithservice_getty.go": src} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatalf("WriteFile(%s) = error{%v}", name, err)
+		}
+	}
+	if out, err := exec.Command("go", "build", "./"+dir).CombinedOutput(); err != nil {
+		t.Errorf("go build the generated source = error{%v}:\n%s", err, out)
+	}
+}
+
+// TestGenerateExample makes sure that the checked-in source of the example service is what
+// gettygen generates now.
+func TestGenerateExample(t *testing.T) {
+	const (
+		dir       = "../../rpc/example/data"
+		generated = dir + "/testrpcservice_getty.go"
+	)
+	src := gen(t, dir, "TestRpcService", "TestRpc", "v1.0")
+	want, err := ioutil.ReadFile(generated)
+	if err != nil {
+		t.Fatalf("ReadFile(%s) = error{%v}", generated, err)
+	}
+	if !bytes.Equal(src, want) {
+		t.Errorf("%s is out of date, pls run go generate in %s", generated, dir)
+	}
+}
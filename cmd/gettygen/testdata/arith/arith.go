@@ -0,0 +1,26 @@
+// Package arith is the sample service of the gettygen golden test.
+package arith
+
+import (
+	"context"
+	"time"
+)
+
+type AddReq struct {
+	A, B int
+}
+
+type AddRsp struct {
+	Sum int
+}
+
+//go:generate gettygen -type ArithService -service Arith -version v2
+type ArithService interface {
+	// Add returns the sum of A & B.
+	// It never fails.
+	Add(ctx context.Context, req *AddReq, rsp *AddRsp) error
+	Sum(nums []int, sum *int) error
+	Sleep(ctx context.Context, d time.Duration, wakeup *time.Time) error
+	Service() string
+	Version() string
+}
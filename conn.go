@@ -44,14 +44,16 @@ var (
 )
 
 type gettyConn struct {
+	// the 64-bit atomic counters come first to be 64-bit aligned on 32-bit platforms,
+	// which requires that gettyConn is the first field of the connections embedding it.
+	readBytes     uint64 // read bytes
+	writeBytes    uint64 // write bytes
+	readPkgNum    uint64 // send pkg number
+	writePkgNum   uint64 // recv pkg number
 	id            uint32
 	compress      CompressType
 	padding1      uint8
 	padding2      uint16
-	readBytes     uint32        // read bytes
-	writeBytes    uint32        // write bytes
-	readPkgNum    uint32        // send pkg number
-	writePkgNum   uint32        // recv pkg number
 	active        int64         // last active, in milliseconds
 	rTimeout      time.Duration // network current limiting
 	wTimeout      time.Duration
@@ -75,11 +77,11 @@ func (c *gettyConn) RemoteAddr() string {
 }
 
 func (c *gettyConn) incReadPkgNum() {
-	atomic.AddUint32(&c.readPkgNum, 1)
+	atomic.AddUint64(&c.readPkgNum, 1)
 }
 
 func (c *gettyConn) incWritePkgNum() {
-	atomic.AddUint32(&c.writePkgNum, 1)
+	atomic.AddUint64(&c.writePkgNum, 1)
 }
 
 func (c *gettyConn) UpdateActive() {
@@ -251,7 +253,7 @@ func (t *gettyTCPConn) read(p []byte) (int, error) {
 
 	length, err = t.reader.Read(p)
 	log.Debug("now:%s, length:%d, err:%s", currentTime, length, err)
-	atomic.AddUint32(&t.readBytes, uint32(length))
+	atomic.AddUint64(&t.readBytes, uint64(length))
 	return length, jerrors.Trace(err)
 	//return length, err
 }
@@ -283,7 +285,7 @@ func (t *gettyTCPConn) Write(pkg interface{}) (int, error) {
 	}
 
 	if length, err = t.writer.Write(p); err == nil {
-		atomic.AddUint32(&t.writeBytes, (uint32)(len(p)))
+		atomic.AddUint64(&t.writeBytes, uint64(len(p)))
 	}
 	log.Debug("now:%s, length:%d, err:%s", currentTime, length, err)
 	return length, jerrors.Trace(err)
@@ -302,7 +304,14 @@ func (t *gettyTCPConn) close(waitSec int) {
 				log.Error("snappy.Writer.Close() = error{%s}", jerrors.ErrorStack(err))
 			}
 		}
-		t.conn.(*net.TCPConn).SetLinger(waitSec)
+		if tcpConn, ok := t.conn.(*net.TCPConn); ok {
+			tcpConn.SetLinger(waitSec)
+		} else if tlsConn, ok := t.conn.(*tls.Conn); ok {
+			tlsConn.CloseWrite()
+			if tcpConn, ok := tlsConn.NetConn().(*net.TCPConn); ok {
+				tcpConn.SetLinger(waitSec)
+			}
+		}
 		t.conn.Close()
 		t.conn = nil
 	}
@@ -402,7 +411,7 @@ func (u *gettyUDPConn) read(p []byte) (int, *net.UDPAddr, error) {
 	length, addr, err = u.conn.ReadFromUDP(p) // connected udp also can get return @addr
 	log.Debug("ReadFromUDP() = {length:%d, peerAddr:%s, error:%s}", length, addr, err)
 	if err == nil {
-		atomic.AddUint32(&u.readBytes, uint32(length))
+		atomic.AddUint64(&u.readBytes, uint64(length))
 	}
 
 	//return length, addr, err
@@ -448,7 +457,7 @@ func (u *gettyUDPConn) Write(udpCtx interface{}) (int, error) {
 	}
 
 	if length, _, err = u.conn.WriteMsgUDP(buf, nil, peerAddr); err == nil {
-		atomic.AddUint32(&u.writeBytes, (uint32)(len(buf)))
+		atomic.AddUint64(&u.writeBytes, uint64(len(buf)))
 	}
 	log.Debug("WriteMsgUDP(peerAddr:%s) = {length:%d, error:%s}", peerAddr, length, err)
 
@@ -590,7 +599,7 @@ func (w *gettyWSConn) Write(pkg interface{}) (int, error) {
 
 	w.updateWriteDeadline()
 	if err = w.conn.WriteMessage(websocket.BinaryMessage, p); err == nil {
-		atomic.AddUint32(&w.writeBytes, (uint32)(len(p)))
+		atomic.AddUint64(&w.writeBytes, uint64(len(p)))
 	}
 	return len(p), jerrors.Trace(err)
 	//return len(p), err
@@ -22,20 +22,24 @@ const (
 	TCP_CLIENT   EndPointType = 2
 	WS_CLIENT    EndPointType = 3
 	WSS_CLIENT   EndPointType = 4
+	UNIX_CLIENT  EndPointType = 5
 	TCP_SERVER   EndPointType = 7
 	WS_SERVER    EndPointType = 8
 	WSS_SERVER   EndPointType = 9
+	UNIX_SERVER  EndPointType = 10
 )
 
 var EndPointType_name = map[int32]string{
-	0: "UDP_ENDPOINT",
-	1: "UDP_CLIENT",
-	2: "TCP_CLIENT",
-	3: "WS_CLIENT",
-	4: "WSS_CLIENT",
-	7: "TCP_SERVER",
-	8: "WS_SERVER",
-	9: "WSS_SERVER",
+	0:  "UDP_ENDPOINT",
+	1:  "UDP_CLIENT",
+	2:  "TCP_CLIENT",
+	3:  "WS_CLIENT",
+	4:  "WSS_CLIENT",
+	5:  "UNIX_CLIENT",
+	7:  "TCP_SERVER",
+	8:  "WS_SERVER",
+	9:  "WSS_SERVER",
+	10: "UNIX_SERVER",
 }
 
 var EndPointType_value = map[string]int32{
@@ -44,9 +48,11 @@ var EndPointType_value = map[string]int32{
 	"TCP_CLIENT":   2,
 	"WS_CLIENT":    3,
 	"WSS_CLIENT":   4,
+	"UNIX_CLIENT":  5,
 	"TCP_SERVER":   7,
 	"WS_SERVER":    8,
 	"WSS_SERVER":   9,
+	"UNIX_SERVER":  10,
 }
 
 func (x EndPointType) String() string {
@@ -64,6 +64,14 @@ type EventListener interface {
 	OnMessage(Session, interface{})
 }
 
+// PackageDropListener is an optional interface of EventListener. OnDrop is invoked instead of OnMessage
+// if the package will not be handled, e.g. the session pool has been busy for the wait time of the
+// session, or the session is closed before the package is handled. It is invoked in the session
+// handle goroutine, so pls do not block in it.
+type PackageDropListener interface {
+	OnDrop(Session, interface{})
+}
+
 /////////////////////////////////////////
 // compress
 /////////////////////////////////////////
@@ -119,6 +127,25 @@ var (
 	ErrNullPeerAddr   = errors.New("peer address is nil")
 )
 
+// SessionStatistic is a snapshot of the session's network counters and queue depths.
+type SessionStatistic struct {
+	ReadBytes    uint64 `json:"read_bytes"`
+	WriteBytes   uint64 `json:"write_bytes"`
+	ReadPkgNum   uint64 `json:"read_pkg_num"`
+	WritePkgNum  uint64 `json:"write_pkg_num"`
+	RQLen        int    `json:"rq_len"`
+	RQCap        int    `json:"rq_cap"`
+	WQLen        int    `json:"wq_len"`
+	WQCap        int    `json:"wq_cap"`
+	PoolWorkers  int    `json:"pool_workers"`
+	PoolQueueLen int    `json:"pool_queue_len"`
+}
+
+// Statistician is an optional interface of Session, which is implemented by the sessions of getty.
+type Statistician interface {
+	Statistic() SessionStatistic
+}
+
 type Session interface {
 	Connection
 	Reset()
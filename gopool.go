@@ -31,6 +31,16 @@ func NewPool(size, queue, spawn int) *Pool {
 	return p
 }
 
+// Workers returns the number of running workers.
+func (p *Pool) Workers() int {
+	return len(p.sem)
+}
+
+// QueueLen returns the number of tasks waiting for a worker.
+func (p *Pool) QueueLen() int {
+	return len(p.work)
+}
+
 func (p *Pool) ScheduleTimeout(timeout time.Duration, task func()) error {
 	return p.schedule(task, time.After(timeout))
 }
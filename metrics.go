@@ -0,0 +1,295 @@
+/******************************************************
+# DESC       : getty metrics in prometheus text format
+# MAINTAINER : Alex Stocks
+# LICENCE    : Apache License 2.0
+# EMAIL      : alexstocks@foxmail.com
+# MOD        : 2026-10-19 10:20
+# FILE       : metrics.go
+******************************************************/
+
+package getty
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+import (
+	"github.com/AlexStocks/goext/sync"
+	log "github.com/AlexStocks/log4go"
+)
+
+const (
+	metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+var (
+	metricsDisabled int32
+	metrics         = newSessionMetrics()
+
+	collectorLock sync.RWMutex
+	collectors    = make(map[string]MetricsCollector)
+)
+
+// MetricsCollector writes its metrics in prometheus text format into @w.
+type MetricsCollector func(w io.Writer) error
+
+// SetMetricsEnabled turns on or turns off the metrics. It is turned on in default.
+func SetMetricsEnabled(enable bool) {
+	if enable {
+		atomic.StoreInt32(&metricsDisabled, 0)
+	} else {
+		atomic.StoreInt32(&metricsDisabled, 1)
+	}
+}
+
+func MetricsEnabled() bool {
+	return atomic.LoadInt32(&metricsDisabled) == 0
+}
+
+// RegisterMetricsCollector adds a collector whose output will be appended to getty's metrics.
+// The collector registered with the same @name will be replaced.
+func RegisterMetricsCollector(name string, collector MetricsCollector) {
+	collectorLock.Lock()
+	collectors[name] = collector
+	collectorLock.Unlock()
+}
+
+// WriteMetrics writes all metrics in prometheus text format into @w.
+func WriteMetrics(w io.Writer) error {
+	if err := metrics.write(w); err != nil {
+		return err
+	}
+
+	collectorLock.RLock()
+	names := make([]string, 0, len(collectors))
+	for name := range collectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	list := make([]MetricsCollector, 0, len(names))
+	for _, name := range names {
+		list = append(list, collectors[name])
+	}
+	collectorLock.RUnlock()
+
+	for _, collector := range list {
+		if err := collector(w); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MetricsHandler returns a http handler serving prometheus scrape requests.
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !MetricsEnabled() {
+			http.Error(w, "metrics disabled", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", metricsContentType)
+		bw := bufio.NewWriter(w)
+		if err := WriteMetrics(bw); err != nil {
+			log.Warn("WriteMetrics() = error{%s}", err)
+		}
+		bw.Flush()
+	})
+}
+
+var metricsLabelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// MetricsLabel escapes @value to be a prometheus label value.
+func MetricsLabel(value string) string {
+	return metricsLabelReplacer.Replace(value)
+}
+
+/////////////////////////////////////////
+// session metrics
+/////////////////////////////////////////
+
+type endPointCounter struct {
+	readBytes        uint64
+	writeBytes       uint64
+	readPkgNum       uint64
+	writePkgNum      uint64
+	scheduleTimeouts uint64
+	blockedWrites    uint64
+}
+
+type sessionMetrics struct {
+	lock     sync.Mutex
+	sessions map[*session]gxsync.Empty
+	// counters of closed sessions and events
+	counters map[EndPointType]*endPointCounter
+}
+
+func newSessionMetrics() *sessionMetrics {
+	return &sessionMetrics{
+		sessions: make(map[*session]gxsync.Empty),
+		counters: make(map[EndPointType]*endPointCounter),
+	}
+}
+
+// counter returns the counter of @t. Pls make sure that @m.lock has been locked.
+func (m *sessionMetrics) counter(t EndPointType) *endPointCounter {
+	c, ok := m.counters[t]
+	if !ok {
+		c = &endPointCounter{}
+		m.counters[t] = c
+	}
+
+	return c
+}
+
+func (m *sessionMetrics) addSession(s *session) {
+	if !MetricsEnabled() {
+		return
+	}
+
+	m.lock.Lock()
+	m.sessions[s] = gxsync.Empty{}
+	m.lock.Unlock()
+}
+
+// removeSession accumulates the counters of the closed session @s.
+func (m *sessionMetrics) removeSession(s *session) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if _, ok := m.sessions[s]; !ok {
+		return
+	}
+	delete(m.sessions, s)
+	if conn := s.gettyConn(); conn != nil {
+		c := m.counter(s.EndPoint().EndPointType())
+		c.readBytes += atomic.LoadUint64(&(conn.readBytes))
+		c.writeBytes += atomic.LoadUint64(&(conn.writeBytes))
+		c.readPkgNum += atomic.LoadUint64(&(conn.readPkgNum))
+		c.writePkgNum += atomic.LoadUint64(&(conn.writePkgNum))
+	}
+}
+
+func (m *sessionMetrics) incScheduleTimeout(t EndPointType) {
+	if !MetricsEnabled() {
+		return
+	}
+
+	m.lock.Lock()
+	m.counter(t).scheduleTimeouts++
+	m.lock.Unlock()
+}
+
+func (m *sessionMetrics) incBlockedWrite(t EndPointType) {
+	if !MetricsEnabled() {
+		return
+	}
+
+	m.lock.Lock()
+	m.counter(t).blockedWrites++
+	m.lock.Unlock()
+}
+
+type endPointSnapshot struct {
+	endPointCounter
+	sessions int
+	rQLen    int
+	wQLen    int
+	poolQLen int
+}
+
+func (m *sessionMetrics) snapshot() map[EndPointType]*endPointSnapshot {
+	snapshots := make(map[EndPointType]*endPointSnapshot)
+	get := func(t EndPointType) *endPointSnapshot {
+		ss, ok := snapshots[t]
+		if !ok {
+			ss = &endPointSnapshot{}
+			snapshots[t] = ss
+		}
+		return ss
+	}
+
+	m.lock.Lock()
+	for t, c := range m.counters {
+		get(t).endPointCounter = *c
+	}
+	sessions := make([]*session, 0, len(m.sessions))
+	for s := range m.sessions {
+		sessions = append(sessions, s)
+	}
+	m.lock.Unlock()
+
+	for _, s := range sessions {
+		stat := s.Statistic()
+		ss := get(s.EndPoint().EndPointType())
+		ss.sessions++
+		ss.readBytes += stat.ReadBytes
+		ss.writeBytes += stat.WriteBytes
+		ss.readPkgNum += stat.ReadPkgNum
+		ss.writePkgNum += stat.WritePkgNum
+		ss.rQLen += stat.RQLen
+		ss.wQLen += stat.WQLen
+		ss.poolQLen += stat.PoolQueueLen
+	}
+
+	return snapshots
+}
+
+func (m *sessionMetrics) write(w io.Writer) error {
+	snapshots := m.snapshot()
+	types := make([]int, 0, len(snapshots))
+	for t := range snapshots {
+		types = append(types, int(t))
+	}
+	sort.Ints(types)
+
+	metricList := []struct {
+		name  string
+		typ   string
+		help  string
+		value func(*endPointSnapshot) uint64
+	}{
+		{"getty_sessions", "gauge", "Number of active sessions.",
+			func(s *endPointSnapshot) uint64 { return uint64(s.sessions) }},
+		{"getty_read_bytes_total", "counter", "Bytes read from network.",
+			func(s *endPointSnapshot) uint64 { return s.readBytes }},
+		{"getty_write_bytes_total", "counter", "Bytes written into network.",
+			func(s *endPointSnapshot) uint64 { return s.writeBytes }},
+		{"getty_read_pkgs_total", "counter", "Packages read from network.",
+			func(s *endPointSnapshot) uint64 { return s.readPkgNum }},
+		{"getty_write_pkgs_total", "counter", "Packages written into network.",
+			func(s *endPointSnapshot) uint64 { return s.writePkgNum }},
+		{"getty_read_queue_length", "gauge", "Packages waiting in the read queues.",
+			func(s *endPointSnapshot) uint64 { return uint64(s.rQLen) }},
+		{"getty_write_queue_length", "gauge", "Packages waiting in the write queues.",
+			func(s *endPointSnapshot) uint64 { return uint64(s.wQLen) }},
+		{"getty_pool_queue_length", "gauge", "Packages waiting for a worker of the session pools.",
+			func(s *endPointSnapshot) uint64 { return uint64(s.poolQLen) }},
+		{"getty_pool_schedule_timeouts_total", "counter", "Packages dropped because the session pools were full.",
+			func(s *endPointSnapshot) uint64 { return s.scheduleTimeouts }},
+		{"getty_session_blocked_total", "counter", "Write attempts failed with ErrSessionBlocked.",
+			func(s *endPointSnapshot) uint64 { return s.blockedWrites }},
+	}
+
+	for _, metric := range metricList {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", metric.name, metric.help, metric.name, metric.typ); err != nil {
+			return err
+		}
+		for _, t := range types {
+			if _, err := fmt.Fprintf(w, "%s{endpoint=\"%s\"} %d\n",
+				metric.name, EndPointType(t), metric.value(snapshots[EndPointType(t)])); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,51 @@
+/******************************************************
+# DESC       : tests of session metrics
+# MAINTAINER : Alex Stocks
+# LICENCE    : Apache License 2.0
+# EMAIL      : alexstocks@foxmail.com
+# MOD        : 2026-10-19 21:30
+# FILE       : metrics_test.go
+******************************************************/
+
+package getty
+
+import (
+	"math"
+	"net"
+	"testing"
+)
+
+func TestSessionCountersDoNotWrap(t *testing.T) {
+	local, peer := net.Pipe()
+	defer local.Close()
+	defer peer.Close()
+	s := newTCPSession(local, NewTCPServer(WithLocalAddress("127.0.0.1:0"))).(*session)
+	tc := s.Connection.(*gettyTCPConn)
+	tc.readBytes, tc.readPkgNum = math.MaxUint32, math.MaxUint32
+
+	go peer.Write([]byte("ab"))
+	buf := make([]byte, 2)
+	if n, err := tc.read(buf); n != 2 || err != nil {
+		t.Fatalf("read() = (%d, error{%v}), want 2", n, err)
+	}
+	tc.incReadPkgNum()
+	const (
+		wantBytes = uint64(math.MaxUint32) + 2
+		wantPkgs  = uint64(math.MaxUint32) + 1
+	)
+	if stat := s.Statistic(); stat.ReadBytes != wantBytes || stat.ReadPkgNum != wantPkgs {
+		t.Errorf("Statistic() = {read bytes:%d, read pkgs:%d}, want {%d, %d}",
+			stat.ReadBytes, stat.ReadPkgNum, wantBytes, wantPkgs)
+	}
+
+	m := newSessionMetrics()
+	m.addSession(s)
+	if ss := m.snapshot()[TCP_SERVER]; ss == nil || ss.readBytes != wantBytes || ss.readPkgNum != wantPkgs {
+		t.Errorf("snapshot() of the active session = %+v, want {read bytes:%d, read pkgs:%d}", ss, wantBytes, wantPkgs)
+	}
+	// the counters of the closed session are accumulated
+	m.removeSession(s)
+	if ss := m.snapshot()[TCP_SERVER]; ss == nil || ss.sessions != 0 || ss.readBytes != wantBytes || ss.readPkgNum != wantPkgs {
+		t.Errorf("snapshot() of the closed session = %+v, want {read bytes:%d, read pkgs:%d}", ss, wantBytes, wantPkgs)
+	}
+}
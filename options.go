@@ -10,6 +10,10 @@
 
 package getty
 
+import (
+	"crypto/tls"
+)
+
 /////////////////////////////////////////
 // Server Options
 /////////////////////////////////////////
@@ -24,6 +28,10 @@ type ServerOptions struct {
 	cert       string
 	privateKey string
 	caCert     string
+
+	// tcp tls
+	tlsConfig *tls.Config
+	tlsOpts   tlsOptions
 }
 
 // @addr server listen address.
@@ -61,6 +69,45 @@ func WithWebsocketServerRootCert(cert string) ServerOption {
 	}
 }
 
+// @config is the tls config of tcp server. The tcp server accepts tls connections if it is not nil.
+// It is the base config of NewTCPTLSServer, whose WithServerTLS* options override its settings.
+// It is also the tls config of NewWSSServer instead of the WithWebsocketServer* certificate files.
+func WithServerTLSConfig(config *tls.Config) ServerOption {
+	return func(o *ServerOptions) {
+		o.tlsConfig = config
+	}
+}
+
+// @cert & @key: certificate file & private key file of tcp tls server. Pls set it several
+// times if the server has several certificates, which are selected by the SNI of the clients.
+func WithServerTLSCertFile(cert, key string) ServerOption {
+	return func(o *ServerOptions) {
+		o.tlsOpts.certFiles = append(o.tlsOpts.certFiles, tlsCertFile{cert: cert, key: key})
+	}
+}
+
+// @caFile is the CA certificate file to verify the client certificates of tcp tls server.
+// The server requires the client certificates in mutual tls if it is set.
+func WithServerTLSClientCAFile(caFile string) ServerOption {
+	return func(o *ServerOptions) {
+		o.tlsOpts.caFile = caFile
+	}
+}
+
+// @version: the minimum tls version of tcp tls server, e.g. tls.VersionTLS13. Its default value is tls.VersionTLS12.
+func WithServerTLSMinVersion(version uint16) ServerOption {
+	return func(o *ServerOptions) {
+		o.tlsOpts.minVersion = version
+	}
+}
+
+// @suites: the cipher suites of tcp tls server below tls 1.3, e.g. tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256.
+func WithServerTLSCipherSuites(suites ...uint16) ServerOption {
+	return func(o *ServerOptions) {
+		o.tlsOpts.cipherSuites = suites
+	}
+}
+
 /////////////////////////////////////////
 // Client Options
 /////////////////////////////////////////
@@ -75,6 +122,10 @@ type ClientOptions struct {
 	// duration, the hash alg, the len of the private key.
 	// wss client will use it.
 	cert string
+
+	// tcp tls
+	tlsConfig *tls.Config
+	tlsOpts   tlsOptions
 }
 
 // @addr is server address.
@@ -97,3 +148,49 @@ func WithRootCertificateFile(cert string) ClientOption {
 		o.cert = cert
 	}
 }
+
+// @config is the tls config of tcp client. The tcp client dials tls connections if it is not nil.
+// It is the base config of NewTCPTLSClient, whose WithClientTLS* options override its settings.
+// It is also the tls config of NewWSSClient instead of WithRootCertificateFile.
+func WithClientTLSConfig(config *tls.Config) ClientOption {
+	return func(o *ClientOptions) {
+		o.tlsConfig = config
+	}
+}
+
+// @cert & @key: certificate file & private key file of tcp tls client in mutual tls.
+func WithClientTLSCertFile(cert, key string) ClientOption {
+	return func(o *ClientOptions) {
+		o.tlsOpts.certFiles = append(o.tlsOpts.certFiles, tlsCertFile{cert: cert, key: key})
+	}
+}
+
+// @caFile is the CA certificate file to verify the server certificate of tcp tls client.
+// The system CA pool is used if it is empty.
+func WithClientTLSRootCAFile(caFile string) ClientOption {
+	return func(o *ClientOptions) {
+		o.tlsOpts.caFile = caFile
+	}
+}
+
+// @name: the server name(SNI) of tcp tls client, which is also used to verify the server
+// certificate. Its default value is the host of the server address.
+func WithClientTLSServerName(name string) ClientOption {
+	return func(o *ClientOptions) {
+		o.tlsOpts.serverName = name
+	}
+}
+
+// @version: the minimum tls version of tcp tls client, e.g. tls.VersionTLS13. Its default value is tls.VersionTLS12.
+func WithClientTLSMinVersion(version uint16) ClientOption {
+	return func(o *ClientOptions) {
+		o.tlsOpts.minVersion = version
+	}
+}
+
+// @suites: the cipher suites of tcp tls client below tls 1.3, e.g. tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256.
+func WithClientTLSCipherSuites(suites ...uint16) ClientOption {
+	return func(o *ClientOptions) {
+		o.tlsOpts.cipherSuites = suites
+	}
+}
@@ -0,0 +1,226 @@
+package rpc
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"sort"
+	"strconv"
+	"time"
+)
+
+import (
+	"github.com/AlexStocks/getty"
+	log "github.com/AlexStocks/log4go"
+	jerrors "github.com/juju/errors"
+)
+
+////////////////////////////////////////////
+// admin http server
+////////////////////////////////////////////
+
+type MethodInfo struct {
+	Name      string `json:"name"`
+	ArgType   string `json:"arg_type"`
+	ReplyType string `json:"reply_type"`
+}
+
+type ServiceInfo struct {
+	Name    string       `json:"name"`
+	Service string       `json:"service"`
+	Version string       `json:"version"`
+	Methods []MethodInfo `json:"methods"`
+}
+
+type SessionInfo struct {
+	EndPoint   string                 `json:"end_point"`
+	LocalAddr  string                 `json:"local_addr"`
+	RemoteAddr string                 `json:"remote_addr"`
+	Stat       string                 `json:"stat"`
+	ReqNum     int32                  `json:"req_num"`
+	Active     time.Time              `json:"active"`
+	Statistic  getty.SessionStatistic `json:"statistic"`
+	Principal  *Principal             `json:"principal,omitempty"`
+	Unhealthy  bool                   `json:"unhealthy,omitempty"`
+	// heartbeat round trip times of the client session in nanoseconds
+	RTT              time.Duration `json:"rtt,omitempty"`
+	SRTT             time.Duration `json:"srtt,omitempty"`
+	MissedHeartbeats int           `json:"missed_heartbeats,omitempty"`
+}
+
+func newSessionInfo(s *rpcSession) SessionInfo {
+	info := SessionInfo{
+		EndPoint:         s.session.EndPoint().EndPointType().String(),
+		LocalAddr:        s.session.LocalAddr(),
+		RemoteAddr:       s.session.RemoteAddr(),
+		Stat:             s.session.Stat(),
+		ReqNum:           s.reqNum,
+		Active:           s.session.GetActive(),
+		Principal:        s.principal,
+		Unhealthy:        s.unhealthy,
+		RTT:              s.rtt,
+		SRTT:             s.srtt,
+		MissedHeartbeats: s.missed,
+	}
+	if st, ok := s.session.(getty.Statistician); ok {
+		info.Statistic = st.Statistic()
+	}
+
+	return info
+}
+
+func newAdminMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/metrics", getty.MetricsHandler())
+
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Warn("json.Encode(%#v) = error{%s}", v, err)
+	}
+}
+
+// startAdminServer serves pprof and other debug handlers of @mux on @host:@port.
+// It returns nil if @port is not greater than 0.
+func startAdminServer(host string, port int, mux *http.ServeMux) *http.Server {
+	if port <= 0 {
+		return nil
+	}
+	if host == "" {
+		host = "127.0.0.1"
+	}
+
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Error("failed to start admin server: %s", jerrors.ErrorStack(jerrors.Annotatef(err, "net.Listen(tcp, %s)", addr)))
+		return nil
+	}
+
+	server := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Error("admin server{%s}.Serve() = error{%s}", addr, err)
+		}
+	}()
+	log.Info("admin server listens on %s", addr)
+
+	return server
+}
+
+func stopAdminServer(server *http.Server) {
+	if server == nil {
+		return
+	}
+	if err := server.Close(); err != nil {
+		log.Warn("admin server{%s}.Close() = error{%s}", server.Addr, err)
+	}
+}
+
+////////////////////////////////////////////
+// server admin handlers
+////////////////////////////////////////////
+
+func (s *Server) serviceInfos() []ServiceInfo {
+	services := s.serviceList()
+	infos := make([]ServiceInfo, 0, len(services))
+	for _, svc := range services {
+		info := ServiceInfo{Name: svc.name}
+		if rcvr, ok := svc.rcvr.Interface().(GettyRPCService); ok {
+			info.Service = rcvr.Service()
+			info.Version = rcvr.Version()
+		}
+		for mname, mtype := range svc.method {
+			info.Methods = append(info.Methods, MethodInfo{
+				Name:      mname,
+				ArgType:   mtype.ArgType.String(),
+				ReplyType: mtype.ReplyType.String(),
+			})
+		}
+		sort.Slice(info.Methods, func(i, j int) bool { return info.Methods[i].Name < info.Methods[j].Name })
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+
+	return infos
+}
+
+func (s *Server) adminMux() *http.ServeMux {
+	mux := newAdminMux()
+	mux.HandleFunc("/debug/services", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, s.serviceInfos())
+	})
+	mux.HandleFunc("/debug/sessions", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, s.handler.sessionInfos())
+	})
+	mux.HandleFunc("/debug/ratelimit", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, s.RateLimitStats())
+	})
+	mux.HandleFunc("/health", s.healthHandler)
+	mux.HandleFunc("/debug/server", func(w http.ResponseWriter, r *http.Request) {
+		conf := s.config()
+		writeJSON(w, map[string]interface{}{
+			"app_name":      conf.AppName,
+			"version":       getty.Version,
+			"host":          conf.Host,
+			"ports":         conf.Ports,
+			"session_num":   s.handler.sessionNum(),
+			"inflight":      s.InflightNum(),
+			"draining":      s.IsDraining(),
+			"service_count": len(s.serviceList()),
+		})
+	})
+
+	return mux
+}
+
+////////////////////////////////////////////
+// client admin handlers
+////////////////////////////////////////////
+
+func (c *Client) sessionInfos() []SessionInfo {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	infos := make([]SessionInfo, 0, len(c.sessions))
+	for _, s := range c.sessions {
+		infos = append(infos, newSessionInfo(s))
+	}
+
+	return infos
+}
+
+func (c *Client) adminMux() *http.ServeMux {
+	mux := newAdminMux()
+	mux.HandleFunc("/debug/sessions", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, c.sessionInfos())
+	})
+	mux.HandleFunc("/debug/pending", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{
+			"pending_responses": c.PendingResponseCount(),
+		})
+	})
+	mux.HandleFunc("/debug/client", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{
+			"app_name":          c.conf.AppName,
+			"version":           getty.Version,
+			"server":            net.JoinHostPort(c.conf.ServerHost, strconv.Itoa(c.conf.ServerPort)),
+			"connection_num":    c.conf.ConnectionNum,
+			"session_num":       len(c.sessionInfos()),
+			"pending_responses": c.PendingResponseCount(),
+		})
+	})
+
+	return mux
+}
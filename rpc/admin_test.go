@@ -0,0 +1,34 @@
+package rpc
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestAdminServerOptIn(t *testing.T) {
+	port := freePort(t)
+	server, _ := newTestServer(t, WithServerProfilePort(port))
+	if server.admin != nil {
+		t.Fatalf("admin server{%s} is started without EnableAdmin", server.admin.Addr)
+	}
+
+	port = freePort(t)
+	server, _ = newTestServer(t, WithServerAdmin("", port))
+	if server.admin == nil {
+		t.Fatalf("admin server is not started with EnableAdmin")
+	}
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	if server.admin.Addr != addr {
+		t.Fatalf("admin server address = %s, want loopback address %s", server.admin.Addr, addr)
+	}
+	rsp, err := http.Get("http://" + addr + "/debug/services")
+	if err != nil {
+		t.Fatalf("http.Get(/debug/services) = error{%v}", err)
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		t.Fatalf("http.Get(/debug/services) status = %d", rsp.StatusCode)
+	}
+}
@@ -0,0 +1,326 @@
+package rpc
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"strconv"
+	"sync"
+	"time"
+)
+
+import (
+	"github.com/AlexStocks/getty"
+	jerrors "github.com/juju/errors"
+)
+
+const (
+	AuthTypeNone  = "none"
+	AuthTypeToken = "token"
+	AuthTypeHMAC  = "hmac"
+	AuthTypeTLS   = "tls"
+
+	// request metadata keys of the auth handshake frame
+	AuthTypeKey      = "auth-type"
+	AuthTokenKey     = "auth-token"
+	AuthKeyIDKey     = "auth-key-id"
+	AuthTimestampKey = "auth-timestamp"
+	AuthNonceKey     = "auth-nonce"
+	AuthSignatureKey = "auth-signature"
+
+	// session attribute key of the *Principal of an authenticated server session
+	PrincipalAttrKey = "rpc-principal"
+
+	defaultAuthTimeout  = 5 * time.Second
+	defaultMaxClockSkew = 5 * time.Minute
+)
+
+var (
+	ErrUnauthenticated = jerrors.New("unauthenticated")
+	ErrIllegalAuthType = jerrors.New("illegal auth type")
+)
+
+////////////////////////////////////////////
+// Authenticator
+////////////////////////////////////////////
+
+// Principal is the identity of the client of an authenticated session.
+type Principal struct {
+	Name     string `json:"name"`
+	AuthType string `json:"auth_type"`
+}
+
+// Credentials is what the client presents in its auth handshake frame.
+type Credentials struct {
+	Meta       map[string]string
+	RemoteAddr string
+	// nil if the session does not use tls
+	TLS *tls.ConnectionState
+}
+
+// Authenticator validates the credentials of a new session on the server side.
+// It must be goroutine-safe.
+type Authenticator interface {
+	Authenticate(cred *Credentials) (*Principal, error)
+}
+
+func checkAuthType(cred *Credentials, authType string) error {
+	if t := cred.Meta[AuthTypeKey]; t != authType {
+		return jerrors.Annotatef(ErrUnauthenticated, "auth type{%s} is not %s", t, authType)
+	}
+
+	return nil
+}
+
+// TokenAuthenticator accepts the clients which present a known bearer token.
+type TokenAuthenticator struct {
+	tokens map[string]string // token -> principal name
+}
+
+// NewTokenAuthenticator returns an authenticator whose @tokens maps tokens to principal names.
+func NewTokenAuthenticator(tokens map[string]string) *TokenAuthenticator {
+	a := &TokenAuthenticator{tokens: make(map[string]string, len(tokens))}
+	for token, name := range tokens {
+		a.tokens[token] = name
+	}
+
+	return a
+}
+
+func (a *TokenAuthenticator) Authenticate(cred *Credentials) (*Principal, error) {
+	if err := checkAuthType(cred, AuthTypeToken); err != nil {
+		return nil, err
+	}
+	name, ok := a.tokens[cred.Meta[AuthTokenKey]]
+	if !ok {
+		return nil, jerrors.Annotate(ErrUnauthenticated, "unknown token")
+	}
+
+	return &Principal{Name: name, AuthType: AuthTypeToken}, nil
+}
+
+// HMACAuthenticator accepts the clients which sign "key id\ntimestamp\nnonce" by the
+// HMAC-SHA256 of a shared secret. The timestamp must be within the max clock skew,
+// and a nonce can not be used twice in that window.
+type HMACAuthenticator struct {
+	secrets map[string]string // key id -> secret, and key id is the principal name
+	maxSkew time.Duration
+
+	lock   sync.Mutex
+	nonces map[string]struct{}
+	// used nonces in the order of their arrival, which is also the order of their expiration
+	nonceQueue []usedNonce
+}
+
+type usedNonce struct {
+	nonce  string
+	expire time.Time
+}
+
+// NewHMACAuthenticator returns an authenticator whose @secrets maps key ids to secrets.
+func NewHMACAuthenticator(secrets map[string]string, maxSkew time.Duration) *HMACAuthenticator {
+	a := &HMACAuthenticator{
+		secrets: make(map[string]string, len(secrets)),
+		maxSkew: maxSkew,
+		nonces:  make(map[string]struct{}),
+	}
+	for keyID, secret := range secrets {
+		a.secrets[keyID] = secret
+	}
+
+	return a
+}
+
+func (a *HMACAuthenticator) Authenticate(cred *Credentials) (*Principal, error) {
+	if err := checkAuthType(cred, AuthTypeHMAC); err != nil {
+		return nil, err
+	}
+	keyID := cred.Meta[AuthKeyIDKey]
+	secret, ok := a.secrets[keyID]
+	if !ok {
+		return nil, jerrors.Annotatef(ErrUnauthenticated, "unknown key id{%s}", keyID)
+	}
+	sec, err := strconv.ParseInt(cred.Meta[AuthTimestampKey], 10, 64)
+	if err != nil {
+		return nil, jerrors.Annotatef(ErrUnauthenticated, "illegal timestamp{%s}", cred.Meta[AuthTimestampKey])
+	}
+	now := time.Now()
+	ts := time.Unix(sec, 0)
+	if ts.Before(now.Add(-a.maxSkew)) || ts.After(now.Add(a.maxSkew)) {
+		return nil, jerrors.Annotatef(ErrUnauthenticated, "timestamp{%s} is out of the clock skew", ts)
+	}
+	nonce := cred.Meta[AuthNonceKey]
+	if nonce == "" {
+		return nil, jerrors.Annotate(ErrUnauthenticated, "empty nonce")
+	}
+	signature, err := hex.DecodeString(cred.Meta[AuthSignatureKey])
+	if err != nil || !hmac.Equal(signature, hmacSign(secret, keyID, cred.Meta[AuthTimestampKey], nonce)) {
+		return nil, jerrors.Annotate(ErrUnauthenticated, "illegal signature")
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.expireNonces(now)
+	if _, ok := a.nonces[nonce]; ok {
+		return nil, jerrors.Annotatef(ErrUnauthenticated, "replayed nonce{%s}", nonce)
+	}
+	// the timestamp @ts is not after now + maxSkew, so that it falls out of the clock skew
+	// window before now + 2 * maxSkew. Expiring nonces by their arrival time keeps the queue
+	// sorted while a nonce is never forgotten before its timestamp is rejected.
+	a.nonces[nonce] = struct{}{}
+	a.nonceQueue = append(a.nonceQueue, usedNonce{nonce: nonce, expire: now.Add(2 * a.maxSkew)})
+
+	return &Principal{Name: keyID, AuthType: AuthTypeHMAC}, nil
+}
+
+// expireNonces forgets the nonces which have expired at @now. It is invoked under the lock.
+func (a *HMACAuthenticator) expireNonces(now time.Time) {
+	var i int
+	for i < len(a.nonceQueue) && a.nonceQueue[i].expire.Before(now) {
+		delete(a.nonces, a.nonceQueue[i].nonce)
+		a.nonceQueue[i] = usedNonce{}
+		i++
+	}
+	// the array of the expired head is released when append reallocates the queue
+	a.nonceQueue = a.nonceQueue[i:]
+}
+
+func hmacSign(secret, keyID, timestamp, nonce string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(keyID + "\n" + timestamp + "\n" + nonce))
+	return mac.Sum(nil)
+}
+
+// TLSAuthenticator accepts the clients which present a certificate verified by the server
+// in mutual tls, whose principal name is the common name of the certificate subject.
+// Pls set TLS.ClientAuth of the server to "require-and-verify".
+type TLSAuthenticator struct{}
+
+func NewTLSAuthenticator() *TLSAuthenticator {
+	return &TLSAuthenticator{}
+}
+
+func (a *TLSAuthenticator) Authenticate(cred *Credentials) (*Principal, error) {
+	if err := checkAuthType(cred, AuthTypeTLS); err != nil {
+		return nil, err
+	}
+	if cred.TLS == nil || len(cred.TLS.VerifiedChains) == 0 || len(cred.TLS.VerifiedChains[0]) == 0 {
+		return nil, jerrors.Annotate(ErrUnauthenticated, "no verified client certificate")
+	}
+
+	return &Principal{Name: cred.TLS.VerifiedChains[0][0].Subject.CommonName, AuthType: AuthTypeTLS}, nil
+}
+
+// newAuthenticator builds the authenticator of @conf. It returns nil if @conf.Type is none.
+func newAuthenticator(conf AuthConfig) (Authenticator, error) {
+	switch conf.Type {
+	case "", AuthTypeNone:
+		return nil, nil
+	case AuthTypeToken:
+		if len(conf.Tokens) == 0 {
+			return nil, jerrors.New("token authenticator needs Auth.Tokens")
+		}
+		return NewTokenAuthenticator(conf.Tokens), nil
+	case AuthTypeHMAC:
+		if len(conf.Secrets) == 0 {
+			return nil, jerrors.New("hmac authenticator needs Auth.Secrets")
+		}
+		maxSkew := defaultMaxClockSkew
+		if conf.MaxClockSkew != "" {
+			var err error
+			if maxSkew, err = time.ParseDuration(conf.MaxClockSkew); err != nil {
+				return nil, jerrors.Annotatef(err, "time.ParseDuration(MaxClockSkew{%#v})", conf.MaxClockSkew)
+			}
+		}
+		return NewHMACAuthenticator(conf.Secrets, maxSkew), nil
+	case AuthTypeTLS:
+		return NewTLSAuthenticator(), nil
+	}
+
+	return nil, jerrors.Annotatef(ErrIllegalAuthType, "auth type{%s}", conf.Type)
+}
+
+type principalContextKey struct{}
+
+// PrincipalFromContext returns the principal of the session which sends the request
+// handled by the service method of @ctx, or nil if the server has no authenticator.
+func PrincipalFromContext(ctx context.Context) *Principal {
+	if ctx == nil {
+		return nil
+	}
+	principal, _ := ctx.Value(principalContextKey{}).(*Principal)
+
+	return principal
+}
+
+// SessionPrincipal returns the principal stored in the attributes of the server session @session.
+func SessionPrincipal(session getty.Session) *Principal {
+	principal, _ := session.GetAttribute(PrincipalAttrKey).(*Principal)
+	return principal
+}
+
+////////////////////////////////////////////
+// Credentials
+////////////////////////////////////////////
+
+// CredentialsFunc returns the request metadata of the auth handshake frame of a new client session.
+// It is invoked once per session, so that it can generate fresh signatures.
+type CredentialsFunc func() (map[string]string, error)
+
+// TokenCredentials presents the bearer token @token.
+func TokenCredentials(token string) CredentialsFunc {
+	return func() (map[string]string, error) {
+		return map[string]string{AuthTypeKey: AuthTypeToken, AuthTokenKey: token}, nil
+	}
+}
+
+// HMACCredentials signs the handshake frame by @secret, whose key id is @keyID.
+func HMACCredentials(keyID, secret string) CredentialsFunc {
+	return func() (map[string]string, error) {
+		var nonce [16]byte
+		if _, err := rand.Read(nonce[:]); err != nil {
+			return nil, jerrors.Trace(err)
+		}
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		n := hex.EncodeToString(nonce[:])
+		return map[string]string{
+			AuthTypeKey:      AuthTypeHMAC,
+			AuthKeyIDKey:     keyID,
+			AuthTimestampKey: timestamp,
+			AuthNonceKey:     n,
+			AuthSignatureKey: hex.EncodeToString(hmacSign(secret, keyID, timestamp, n)),
+		}, nil
+	}
+}
+
+// TLSCredentials presents the client certificate of mutual tls.
+func TLSCredentials() CredentialsFunc {
+	return func() (map[string]string, error) {
+		return map[string]string{AuthTypeKey: AuthTypeTLS}, nil
+	}
+}
+
+// newCredentials builds the credentials of @conf. It returns nil if @conf.Type is none.
+func newCredentials(conf AuthConfig) (CredentialsFunc, error) {
+	switch conf.Type {
+	case "", AuthTypeNone:
+		return nil, nil
+	case AuthTypeToken:
+		if conf.Token == "" {
+			return nil, jerrors.New("token credentials need Auth.Token")
+		}
+		return TokenCredentials(conf.Token), nil
+	case AuthTypeHMAC:
+		if conf.KeyID == "" || conf.Secret == "" {
+			return nil, jerrors.New("hmac credentials need both Auth.KeyID and Auth.Secret")
+		}
+		return HMACCredentials(conf.KeyID, conf.Secret), nil
+	case AuthTypeTLS:
+		return TLSCredentials(), nil
+	}
+
+	return nil, jerrors.Annotatef(ErrIllegalAuthType, "auth type{%s}", conf.Type)
+}
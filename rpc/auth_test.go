@@ -0,0 +1,63 @@
+package rpc
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenAuth(t *testing.T) {
+	_, port := newTestServer(t, WithServerAuth(AuthConfig{
+		Type:   "token",
+		Tokens: map[string]string{"secret": "alice"},
+	}))
+
+	t.Run("authenticated", func(t *testing.T) {
+		client := newTestClient(t, port, WithCredentials(TokenCredentials("secret")))
+		if err := waitReady(client); err != nil {
+			t.Fatalf("WaitReady() = error{%v}", err)
+		}
+		var sum int
+		if err := client.Call("Arith", "Add", 1, &sum); err != nil || sum != 2 {
+			t.Errorf("Arith.Add(1) = (%d, error{%v}), want 2", sum, err)
+		}
+	})
+	t.Run("unauthenticated", func(t *testing.T) {
+		client := newTestClient(t, port)
+		if err := waitReady(client); err != nil {
+			t.Fatalf("WaitReady() = error{%v}", err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		var sum int
+		err := client.CallWithContext(ctx, "Arith", "Add", 1, &sum)
+		if err == nil || !strings.Contains(err.Error(), "not authenticated") {
+			t.Errorf("Arith.Add(1) of unauthenticated session = error{%v}, want not authenticated", err)
+		}
+	})
+}
+
+func TestHMACAuthNonce(t *testing.T) {
+	a := NewHMACAuthenticator(map[string]string{"alice": "secret"}, 5*time.Second)
+	meta, err := HMACCredentials("alice", "secret")()
+	if err != nil {
+		t.Fatalf("HMACCredentials() = error{%v}", err)
+	}
+	cred := &Credentials{Meta: meta}
+	if principal, err := a.Authenticate(cred); err != nil || principal.Name != "alice" {
+		t.Fatalf("Authenticate() = (%+v, error{%v}), want alice", principal, err)
+	}
+	if _, err := a.Authenticate(cred); err == nil || !strings.Contains(err.Error(), "replayed nonce") {
+		t.Fatalf("Authenticate() of replayed nonce = error{%v}, want replayed nonce", err)
+	}
+
+	// the used nonces are forgotten after they have fallen out of the clock skew window
+	a.lock.Lock()
+	a.expireNonces(time.Now().Add(11 * time.Second))
+	n, queued := len(a.nonces), len(a.nonceQueue)
+	a.lock.Unlock()
+	if n != 0 || queued != 0 {
+		t.Errorf("nonce cache size = (%d, %d) after expiration, want 0", n, queued)
+	}
+}
@@ -0,0 +1,193 @@
+package rpc
+
+import (
+	"context"
+	"time"
+)
+
+import (
+	"github.com/AlexStocks/getty"
+	log "github.com/AlexStocks/log4go"
+	jerrors "github.com/juju/errors"
+)
+
+////////////////////////////////////////////
+// Batch
+////////////////////////////////////////////
+
+// BatchCall is a call of Batch. Its Error is set after Batch.Do returns.
+type BatchCall struct {
+	Service string
+	Method  string
+	Args    interface{}
+	Reply   interface{}
+	Error   error
+
+	opts CallOptions
+	req  *GettyRPCRequest
+	resp *PendingResponse
+	span *Span
+}
+
+// Batch collects several calls, which are sent to one server in one package by Do.
+// The server handles them by a few goroutines and responds them one by one. A Batch is not
+// safe for concurrent use, and it can be done only once.
+type Batch struct {
+	client  *Client
+	calls   []*BatchCall
+	session getty.Session // the session which sends the batch
+}
+
+// Batch returns an empty batch of @c.
+func (c *Client) Batch() *Batch {
+	return &Batch{client: c}
+}
+
+// Add appends the call of @service.@method to the batch. The context of WithCallContext
+// is the parent of the call span, and its deadline is sent as the timeout of the call.
+// Do stops waiting for the call when either the context or the one of Do is done.
+func (b *Batch) Add(service, method string, args interface{}, reply interface{}, opts ...CallOption) *BatchCall {
+	call := &BatchCall{
+		Service: service,
+		Method:  method,
+		Args:    args,
+		Reply:   reply,
+	}
+	for _, opt := range opts {
+		opt(&call.opts)
+	}
+	b.calls = append(b.calls, call)
+
+	return call
+}
+
+// Len returns the call number of the batch.
+func (b *Batch) Len() int {
+	return len(b.calls)
+}
+
+// Calls returns the calls of the batch in their added order.
+func (b *Batch) Calls() []*BatchCall {
+	return b.calls
+}
+
+// Do sends the calls in one package and waits for their responses until @ctx expires.
+// The error of every call is set to its Error, and Do returns the first one of them.
+// All the calls fail if the package is larger than the maximum package length 64KB,
+// so pls split large batches.
+func (b *Batch) Do(ctx context.Context) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if len(b.calls) == 0 {
+		return nil
+	}
+
+	c := b.client
+	start := time.Now()
+	batch := &GettyRPCBatchRequest{}
+	for _, call := range b.calls {
+		if call.opts.ctx == nil {
+			call.opts.ctx = ctx
+		}
+		req, err := c.newRequest(call.opts, call.Service, call.Method, call.Args, call.Reply)
+		if err != nil {
+			call.Error = jerrors.Trace(err)
+			continue
+		}
+		call.req = req
+		call.span = c.startSpan(call.opts.ctx, req)
+		call.resp = NewPendingResponse()
+		call.resp.reply = call.Reply
+		call.resp.seq = c.Sequence()
+		batch.add(call.resp.seq, req)
+	}
+
+	if len(batch.requests) != 0 {
+		if err := b.send(ctx, batch); err != nil {
+			for _, call := range b.calls {
+				if call.resp != nil {
+					call.Error = err
+					call.resp = nil
+				}
+			}
+		}
+	}
+
+	var err error
+	for _, call := range b.calls {
+		if call.resp != nil {
+			call.Error = b.wait(ctx, call)
+		}
+		if call.req != nil {
+			callMetrics.observe(clientSide, call.Service, call.Method, errorCode(call.Error), time.Since(start))
+		}
+		if call.span != nil {
+			call.span.finish(call.Error)
+		}
+		if err == nil && call.Error != nil {
+			err = call.Error
+		}
+	}
+
+	return jerrors.Trace(err)
+}
+
+// send writes the batch request frame of @batch, whose pending responses are removed if it fails.
+func (b *Batch) send(ctx context.Context, batch *GettyRPCBatchRequest) error {
+	c := b.client
+	session, err := c.pickSession(ctx)
+	if err != nil {
+		return jerrors.Trace(err)
+	}
+
+	var pkg GettyPackage
+	pkg.H.Magic = gettyPackageMagic
+	pkg.H.LogID = (uint32)(randomID())
+	pkg.H.Sequence = c.Sequence()
+	pkg.H.Command = gettyCmdBatchRequest
+	pkg.H.CodecType = c.codecType
+	pkg.B = batch
+	b.session = session
+	for _, call := range b.calls {
+		if call.resp != nil {
+			call.resp.session = session
+			c.AddPendingResponse(call.resp)
+		}
+	}
+	if err = session.WritePkg(pkg, 0); err != nil {
+		log.Warn("session{%s} write %d batch requests = error{%s}", session.Stat(), len(batch.requests), err)
+		for _, seq := range batch.sequences {
+			c.RemovePendingResponse(seq)
+		}
+		return jerrors.Trace(err)
+	}
+
+	return nil
+}
+
+// wait waits for the response of @call until @ctx or the context of @call expires, and cancels
+// the call if it expires.
+func (b *Batch) wait(ctx context.Context, call *BatchCall) error {
+	// the response which arrived before the call expired wins
+	select {
+	case <-call.resp.done:
+		return call.resp.err
+	default:
+	}
+
+	var err error
+	select {
+	case <-call.resp.done:
+		return call.resp.err
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-call.opts.ctx.Done():
+		err = call.opts.ctx.Err()
+	}
+	c := b.client
+	if c.RemovePendingResponse(call.resp.seq) != nil && call.req.header.CallType != gettyTwoWayNoReply {
+		c.cancel(b.session, call.resp.seq)
+	}
+	return jerrors.Trace(err)
+}
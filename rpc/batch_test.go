@@ -0,0 +1,142 @@
+package rpc
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+import (
+	jerrors "github.com/juju/errors"
+)
+
+// Gauge is the service which records the max number of its concurrent calls.
+type Gauge struct {
+	current int32
+	max     int32
+}
+
+func (g *Gauge) Service() string {
+	return "Gauge"
+}
+
+func (g *Gauge) Version() string {
+	return "v1"
+}
+
+// Hold replies @ms after holding the gauge @ms milliseconds.
+func (g *Gauge) Hold(ms int, r *int) error {
+	current := atomic.AddInt32(&g.current, 1)
+	for {
+		max := atomic.LoadInt32(&g.max)
+		if current <= max || atomic.CompareAndSwapInt32(&g.max, max, current) {
+			break
+		}
+	}
+	time.Sleep(time.Duration(ms) * time.Millisecond)
+	atomic.AddInt32(&g.current, -1)
+	*r = ms
+	return nil
+}
+
+func TestBatchBoundedWorkers(t *testing.T) {
+	// the batch package is larger than the default max message length
+	param := NewServerConfig().GettySessionParam
+	param.MaxMsgLen = 64 * 1024
+	server, port := newTestServer(t, WithServerSessionParam(param))
+	gauge := &Gauge{}
+	if err := server.Register(gauge); err != nil {
+		t.Fatalf("Register(Gauge) = error{%v}", err)
+	}
+	client := newTestClient(t, port)
+	if err := waitReady(client); err != nil {
+		t.Fatalf("WaitReady() = error{%v}", err)
+	}
+
+	batch := client.Batch()
+	replies := make([]int, 4*batchWorkers)
+	for i := range replies {
+		batch.Add("Gauge", "Hold", 20, &replies[i])
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := batch.Do(ctx); err != nil {
+		t.Fatalf("Batch.Do() = error{%v}", err)
+	}
+	for i, reply := range replies {
+		if reply != 20 {
+			t.Errorf("reply of call %d = %d, want 20", i, reply)
+		}
+	}
+	if max := atomic.LoadInt32(&gauge.max); max > batchWorkers {
+		t.Errorf("max concurrent batch calls = %d, want no more than %d", max, batchWorkers)
+	}
+}
+
+func TestBatchCallDeadline(t *testing.T) {
+	_, port := newTestServer(t)
+	client := newTestClient(t, port)
+	if err := waitReady(client); err != nil {
+		t.Fatalf("WaitReady() = error{%v}", err)
+	}
+
+	callCtx, callCancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer callCancel()
+	var slept, sum int
+	batch := client.Batch()
+	sleep := batch.Add("Arith", "Sleep", 2000, &slept, WithCallContext(callCtx))
+	add := batch.Add("Arith", "Add", 1, &sum)
+
+	start := time.Now()
+	batch.Do(context.Background())
+	if cost := time.Since(start); cost > time.Second {
+		t.Errorf("Batch.Do() costs %s, which ignores the deadline of the call", cost)
+	}
+	if err := sleep.Error; err == nil {
+		t.Errorf("Arith.Sleep(2000) with 100ms deadline succeeds")
+	}
+	if add.Error != nil || sum != 2 {
+		t.Errorf("Arith.Add(1) = (%d, error{%v}), want 2", sum, add.Error)
+	}
+}
+
+func TestBatchRoundTrip(t *testing.T) {
+	_, port := newTestServer(t)
+	client := newTestClient(t, port)
+	if err := waitReady(client); err != nil {
+		t.Fatalf("WaitReady() = error{%v}", err)
+	}
+
+	var sum, ms, bad int
+	batch := client.Batch()
+	add := batch.Add("Arith", "Add", 1, &sum)
+	sleep := batch.Add("Arith", "Sleep", 10, &ms)
+	notFound := batch.Add("NoSuchService", "Add", 1, &bad)
+	invalid := batch.Add("Arith", "Add", "one", &bad)
+	if batch.Len() != 4 || len(batch.Calls()) != 4 || batch.Calls()[2] != notFound {
+		t.Fatalf("batch calls = %d, want 4 in their added order", batch.Len())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := batch.Do(ctx)
+	if jerrors.Cause(err) != ErrNotFoundServiceOrMethod {
+		t.Errorf("Batch.Do() = error{%v}, want the first error ErrNotFoundServiceOrMethod", err)
+	}
+	if add.Error != nil || sum != 2 {
+		t.Errorf("Arith.Add(1) in batch = (%d, error{%v}), want 2", sum, add.Error)
+	}
+	if sleep.Error != nil || ms != 10 {
+		t.Errorf("Arith.Sleep(10) in batch = (%d, error{%v}), want 10", ms, sleep.Error)
+	}
+	if jerrors.Cause(notFound.Error) != ErrNotFoundServiceOrMethod {
+		t.Errorf("NoSuchService.Add(1) in batch = error{%v}, want ErrNotFoundServiceOrMethod", notFound.Error)
+	}
+	if jerrors.Cause(invalid.Error) != ErrInvalidArgument {
+		t.Errorf("Arith.Add(one) in batch = error{%v}, want ErrInvalidArgument", invalid.Error)
+	}
+	if n := client.PendingResponseCount(); n != 0 {
+		t.Errorf("pending response number after Batch.Do() = %d, want 0", n)
+	}
+}
@@ -1,9 +1,9 @@
 package rpc
 
 import (
-	"fmt"
+	"context"
 	"math/rand"
-	"net"
+	"net/http"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -15,7 +15,6 @@ import (
 
 import (
 	"github.com/AlexStocks/getty"
-	"github.com/AlexStocks/goext/net"
 	log "github.com/AlexStocks/log4go"
 )
 
@@ -23,6 +22,9 @@ var (
 	errInvalidAddress  = jerrors.New("remote address invalid or empty")
 	errSessionNotExist = jerrors.New("session not exist")
 	errClientClosed    = jerrors.New("client closed")
+
+	// ErrClientNotReady is returned if there is still no session to the server when the context expires.
+	ErrClientNotReady = jerrors.New("client not ready")
 )
 
 func init() {
@@ -35,67 +37,142 @@ type Client struct {
 	sessions    []*rpcSession
 	gettyClient getty.Client
 	codecType   SerializeType
+	admin       *http.Server
+	tracer      tracer
+	credentials CredentialsFunc
+	connectOnce sync.Once
+	ready       chan struct{} // closed when there is any healthy session
+	done        chan struct{} // closed by Close
 
 	sequence uint64
 
 	pendingLock      sync.RWMutex
 	pendingResponses map[uint64]*PendingResponse
+	// sequences of the pending responses by the sessions which send their requests
+	sessionPendings map[getty.Session]map[uint64]struct{}
 }
 
+// NewClient creates a client by the config file @confFile. It returns immediately and connects
+// to the server in background. Pls use WaitReady to wait for the connections.
+// It panics if @confFile is invalid. Pls use NewClientE to get the error instead.
 func NewClient(confFile string) *Client {
-	conf := loadClientConf(confFile)
+	c, err := NewClientE(confFile)
+	if err != nil {
+		panic(jerrors.ErrorStack(err))
+	}
+
+	return c
+}
+
+// NewClientE is the same as NewClient except that it returns the error instead of panic.
+func NewClientE(confFile string) (*Client, error) {
+	conf, err := loadClientConf(confFile)
+	if err != nil {
+		return nil, jerrors.Trace(err)
+	}
+
+	return NewClientWithConfig(conf)
+}
+
+// NewClientWithConfig creates a client by @conf, which is NewClientConfig() if it is nil,
+// and @opts. @conf will not be modified. It returns immediately as NewClient does. In lazy
+// connect mode, it does not connect to the server until the first call or WaitReady.
+func NewClientWithConfig(conf *ClientConfig, opts ...ClientOption) (*Client, error) {
+	if conf == nil {
+		conf = NewClientConfig()
+	}
+	cc := *conf
+	conf = &cc
+	for _, opt := range opts {
+		opt(conf)
+	}
+	if err := conf.CheckValidity(); err != nil {
+		return nil, jerrors.Trace(err)
+	}
+
 	c := &Client{
 		pendingResponses: make(map[uint64]*PendingResponse),
+		sessionPendings:  make(map[getty.Session]map[uint64]struct{}),
 		conf:             conf,
-		gettyClient: getty.NewTCPClient(
-			getty.WithServerAddress(gxnet.HostAddress(conf.ServerHost, conf.ServerPort)),
-			getty.WithConnectionNumber((int)(conf.ConnectionNum)),
-		),
-		codecType: JSON,
-	}
-	c.gettyClient.RunEventLoop(c.newSession)
-	idx := 1
+		gettyClient:      newGettyClient(conf),
+		codecType:        JSON,
+		ready:            make(chan struct{}),
+		done:             make(chan struct{}),
+	}
+	// @conf.Tracing has been checked in (ClientConfig)CheckValidity
+	exporter, _ := newSpanExporter(conf.Tracing)
+	c.tracer.setExporter(exporter)
+	c.credentials = conf.credentials
+	if c.credentials == nil {
+		// @conf.Auth has been checked in (ClientConfig)CheckValidity
+		c.credentials, _ = newCredentials(conf.Auth)
+	}
+	if !conf.LazyConnect {
+		c.connect()
+	}
+	if conf.EnableAdmin {
+		c.admin = startAdminServer(conf.AdminHost, conf.ProfilePort, c.adminMux())
+	}
+	log.Info("client init ok")
+
+	return c, nil
+}
+
+// connect starts the event loop of the getty client which connects to the server.
+func (c *Client) connect() {
+	c.connectOnce.Do(func() {
+		c.lock.RLock()
+		gettyClient := c.gettyClient
+		c.lock.RUnlock()
+		if gettyClient != nil {
+			gettyClient.RunEventLoop(c.newSession)
+		}
+	})
+}
+
+// WaitReady waits until there is any healthy session to the server. It returns ErrClientNotReady
+// if @ctx expires before that.
+func (c *Client) WaitReady(ctx context.Context) error {
+	_, err := c.waitSession(ctx)
+	return jerrors.Trace(err)
+}
+
+func (c *Client) waitSession(ctx context.Context) (getty.Session, error) {
+	c.connect()
 	for {
-		idx++
-		if c.isAvailable() {
-			break
+		if session := c.selectSession(); session != nil {
+			return session, nil
 		}
 
-		if idx > 12000 {
-			panic("failed to create client in 2 minutes")
+		c.lock.RLock()
+		ready := c.ready
+		c.lock.RUnlock()
+		select {
+		case <-ready:
+		case <-c.done:
+			return nil, errClientClosed
+		case <-ctx.Done():
+			return nil, jerrors.Annotate(ErrClientNotReady, ctx.Err().Error())
 		}
-		time.Sleep(1e6)
 	}
-	log.Info("client init ok")
-
-	return c
 }
 
 func (c *Client) SetCodecType(st SerializeType) {
 	c.codecType = st
 }
 
-func (c *Client) newSession(session getty.Session) error {
-	var (
-		ok      bool
-		tcpConn *net.TCPConn
-	)
+// SetSpanExporter sets the exporter of the client spans. Tracing is disabled if @exporter is nil,
+// except that the spans whose parents are passed by WithCallContext are still propagated.
+func (c *Client) SetSpanExporter(exporter SpanExporter) {
+	c.tracer.setExporter(exporter)
+}
 
+func (c *Client) newSession(session getty.Session) error {
 	if c.conf.GettySessionParam.CompressEncoding {
 		session.SetCompressType(getty.CompressZip)
 	}
 
-	if tcpConn, ok = session.Conn().(*net.TCPConn); !ok {
-		panic(fmt.Sprintf("%s, session.conn{%#v} is not tcp connection\n", session.Stat(), session.Conn()))
-	}
-
-	tcpConn.SetNoDelay(c.conf.GettySessionParam.TcpNoDelay)
-	tcpConn.SetKeepAlive(c.conf.GettySessionParam.TcpKeepAlive)
-	if c.conf.GettySessionParam.TcpKeepAlive {
-		tcpConn.SetKeepAlivePeriod(c.conf.GettySessionParam.keepAlivePeriod)
-	}
-	tcpConn.SetReadBuffer(c.conf.GettySessionParam.TcpRBufSize)
-	tcpConn.SetWriteBuffer(c.conf.GettySessionParam.TcpWBufSize)
+	setTCPParams(session.Conn(), &c.conf.GettySessionParam)
 
 	session.SetName(c.conf.GettySessionParam.SessionName)
 	session.SetMaxMsgLen(c.conf.GettySessionParam.MaxMsgLen)
@@ -116,7 +193,48 @@ func (c *Client) Sequence() uint64 {
 	return atomic.AddUint64(&c.sequence, 1)
 }
 
-func (c *Client) Call(service, method string, args interface{}, reply interface{}) error {
+// Call invokes @service.@method. In lazy connect mode, it waits for the first session
+// FailFastTimeout at most.
+func (c *Client) Call(service, method string, args interface{}, reply interface{}, opts ...CallOption) error {
+	return jerrors.Trace(c.invoke(nil, service, method, args, reply, opts...))
+}
+
+// CallWithContext invokes @service.@method and waits for its response until @ctx expires.
+// The span carried by @ctx will be the parent of the client span of the call. In lazy connect
+// mode, it waits for the first session until @ctx expires.
+func (c *Client) CallWithContext(ctx context.Context, service, method string, args interface{}, reply interface{}, opts ...CallOption) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	return jerrors.Trace(c.invoke(ctx, service, method, args, reply, opts...))
+}
+
+// invoke calls @service.@method without any deadline if @ctx is nil.
+func (c *Client) invoke(ctx context.Context, service, method string, args interface{}, reply interface{}, opts ...CallOption) error {
+	copts := CallOptions{ctx: ctx}
+	for _, opt := range opts {
+		opt(&copts)
+	}
+
+	b, err := c.newRequest(copts, service, method, args, reply)
+	if err != nil {
+		return jerrors.Trace(err)
+	}
+	span := c.startSpan(copts.ctx, b)
+
+	start := time.Now()
+	err = c.call(copts.ctx, b, reply)
+	callMetrics.observe(clientSide, service, method, errorCode(err), time.Since(start))
+	if span != nil {
+		span.finish(err)
+	}
+
+	return jerrors.Trace(err)
+}
+
+// newRequest returns the request of @service.@method, whose timeout is the deadline of @copts.ctx.
+func (c *Client) newRequest(copts CallOptions, service, method string, args interface{}, reply interface{}) (*GettyRPCRequest, error) {
 	b := &GettyRPCRequest{}
 	b.header.Service = service
 	b.header.Method = method
@@ -124,30 +242,90 @@ func (c *Client) Call(service, method string, args interface{}, reply interface{
 	if reply == nil {
 		b.header.CallType = gettyTwoWayNoReply
 	}
+	b.header.Meta = copts.meta
 	b.body = args
+	if copts.ctx != nil {
+		if deadline, ok := copts.ctx.Deadline(); ok {
+			timeout := time.Until(deadline)
+			if timeout <= 0 {
+				return nil, jerrors.Trace(context.DeadlineExceeded)
+			}
+			// round up, so that the server will not reject it before the client gives up
+			b.header.Timeout = int64((timeout + time.Millisecond - 1) / time.Millisecond)
+		}
+	}
 
-	resp := NewPendingResponse()
-	resp.reply = reply
+	return b, nil
+}
 
-	session := c.selectSession()
-	if session == nil {
-		return errSessionNotExist
+// startSpan starts the client span of @req, whose parent is the span carried by @ctx, and
+// injects its trace context into the request metadata. It returns nil if tracing is disabled.
+func (c *Client) startSpan(ctx context.Context, req *GettyRPCRequest) *Span {
+	var parent SpanContext
+	if span := SpanFromContext(ctx); span != nil {
+		parent = span.SpanContext
+	}
+	service, method := req.header.Service, req.header.Method
+	span := c.tracer.startSpan(methodKey(service, method), SpanKindClient, parent)
+	if span != nil {
+		span.SetAttribute("rpc.system", "getty")
+		span.SetAttribute("rpc.service", service)
+		span.SetAttribute("rpc.method", method)
+		if req.header.Meta == nil {
+			req.header.Meta = make(map[string]string, 2)
+		}
+		span.SpanContext.inject(req.header.Meta)
 	}
 
-	if err := c.transfer(session, b, resp); err != nil {
-		return jerrors.Trace(err)
+	return span
+}
+
+// pickSession selects a session for a call. In lazy connect mode, it waits for the first
+// session until @ctx expires, or FailFastTimeout at most if @ctx is nil.
+func (c *Client) pickSession(ctx context.Context) (getty.Session, error) {
+	session := c.selectSession()
+	if session != nil {
+		return session, nil
+	}
+	if !c.conf.LazyConnect {
+		return nil, errSessionNotExist
+	}
+	if ctx == nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.Background(), c.conf.failFastTimeout)
+		defer cancel()
 	}
-	<-resp.done
 
-	return jerrors.Trace(resp.err)
+	session, err := c.waitSession(ctx)
+	return session, jerrors.Trace(err)
 }
 
-func (c *Client) isAvailable() bool {
-	if c.selectSession() == nil {
-		return false
+func (c *Client) call(ctx context.Context, req *GettyRPCRequest, reply interface{}) error {
+	resp := NewPendingResponse()
+	resp.reply = reply
+
+	session, err := c.pickSession(ctx)
+	if err != nil {
+		return jerrors.Trace(err)
+	}
+
+	if err := c.transfer(session, req, resp); err != nil {
+		return jerrors.Trace(err)
+	}
+	if ctx == nil {
+		<-resp.done
+		return resp.err
 	}
 
-	return true
+	select {
+	case <-resp.done:
+		return resp.err
+	case <-ctx.Done():
+		if c.RemovePendingResponse(resp.seq) != nil && req.header.CallType != gettyTwoWayNoReply {
+			c.cancel(session, resp.seq)
+		}
+		return jerrors.Trace(ctx.Err())
+	}
 }
 
 func (c *Client) Close() {
@@ -161,8 +339,11 @@ func (c *Client) Close() {
 		c.gettyClient.Close()
 		c.gettyClient = nil
 		c.sessions = c.sessions[:0]
+		c.ready = make(chan struct{})
+		close(c.done)
 	}
 	c.lock.Unlock()
+	stopAdminServer(c.admin)
 }
 
 func (c *Client) selectSession() getty.Session {
@@ -177,7 +358,86 @@ func (c *Client) selectSession() getty.Session {
 	if count == 0 {
 		return nil
 	}
-	return c.sessions[rand.Int31n(int32(count))].session
+	// power of two choices: pick the one with lower heartbeat latency from two random
+	// healthy sessions. start from a random session and skip the unhealthy ones.
+	var chosen *rpcSession
+	idx := int(rand.Int31n(int32(count)))
+	for i, picked := 0, 0; i < count && picked < 2; i++ {
+		s := c.sessions[(idx+i)%count]
+		if s.unhealthy {
+			continue
+		}
+		if chosen == nil || s.latency() < chosen.latency() {
+			chosen = s
+		}
+		picked++
+		if left := count - 1 - i; picked == 1 && left > 1 {
+			// the second session is a random one of the sessions after the first
+			i += int(rand.Int31n(int32(left)))
+		}
+	}
+	if chosen == nil {
+		return nil
+	}
+
+	return chosen.session
+}
+
+// refreshReady closes @c.ready if there is any healthy session, or replaces it by a new
+// channel if there is none. Pls make sure that @c.lock has been locked.
+func (c *Client) refreshReady() {
+	healthy := false
+	for _, s := range c.sessions {
+		if !s.unhealthy {
+			healthy = true
+			break
+		}
+	}
+
+	select {
+	case <-c.ready:
+		if !healthy {
+			c.ready = make(chan struct{})
+		}
+	default:
+		if healthy {
+			close(c.ready)
+		}
+	}
+}
+
+// setSessionHealth takes @session out of rotation if @healthy is false, or puts it back.
+func (c *Client) setSessionHealth(session getty.Session, healthy bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, s := range c.sessions {
+		if s.session == session {
+			if s.unhealthy == healthy {
+				log.Info("session{%s} health changes to %t", session.Stat(), healthy)
+			}
+			s.unhealthy = !healthy
+			break
+		}
+	}
+	c.refreshReady()
+}
+
+// setHealthChecking marks the health check of @session in flight if @checking is true, or
+// finished. It returns false if the mark of @session is @checking already or @session has been removed.
+func (c *Client) setHealthChecking(session getty.Session, checking bool) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, s := range c.sessions {
+		if s.session == session {
+			if s.checking == checking {
+				return false
+			}
+			s.checking = checking
+			return true
+		}
+	}
+
+	return false
 }
 
 func (c *Client) addSession(session getty.Session) {
@@ -188,6 +448,7 @@ func (c *Client) addSession(session getty.Session) {
 
 	c.lock.Lock()
 	c.sessions = append(c.sessions, &rpcSession{session: session})
+	c.refreshReady()
 	c.lock.Unlock()
 }
 
@@ -206,6 +467,7 @@ func (c *Client) removeSession(session getty.Session) {
 		if s.session == session {
 			c.sessions = append(c.sessions[:i], c.sessions[i+1:]...)
 			log.Debug("delete session{%s}, its index{%d}", session.Stat(), i)
+			c.refreshReady()
 			break
 		}
 	}
@@ -253,9 +515,142 @@ func (c *Client) getClientRpcSession(session getty.Session) (rpcSession, error)
 	return rpcSession, jerrors.Trace(err)
 }
 
+// Ping sends a heartbeat to the server and returns its round trip time.
+func (c *Client) Ping(ctx context.Context) (time.Duration, error) {
+	session, err := c.waitSession(ctx)
+	if err != nil {
+		return 0, jerrors.Trace(err)
+	}
+
+	resp := NewPendingResponse()
+	start := time.Now()
+	if err = c.transfer(session, nil, resp); err != nil {
+		return 0, jerrors.Trace(err)
+	}
+	select {
+	case <-resp.done:
+		return time.Since(start), nil
+	case <-ctx.Done():
+		c.RemovePendingResponse(resp.seq)
+		return 0, jerrors.Trace(ctx.Err())
+	}
+}
+
+// Sessions returns the infos of the client sessions, including their heartbeat round trip times.
+func (c *Client) Sessions() []SessionInfo {
+	return c.sessionInfos()
+}
+
+// handshake sends the auth handshake frame which carries the credentials to the server.
+func (c *Client) handshake(session getty.Session) error {
+	meta, err := c.credentials()
+	if err != nil {
+		return jerrors.Annotatef(err, "session{%s} credentials", session.Stat())
+	}
+
+	var pkg GettyPackage
+	pkg.H.Magic = gettyPackageMagic
+	pkg.H.LogID = (uint32)(randomID())
+	pkg.H.Sequence = c.Sequence()
+	pkg.H.Command = gettyCmdAuthRequest
+	// the handshake frame has no body, which can not be encoded by protobuf
+	pkg.H.CodecType = JSON
+	pkg.B = &GettyRPCRequest{header: GettyRPCRequestHeader{Meta: meta}}
+
+	return jerrors.Trace(session.WritePkg(pkg, 5*time.Second))
+}
+
+// cancel sends the cancel frame of the request @seq, whose caller has given up waiting,
+// so that the server cancels the context of its service method.
+func (c *Client) cancel(session getty.Session, seq uint64) {
+	var pkg GettyPackage
+	pkg.H.Magic = gettyPackageMagic
+	pkg.H.LogID = (uint32)(randomID())
+	pkg.H.Sequence = seq
+	pkg.H.Command = gettyCmdCancel
+	// the cancel frame has no body, which can not be encoded by protobuf
+	pkg.H.CodecType = JSON
+	pkg.B = &GettyRPCRequest{}
+
+	if err := session.WritePkg(pkg, 0); err != nil {
+		log.Warn("session{%s} cancel request{sequence:%d} = error{%s}", session.Stat(), seq, jerrors.ErrorStack(err))
+	}
+}
+
+// heartbeat sends a heartbeat by @session. The previous heartbeat which has not been responded
+// in a heartbeat period is missed, and @session is closed after MaxMissedHeartbeats consecutive
+// missed heartbeats.
 func (c *Client) heartbeat(session getty.Session) error {
+	var (
+		s      *rpcSession
+		missed *PendingResponse
+	)
 	resp := NewPendingResponse()
-	return c.transfer(session, nil, resp)
+	c.lock.Lock()
+	for _, rs := range c.sessions {
+		if rs.session == session {
+			s = rs
+			break
+		}
+	}
+	if s == nil {
+		c.lock.Unlock()
+		return errSessionNotExist
+	}
+	if s.heartbeat != nil {
+		missed = s.heartbeat
+		s.missed++
+	}
+	missedNum := s.missed
+	s.heartbeat = resp
+	s.heartbeatSent = time.Now()
+	c.lock.Unlock()
+
+	if missed != nil {
+		c.RemovePendingResponse(missed.seq)
+		log.Warn("session{%s} missed %d heartbeats", session.Stat(), missedNum)
+		if c.conf.MaxMissedHeartbeats > 0 && missedNum >= c.conf.MaxMissedHeartbeats {
+			log.Warn("session{%s} missed too many heartbeats, will be closed.", session.Stat())
+			c.removeSession(session)
+			session.Close()
+			return jerrors.Errorf("session{%s} missed %d heartbeats", session.Stat(), missedNum)
+		}
+	}
+
+	err := c.transfer(session, nil, resp)
+	if err != nil {
+		c.lock.Lock()
+		if s.heartbeat == resp {
+			s.heartbeat = nil
+		}
+		c.lock.Unlock()
+	}
+	return jerrors.Trace(err)
+}
+
+// heartbeatResponded updates the round trip times of @session by the heartbeat response of @resp.
+// The responses of Ping are not sampled.
+func (c *Client) heartbeatResponded(session getty.Session, resp *PendingResponse) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, s := range c.sessions {
+		if s.session == session {
+			if s.heartbeat != resp {
+				return
+			}
+			s.heartbeat = nil
+			s.missed = 0
+			s.rtt = time.Since(s.heartbeatSent)
+			// the smoothed round trip time of tcp(rfc 6298)
+			if s.srtt == 0 {
+				s.srtt = s.rtt
+			} else {
+				s.srtt = s.srtt - s.srtt/8 + s.rtt/8
+			}
+			log.Debug("session{%s} heartbeat rtt{%s}, srtt{%s}", session.Stat(), s.rtt, s.srtt)
+			return
+		}
+	}
 }
 
 func (c *Client) transfer(session getty.Session, req *GettyRPCRequest, resp *PendingResponse) error {
@@ -277,6 +672,7 @@ func (c *Client) transfer(session getty.Session, req *GettyRPCRequest, resp *Pen
 	}
 
 	resp.seq = sequence
+	resp.session = session
 	c.AddPendingResponse(resp)
 
 	err = session.WritePkg(pkg, 0)
@@ -296,6 +692,14 @@ func (c *Client) AddPendingResponse(pr *PendingResponse) {
 	c.pendingLock.Lock()
 	defer c.pendingLock.Unlock()
 	c.pendingResponses[pr.seq] = pr
+	if pr.session != nil {
+		seqs := c.sessionPendings[pr.session]
+		if seqs == nil {
+			seqs = make(map[uint64]struct{})
+			c.sessionPendings[pr.session] = seqs
+		}
+		seqs[pr.seq] = struct{}{}
+	}
 }
 
 func (c *Client) RemovePendingResponse(seq uint64) *PendingResponse {
@@ -306,6 +710,12 @@ func (c *Client) RemovePendingResponse(seq uint64) *PendingResponse {
 	}
 	if presp, ok := c.pendingResponses[seq]; ok {
 		delete(c.pendingResponses, seq)
+		if seqs := c.sessionPendings[presp.session]; seqs != nil {
+			delete(seqs, seq)
+			if len(seqs) == 0 {
+				delete(c.sessionPendings, presp.session)
+			}
+		}
 		return presp
 	}
 	return nil
@@ -316,5 +726,30 @@ func (c *Client) ClearPendingResponses() map[uint64]*PendingResponse {
 	defer c.pendingLock.Unlock()
 	presps := c.pendingResponses
 	c.pendingResponses = nil
+	c.sessionPendings = make(map[getty.Session]map[uint64]struct{})
 	return presps
 }
+
+// failPendingResponses fails the pending responses of @session, which has been closed,
+// so that their callers do not wait for them forever.
+func (c *Client) failPendingResponses(session getty.Session) {
+	c.pendingLock.Lock()
+	seqs := c.sessionPendings[session]
+	delete(c.sessionPendings, session)
+	presps := make([]*PendingResponse, 0, len(seqs))
+	for seq := range seqs {
+		if presp, ok := c.pendingResponses[seq]; ok {
+			delete(c.pendingResponses, seq)
+			presps = append(presps, presp)
+		}
+	}
+	c.pendingLock.Unlock()
+
+	if len(presps) != 0 {
+		log.Warn("session{%s} is closed with %d pending responses", session.Stat(), len(presps))
+	}
+	for _, presp := range presps {
+		presp.err = errSessionNotExist
+		presp.done <- struct{}{}
+	}
+}
@@ -0,0 +1,383 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+import (
+	jerrors "github.com/juju/errors"
+)
+
+func TestSessionCloseFailsPendingCalls(t *testing.T) {
+	_, port := newTestServer(t)
+	client := newTestClient(t, port)
+	if err := waitReady(client); err != nil {
+		t.Fatalf("WaitReady() = error{%v}", err)
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		var reply int
+		errs <- client.Call("Arith", "Sleep", 5000, &reply)
+	}()
+	if !waitUntil(func() bool { return client.PendingResponseCount() == 1 }) {
+		t.Fatalf("pending response number = %d, want 1", client.PendingResponseCount())
+	}
+
+	// the call without any deadline fails once its session is closed
+	client.Close()
+	select {
+	case err := <-errs:
+		if jerrors.Cause(err) != errSessionNotExist {
+			t.Errorf("Arith.Sleep(5000) = error{%v}, want %v", err, errSessionNotExist)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("Arith.Sleep(5000) still waits after its session is closed")
+	}
+	if num := client.PendingResponseCount(); num != 0 {
+		t.Errorf("pending response number = %d, want 0", num)
+	}
+}
+
+func TestNewClientInvalidConfFile(t *testing.T) {
+	if _, err := NewClientE("no_such_client_config.toml"); err == nil {
+		t.Fatalf("NewClientE(no_such_client_config.toml) = nil error")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("NewClient(no_such_client_config.toml) does not panic")
+		}
+	}()
+	NewClient("no_such_client_config.toml")
+}
+
+// stallServer is a raw rpc server which responds to the heartbeats after its delay, or does not
+// respond to them while it is stalled. It never responds to the requests.
+type stallServer struct {
+	listener net.Listener
+	delay    int64 // nanoseconds
+	stalled  int32
+}
+
+// newStallServer starts a stall server, which is closed at the end of the test.
+func newStallServer(t *testing.T) (*stallServer, int) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen() = error{%v}", err)
+	}
+	s := &stallServer{listener: l}
+	go s.serve()
+	t.Cleanup(func() { l.Close() })
+
+	return s, l.Addr().(*net.TCPAddr).Port
+}
+
+func (s *stallServer) setDelay(delay time.Duration) {
+	atomic.StoreInt64(&s.delay, int64(delay))
+}
+
+func (s *stallServer) setStalled(stalled bool) {
+	var v int32
+	if stalled {
+		v = 1
+	}
+	atomic.StoreInt32(&s.stalled, v)
+}
+
+func (s *stallServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func (s *stallServer) serveConn(conn net.Conn) {
+	defer conn.Close()
+	var (
+		lock sync.Mutex
+		buf  bytes.Buffer
+		data = make([]byte, 4096)
+	)
+	for {
+		n, err := conn.Read(data)
+		if err != nil {
+			return
+		}
+		buf.Write(data[:n])
+		for {
+			pkg := GettyPackage{B: NewGettyRPCRequest()}
+			stream := bytes.NewBuffer(buf.Bytes())
+			length, err := pkg.Unmarshal(stream)
+			if err != nil {
+				break
+			}
+			buf.Next(length)
+			if pkg.H.Command != gettyCmdHbRequest || atomic.LoadInt32(&s.stalled) == 1 {
+				continue
+			}
+			rsp := GettyPackage{H: pkg.H}
+			rsp.H.Command = gettyCmdHbResponse
+			time.AfterFunc(time.Duration(atomic.LoadInt64(&s.delay)), func() {
+				frame, err := rsp.Marshal()
+				if err != nil {
+					return
+				}
+				lock.Lock()
+				conn.Write(frame.Bytes())
+				lock.Unlock()
+			})
+		}
+	}
+}
+
+// clientSession returns the rpc session of the @i-th session of @client.
+func clientSession(client *Client, i int) *rpcSession {
+	client.lock.RLock()
+	defer client.lock.RUnlock()
+	if i >= len(client.sessions) {
+		return nil
+	}
+
+	return client.sessions[i]
+}
+
+func TestHeartbeatRTT(t *testing.T) {
+	server, port := newStallServer(t)
+	server.setDelay(50 * time.Millisecond)
+	client := newTestClient(t, port, WithHeartbeatPeriod(200*time.Millisecond))
+	if err := waitReady(client); err != nil {
+		t.Fatalf("WaitReady() = error{%v}", err)
+	}
+
+	if !waitUntil(func() bool {
+		sessions := client.Sessions()
+		return len(sessions) == 1 && sessions[0].SRTT > 0
+	}) {
+		t.Fatalf("the heartbeat round trip time is not sampled")
+	}
+	info := client.Sessions()[0]
+	if info.RTT < 50*time.Millisecond || info.RTT >= 200*time.Millisecond {
+		t.Errorf("heartbeat rtt = %s, want [50ms, 200ms)", info.RTT)
+	}
+	if info.MissedHeartbeats != 0 {
+		t.Errorf("missed heartbeats = %d, want 0", info.MissedHeartbeats)
+	}
+}
+
+func TestHeartbeatSmoothing(t *testing.T) {
+	_, port := newStallServer(t)
+	// no heartbeat is sent during the test
+	client := newTestClient(t, port, WithHeartbeatPeriod(time.Minute))
+	if err := waitReady(client); err != nil {
+		t.Fatalf("WaitReady() = error{%v}", err)
+	}
+
+	s := clientSession(client, 0)
+	resp := NewPendingResponse()
+	client.lock.Lock()
+	s.heartbeat = resp
+	s.heartbeatSent = time.Now().Add(-80 * time.Millisecond)
+	s.srtt = 40 * time.Millisecond
+	s.missed = 2
+	client.lock.Unlock()
+
+	// the response of a stale heartbeat is not sampled
+	client.heartbeatResponded(s.session, NewPendingResponse())
+	if info := client.Sessions()[0]; info.SRTT != 40*time.Millisecond || info.MissedHeartbeats != 2 {
+		t.Errorf("session after a stale heartbeat response = %+v, want srtt 40ms & 2 missed heartbeats", info)
+	}
+
+	client.heartbeatResponded(s.session, resp)
+	info := client.Sessions()[0]
+	if info.RTT < 80*time.Millisecond {
+		t.Errorf("heartbeat rtt = %s, want not less than 80ms", info.RTT)
+	}
+	// srtt = 7/8 * srtt + 1/8 * rtt
+	if want := 40*time.Millisecond - 5*time.Millisecond + info.RTT/8; info.SRTT != want {
+		t.Errorf("heartbeat srtt = %s, want %s", info.SRTT, want)
+	}
+	if info.MissedHeartbeats != 0 {
+		t.Errorf("missed heartbeats after a heartbeat response = %d, want 0", info.MissedHeartbeats)
+	}
+}
+
+func TestMissedHeartbeats(t *testing.T) {
+	server, port := newStallServer(t)
+	server.setStalled(true)
+	client := newTestClient(t, port, WithHeartbeatPeriod(100*time.Millisecond), WithMaxMissedHeartbeats(3))
+	if err := waitReady(client); err != nil {
+		t.Fatalf("WaitReady() = error{%v}", err)
+	}
+	session := clientSession(client, 0).session
+
+	if !waitUntil(func() bool {
+		sessions := client.Sessions()
+		return len(sessions) == 1 && sessions[0].MissedHeartbeats >= 1
+	}) {
+		t.Fatalf("no heartbeat is missed by the stalled server")
+	}
+	// a heartbeat response resets the missed heartbeats
+	server.setStalled(false)
+	if !waitUntil(func() bool {
+		sessions := client.Sessions()
+		return len(sessions) == 1 && sessions[0].MissedHeartbeats == 0 && sessions[0].SRTT > 0
+	}) {
+		t.Fatalf("missed heartbeats are not reset by the heartbeat response")
+	}
+
+	// the server never responds to the call, which fails when its session is closed
+	errs := make(chan error, 1)
+	go func() {
+		var sum int
+		errs <- client.Call("Arith", "Add", 1, &sum)
+	}()
+	server.setStalled(true)
+	if !waitUntil(session.IsClosed) {
+		t.Fatalf("the session is not closed after %d missed heartbeats", 3)
+	}
+	for _, info := range client.Sessions() {
+		if info.LocalAddr == session.LocalAddr() {
+			t.Errorf("the closed session %s is still in rotation", info.LocalAddr)
+		}
+	}
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Errorf("Arith.Add(1) by the closed session = nil error")
+		}
+	case <-time.After(3 * time.Second):
+		t.Errorf("Arith.Add(1) still waits after its session is closed")
+	}
+}
+
+func TestSelectSessionLatency(t *testing.T) {
+	s := &rpcSession{srtt: 10 * time.Millisecond, missed: 2}
+	if latency := s.latency(); latency != 40*time.Millisecond {
+		t.Errorf("latency of srtt 10ms & 2 missed heartbeats = %s, want 40ms", latency)
+	}
+
+	_, port := newStallServer(t)
+	client := newTestClient(t, port, WithHeartbeatPeriod(time.Minute), WithConnectionNum(2))
+	if !waitUntil(func() bool { return len(client.Sessions()) == 2 }) {
+		t.Fatalf("session number = %d, want 2", len(client.Sessions()))
+	}
+	fast, slow := clientSession(client, 0), clientSession(client, 1)
+	client.lock.Lock()
+	fast.srtt, slow.srtt = time.Millisecond, 10*time.Millisecond
+	client.lock.Unlock()
+
+	// both sessions are picked by the power of two choices, and the faster one is chosen
+	for i := 0; i < 20; i++ {
+		if session := client.selectSession(); session != fast.session {
+			t.Fatalf("selectSession() = %s, want the session of lower srtt", session.Stat())
+		}
+	}
+	// every missed heartbeat doubles the latency, 1ms << 4 > 10ms
+	client.lock.Lock()
+	fast.missed = 4
+	client.lock.Unlock()
+	for i := 0; i < 20; i++ {
+		if session := client.selectSession(); session != slow.session {
+			t.Fatalf("selectSession() = %s, want the session without missed heartbeats", session.Stat())
+		}
+	}
+}
+
+func TestNewClientReturnsImmediately(t *testing.T) {
+	port := freePort(t)
+	start := time.Now()
+	client := newTestClient(t, port)
+	if cost := time.Since(start); cost > time.Second {
+		t.Errorf("NewClientWithConfig() without server costs %s, want returning immediately", cost)
+	}
+
+	// the calls fail fast before the first session is connected
+	var sum int
+	if err := client.Call("Arith", "Add", 1, &sum); jerrors.Cause(err) != errSessionNotExist {
+		t.Errorf("Arith.Add(1) without session = error{%v}, want errSessionNotExist", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	if err := client.WaitReady(ctx); jerrors.Cause(err) != ErrClientNotReady {
+		t.Errorf("WaitReady() without server = error{%v}, want ErrClientNotReady", err)
+	}
+	if cost := time.Since(start); cost < 200*time.Millisecond || cost > time.Second {
+		t.Errorf("WaitReady() returns after %s, want after its 200ms deadline", cost)
+	}
+
+	// the client connects to the server which starts later
+	server, err := NewServerWithConfig(nil, WithListenAddress("127.0.0.1", strconv.Itoa(port)), WithServerProfilePort(0))
+	if err != nil {
+		t.Fatalf("NewServerWithConfig() = error{%v}", err)
+	}
+	if err = server.Register(&Arith{}); err != nil {
+		t.Fatalf("Register(Arith) = error{%v}", err)
+	}
+	if err = server.Start(); err != nil {
+		t.Fatalf("Start() = error{%v}", err)
+	}
+	defer server.Stop()
+	// the client retries connecting every 3 seconds
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := client.WaitReady(ctx); err != nil {
+		t.Fatalf("WaitReady() after the server starts = error{%v}", err)
+	}
+	if err := client.Call("Arith", "Add", 1, &sum); err != nil || sum != 2 {
+		t.Errorf("Arith.Add(1) = (%d, error{%v}), want 2", sum, err)
+	}
+}
+
+func TestLazyConnect(t *testing.T) {
+	_, port := newTestServer(t)
+	client := newTestClient(t, port, WithLazyConnect())
+	time.Sleep(300 * time.Millisecond)
+	if n := len(client.Sessions()); n != 0 {
+		t.Fatalf("session number of lazy client before any call = %d, want 0", n)
+	}
+
+	// the first call connects to the server and waits for the session
+	var sum int
+	if err := client.Call("Arith", "Add", 1, &sum); err != nil || sum != 2 {
+		t.Fatalf("Arith.Add(1) by lazy client = (%d, error{%v}), want 2", sum, err)
+	}
+	if n := len(client.Sessions()); n != 1 {
+		t.Errorf("session number of lazy client after a call = %d, want 1", n)
+	}
+}
+
+func TestLazyConnectNotReady(t *testing.T) {
+	client := newTestClient(t, freePort(t), WithLazyConnect())
+
+	// the call waits for the first session until its deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	var sum int
+	if err := client.CallWithContext(ctx, "Arith", "Add", 1, &sum); jerrors.Cause(err) != ErrClientNotReady {
+		t.Errorf("Arith.Add(1) by lazy client without server = error{%v}, want ErrClientNotReady", err)
+	}
+	if cost := time.Since(start); cost < 200*time.Millisecond {
+		t.Errorf("Arith.Add(1) by lazy client fails after %s, want after its 200ms deadline", cost)
+	}
+	// the call without deadline waits FailFastTimeout at most
+	start = time.Now()
+	if err := client.Call("Arith", "Add", 1, &sum); jerrors.Cause(err) != ErrClientNotReady {
+		t.Errorf("Arith.Add(1) by lazy client without server = error{%v}, want ErrClientNotReady", err)
+	}
+	if cost := time.Since(start); cost < time.Second || cost > 2*time.Second {
+		t.Errorf("Arith.Add(1) by lazy client fails after %s, want after the 1s FailFastTimeout", cost)
+	}
+}
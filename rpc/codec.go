@@ -2,11 +2,12 @@ package rpc
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"math"
 	"reflect"
-	"unsafe"
 )
 
 import (
@@ -16,6 +17,7 @@ import (
 )
 
 import (
+	"github.com/AlexStocks/getty"
 	log "github.com/AlexStocks/log4go"
 )
 
@@ -63,11 +65,16 @@ func String2CodecType(codecType string) gettyCodecType {
 type gettyCommand uint32
 
 const (
-	gettyDefaultCmd     gettyCommand = 0x00
-	gettyCmdHbRequest                = 0x01
-	gettyCmdHbResponse               = 0x02
-	gettyCmdRPCRequest               = 0x03
-	gettyCmdRPCResponse              = 0x04
+	gettyDefaultCmd      gettyCommand = 0x00
+	gettyCmdHbRequest                 = 0x01
+	gettyCmdHbResponse                = 0x02
+	gettyCmdRPCRequest                = 0x03
+	gettyCmdRPCResponse               = 0x04
+	gettyCmdGoAway                    = 0x05
+	gettyCmdAuthRequest               = 0x06
+	gettyCmdAuthResponse              = 0x07
+	gettyCmdCancel                    = 0x08
+	gettyCmdBatchRequest              = 0x09
 )
 
 var gettyCommandStrings = [...]string{
@@ -76,10 +83,19 @@ var gettyCommandStrings = [...]string{
 	"getty-heartbeat-response",
 	"getty-request",
 	"getty-response",
+	"getty-goaway",
+	"getty-auth-request",
+	"getty-auth-response",
+	"getty-cancel",
+	"getty-batch-request",
 }
 
 func (c gettyCommand) String() string {
-	return gettyCommandStrings[c]
+	if int(c) < len(gettyCommandStrings) {
+		return gettyCommandStrings[c]
+	}
+
+	return fmt.Sprintf("unknown(0x%x)", uint32(c))
 }
 
 ////////////////////////////////////////////
@@ -101,10 +117,33 @@ const (
 type GettyErrorCode int32
 
 const (
-	GettyOK   GettyErrorCode = 0x00
-	GettyFail                = 0x01
+	GettyOK               GettyErrorCode = 0x00
+	GettyFail                            = 0x01
+	GettyRateLimited                     = 0x02
+	GettyUnauthenticated                 = 0x03
+	GettyNotFound                        = 0x04
+	GettyInvalidArgument                 = 0x05
+	GettyDeadlineExceeded                = 0x06
 )
 
+var gettyErrorCodeStrings = [...]string{
+	"ok",
+	"fail",
+	"rate-limited",
+	"unauthenticated",
+	"not-found",
+	"invalid-argument",
+	"deadline-exceeded",
+}
+
+func (c GettyErrorCode) String() string {
+	if 0 <= c && int(c) < len(gettyErrorCodeStrings) {
+		return gettyErrorCodeStrings[c]
+	}
+
+	return fmt.Sprintf("code-%d", int32(c))
+}
+
 type SerializeType byte
 
 const (
@@ -172,27 +211,42 @@ func (c PBCodec) Decode(data []byte, i interface{}) error {
 ////////////////////////////////////////////
 
 const (
+	// the magic identifies the wire format version 1 of the package header. A new version of the
+	// header layout will have a new magic, so that the peers reject the packages of unknown versions.
 	gettyPackageMagic        = 0x20160905
 	maxPackageLen            = 1024 * 1024
 	rpcPackagePlaceholderLen = 2
 )
 
+// field offsets of GettyPackageHeader in the wire format version 1, whose integers are all
+// little endian. The layout is fixed and does not depend on the memory layout of the struct.
+// Pls see wire_format.md.
+const (
+	headerMagicOffset     = 0  // uint32
+	headerLogIDOffset     = 4  // uint32
+	headerSequenceOffset  = 8  // uint64
+	headerCommandOffset   = 16 // uint32
+	headerCodeOffset      = 20 // int32
+	headerServiceIDOffset = 24 // uint32
+	headerCodecTypeOffset = 28 // uint8
+
+	gettyPackageHeaderLen = 29
+	// the package length counts the header as 32 bytes, which is the size of GettyPackageHeader in
+	// memory, including its 3 padding bytes which are never written. Keep it to be compatible with
+	// the peers of the binary.Write encoding.
+	gettyPackageHeaderPadding = 3
+)
+
 var (
 	ErrNotEnoughStream         = jerrors.New("packet stream is not enough")
 	ErrTooLargePackage         = jerrors.New("package length is exceed the getty package's legal maximum length.")
 	ErrInvalidPackage          = jerrors.New("invalid rpc package")
 	ErrNotFoundServiceOrMethod = jerrors.New("server invalid service or method")
 	ErrIllegalMagic            = jerrors.New("package magic is not right.")
+	ErrRateLimited             = jerrors.New("request rate limited")
+	ErrInvalidArgument         = jerrors.New("invalid rpc argument")
 )
 
-var (
-	gettyPackageHeaderLen int
-)
-
-func init() {
-	gettyPackageHeaderLen = (int)((uint)(unsafe.Sizeof(GettyPackageHeader{})))
-}
-
 type RPCPackage interface {
 	Marshal(SerializeType, *bytes.Buffer) (int, error)
 	// @buf length should be equal to GettyPkg.GettyPackageHeader.Len
@@ -213,6 +267,28 @@ type GettyPackageHeader struct {
 	CodecType SerializeType
 }
 
+// encode writes @h into @b, whose length should not be less than gettyPackageHeaderLen.
+func (h *GettyPackageHeader) encode(b []byte) {
+	binary.LittleEndian.PutUint32(b[headerMagicOffset:], h.Magic)
+	binary.LittleEndian.PutUint32(b[headerLogIDOffset:], h.LogID)
+	binary.LittleEndian.PutUint64(b[headerSequenceOffset:], h.Sequence)
+	binary.LittleEndian.PutUint32(b[headerCommandOffset:], uint32(h.Command))
+	binary.LittleEndian.PutUint32(b[headerCodeOffset:], uint32(h.Code))
+	binary.LittleEndian.PutUint32(b[headerServiceIDOffset:], h.ServiceID)
+	b[headerCodecTypeOffset] = byte(h.CodecType)
+}
+
+// decode reads @h from @b, whose length should not be less than gettyPackageHeaderLen.
+func (h *GettyPackageHeader) decode(b []byte) {
+	h.Magic = binary.LittleEndian.Uint32(b[headerMagicOffset:])
+	h.LogID = binary.LittleEndian.Uint32(b[headerLogIDOffset:])
+	h.Sequence = binary.LittleEndian.Uint64(b[headerSequenceOffset:])
+	h.Command = gettyCommand(binary.LittleEndian.Uint32(b[headerCommandOffset:]))
+	h.Code = GettyErrorCode(int32(binary.LittleEndian.Uint32(b[headerCodeOffset:])))
+	h.ServiceID = binary.LittleEndian.Uint32(b[headerServiceIDOffset:])
+	h.CodecType = SerializeType(b[headerCodecTypeOffset])
+}
+
 type GettyPackage struct {
 	H GettyPackageHeader
 	B RPCPackage
@@ -230,24 +306,24 @@ func (p *GettyPackage) Marshal() (*bytes.Buffer, error) {
 		buf             *bytes.Buffer
 	)
 
-	packLen = gettyPackageHeaderLen
+	packLen = gettyPackageHeaderLen + gettyPackageHeaderPadding
 	if p.B != nil {
 		buf = &bytes.Buffer{}
 		length, err = p.B.Marshal(p.H.CodecType, buf)
 		if err != nil {
 			return nil, jerrors.Trace(err)
 		}
-		packLen = gettyPackageHeaderLen + length
+		packLen += length
 	}
-	buf0 := &bytes.Buffer{}
-	err = binary.Write(buf0, binary.LittleEndian, uint16(packLen))
-	if err != nil {
-		return nil, jerrors.Trace(err)
-	}
-	err = binary.Write(buf0, binary.LittleEndian, p.H)
-	if err != nil {
-		return nil, jerrors.Trace(err)
+	if packLen > math.MaxUint16 {
+		// the package length is written as uint16
+		return nil, jerrors.Annotatef(ErrTooLargePackage, "package length %d", packLen)
 	}
+	buf0 := &bytes.Buffer{}
+	var header [rpcPackagePlaceholderLen + gettyPackageHeaderLen]byte
+	binary.LittleEndian.PutUint16(header[:], uint16(packLen))
+	p.H.encode(header[rpcPackagePlaceholderLen:])
+	buf0.Write(header[:])
 	if p.B != nil {
 		if err = binary.Write(buf0, binary.LittleEndian, buf.Bytes()); err != nil {
 			return nil, jerrors.Trace(err)
@@ -269,26 +345,31 @@ func (p *GettyPackage) Unmarshal(buf *bytes.Buffer) (int, error) {
 	if int(packLen) > maxPackageLen {
 		return 0, ErrTooLargePackage
 	}
-	if int(packLen) < gettyPackageHeaderLen {
+	if int(packLen) < gettyPackageHeaderLen+gettyPackageHeaderPadding {
 		return 0, ErrInvalidPackage
 	}
+	bodyLen := int(packLen) - gettyPackageHeaderLen - gettyPackageHeaderPadding
+	if buf.Len() < gettyPackageHeaderLen+bodyLen {
+		return 0, ErrNotEnoughStream
+	}
 
 	// header
-	if err := binary.Read(buf, binary.LittleEndian, &(p.H)); err != nil {
-		return 0, jerrors.Trace(err)
-	}
+	p.H.decode(buf.Next(gettyPackageHeaderLen))
 	if p.H.Magic != gettyPackageMagic {
 		log.Error("@p.H.Magic{%x}, right magic{%x}", p.H.Magic, gettyPackageMagic)
 		return 0, ErrIllegalMagic
 	}
 
-	if int(packLen) > rpcPackagePlaceholderLen+gettyPackageHeaderLen {
-		if err := p.B.Unmarshal(p.H.CodecType, bytes.NewBuffer(buf.Next(int(packLen)-gettyPackageHeaderLen))); err != nil {
+	if bodyLen > 0 {
+		if p.H.Command == gettyCmdBatchRequest {
+			p.B = NewGettyRPCBatchRequest()
+		}
+		if err := p.B.Unmarshal(p.H.CodecType, bytes.NewBuffer(buf.Next(bodyLen))); err != nil {
 			return 0, jerrors.Trace(err)
 		}
 	}
 
-	return int(packLen), nil
+	return rpcPackagePlaceholderLen + gettyPackageHeaderLen + bodyLen, nil
 }
 
 ////////////////////////////////////////////
@@ -302,6 +383,9 @@ type GettyRPCRequestHeader struct {
 	Service  string
 	Method   string
 	CallType gettyCallType
+	Meta     map[string]string `json:",omitempty"`
+	// relative timeout of the request in milliseconds, or 0 if the caller has no deadline
+	Timeout int64 `json:",omitempty"`
 }
 
 type GettyRPCRequest struct {
@@ -316,6 +400,16 @@ type GettyRPCRequestPackage struct {
 	methodType *methodType
 	argv       reflect.Value
 	replyv     reflect.Value
+	// argument object of the pre-bound handler of methodType, which is got from its pool
+	arg interface{}
+	// base context of the service method, which is canceled by the cancel frame of the client
+	// and expires after the timeout of the request header
+	ctx context.Context
+	// the place of the request in its ordered queue, nil if it is handled concurrently
+	ticket *dispatchTicket
+	// GettyNotFound or GettyInvalidArgument, which is replied with @err instead of calling the service
+	code GettyErrorCode
+	err  error
 }
 
 func NewGettyRPCRequest() RPCPackage {
@@ -396,13 +490,93 @@ func (req *GettyRPCRequest) Unmarshal(sz SerializeType, buf *bytes.Buffer) error
 }
 
 func (req *GettyRPCRequest) GetBody() []byte {
-	return req.body.([]byte)
+	body, _ := req.body.([]byte)
+	return body
 }
 
 func (req *GettyRPCRequest) GetHeader() interface{} {
 	return req.header
 }
 
+////////////////////////////////////////////
+// GettyRPCBatchRequest
+////////////////////////////////////////////
+
+// GettyRPCBatchRequest is the body of the batch request frame, which carries several requests
+// in one package. Every request has its own sequence and is responded by its own response.
+// Its layout is: request number(uint16), and then sequence(uint64) & request of every request.
+type GettyRPCBatchRequest struct {
+	sequences []uint64
+	requests  []*GettyRPCRequest
+}
+
+type GettyRPCBatchRequestPackage struct {
+	H        GettyPackageHeader
+	requests []GettyRPCRequestPackage
+}
+
+func NewGettyRPCBatchRequest() RPCPackage {
+	return &GettyRPCBatchRequest{}
+}
+
+func (b *GettyRPCBatchRequest) add(seq uint64, req *GettyRPCRequest) {
+	b.sequences = append(b.sequences, seq)
+	b.requests = append(b.requests, req)
+}
+
+func (b *GettyRPCBatchRequest) Marshal(sz SerializeType, buf *bytes.Buffer) (int, error) {
+	if len(b.requests) > math.MaxUint16 {
+		return 0, jerrors.Errorf("too many batch requests %d", len(b.requests))
+	}
+	err := binary.Write(buf, binary.LittleEndian, uint16(len(b.requests)))
+	if err != nil {
+		return 0, jerrors.Trace(err)
+	}
+	length := 2
+	for i, req := range b.requests {
+		if err = binary.Write(buf, binary.LittleEndian, b.sequences[i]); err != nil {
+			return 0, jerrors.Trace(err)
+		}
+		n, err := req.Marshal(sz, buf)
+		if err != nil {
+			return 0, jerrors.Trace(err)
+		}
+		length += 8 + n
+	}
+
+	return length, nil
+}
+
+func (b *GettyRPCBatchRequest) Unmarshal(sz SerializeType, buf *bytes.Buffer) error {
+	var num uint16
+	err := binary.Read(buf, binary.LittleEndian, &num)
+	if err != nil {
+		return jerrors.Trace(err)
+	}
+
+	b.sequences = make([]uint64, num)
+	b.requests = make([]*GettyRPCRequest, num)
+	for i := range b.requests {
+		if err = binary.Read(buf, binary.LittleEndian, &b.sequences[i]); err != nil {
+			return jerrors.Trace(err)
+		}
+		b.requests[i] = &GettyRPCRequest{}
+		if err = b.requests[i].Unmarshal(sz, buf); err != nil {
+			return jerrors.Trace(err)
+		}
+	}
+
+	return nil
+}
+
+func (b *GettyRPCBatchRequest) GetBody() []byte {
+	return nil
+}
+
+func (b *GettyRPCBatchRequest) GetHeader() interface{} {
+	return nil
+}
+
 ////////////////////////////////////////////
 // GettyRPCResponse
 ////////////////////////////////////////////
@@ -414,6 +588,8 @@ type GettyRPCResponseHeader struct {
 type GettyRPCResponse struct {
 	header GettyRPCResponseHeader
 	body   interface{}
+	// encoded body, which is written instead of encoding @body if it is not nil
+	bodyData []byte
 }
 
 type GettyRPCResponsePackage struct {
@@ -436,9 +612,11 @@ func (resp *GettyRPCResponse) Marshal(sz SerializeType, buf *bytes.Buffer) (int,
 		return 0, jerrors.Trace(err)
 	}
 
-	bodyData, err := codec.Encode(resp.body)
-	if err != nil {
-		return 0, jerrors.Trace(err)
+	bodyData := resp.bodyData
+	if bodyData == nil {
+		if bodyData, err = codec.Encode(resp.body); err != nil {
+			return 0, jerrors.Trace(err)
+		}
 	}
 
 	err = binary.Write(buf, binary.LittleEndian, uint16(len(headerData)))
@@ -502,7 +680,8 @@ func (resp *GettyRPCResponse) Unmarshal(sz SerializeType, buf *bytes.Buffer) err
 }
 
 func (resp *GettyRPCResponse) GetBody() []byte {
-	return resp.body.([]byte)
+	body, _ := resp.body.([]byte)
+	return body
 }
 
 func (resp *GettyRPCResponse) GetHeader() interface{} {
@@ -514,12 +693,14 @@ func (resp *GettyRPCResponse) GetHeader() interface{} {
 ////////////////////////////////////////////
 
 type PendingResponse struct {
-	seq   uint64
-	err   error
-	reply interface{}
-	done  chan struct{}
+	seq     uint64
+	session getty.Session // the session which sends the request
+	err     error
+	reply   interface{}
+	done    chan struct{}
 }
 
 func NewPendingResponse() *PendingResponse {
-	return &PendingResponse{done: make(chan struct{})}
+	// buffered, so that the response will not block if its caller has given up waiting
+	return &PendingResponse{done: make(chan struct{}, 1)}
 }
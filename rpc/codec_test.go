@@ -0,0 +1,271 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+	"unsafe"
+)
+
+// hexDump returns the bytes of the hex dump @dump of wire_format.md, whose lines start with their offsets.
+func hexDump(t *testing.T, dump string) []byte {
+	var data []byte
+	for _, line := range strings.Split(strings.TrimSpace(dump), "\n") {
+		fields := strings.Fields(line)
+		b, err := hex.DecodeString(strings.Join(fields[1:], ""))
+		if err != nil {
+			t.Fatalf("hex.DecodeString(%s) = error{%v}", line, err)
+		}
+		data = append(data, b...)
+	}
+
+	return data
+}
+
+// vectorHeader returns the package header of the conformance vectors.
+func vectorHeader(seq uint64, cmd gettyCommand, code GettyErrorCode) GettyPackageHeader {
+	return GettyPackageHeader{
+		Magic:     gettyPackageMagic,
+		LogID:     1,
+		Sequence:  seq,
+		Command:   cmd,
+		Code:      code,
+		CodecType: JSON,
+	}
+}
+
+// the conformance vectors of wire_format.md
+var wireFormatVectors = []struct {
+	name string
+	pkg  GettyPackage
+	// body of the package decoded by the receiver, which is nil if the package has no body
+	newBody func() RPCPackage
+	dump    string
+}{
+	{
+		name: "request",
+		pkg: GettyPackage{
+			H: vectorHeader(1, gettyCmdRPCRequest, GettyOK),
+			B: &GettyRPCRequest{
+				header: GettyRPCRequestHeader{Service: "TestRpc", Method: "Add", CallType: gettyTwoWay},
+				body:   1,
+			},
+		},
+		newBody: NewGettyRPCRequest,
+		dump: `
+0000  56 00 05 09 16 20 01 00 00 00 01 00 00 00 00 00
+0010  00 00 03 00 00 00 00 00 00 00 00 00 00 00 00 31
+0020  00 7b 22 53 65 72 76 69 63 65 22 3a 22 54 65 73
+0030  74 52 70 63 22 2c 22 4d 65 74 68 6f 64 22 3a 22
+0040  41 64 64 22 2c 22 43 61 6c 6c 54 79 70 65 22 3a
+0050  32 7d 01 00 31`,
+	},
+	{
+		name: "response",
+		pkg: GettyPackage{
+			H: vectorHeader(1, gettyCmdRPCResponse, GettyOK),
+			B: &GettyRPCResponse{body: 2},
+		},
+		newBody: NewGettyRPCResponse,
+		dump: `
+0000  31 00 05 09 16 20 01 00 00 00 01 00 00 00 00 00
+0010  00 00 04 00 00 00 00 00 00 00 00 00 00 00 00 0c
+0020  00 7b 22 45 72 72 6f 72 22 3a 22 22 7d 01 00 32`,
+	},
+	{
+		name: "heartbeat request",
+		pkg:  GettyPackage{H: vectorHeader(2, gettyCmdHbRequest, GettyOK)},
+		dump: `
+0000  20 00 05 09 16 20 01 00 00 00 02 00 00 00 00 00
+0010  00 00 01 00 00 00 00 00 00 00 00 00 00 00 00`,
+	},
+	{
+		name: "heartbeat response",
+		pkg:  GettyPackage{H: vectorHeader(2, gettyCmdHbResponse, GettyOK)},
+		dump: `
+0000  20 00 05 09 16 20 01 00 00 00 02 00 00 00 00 00
+0010  00 00 02 00 00 00 00 00 00 00 00 00 00 00 00`,
+	},
+	{
+		name: "error response",
+		pkg: GettyPackage{
+			H: vectorHeader(3, gettyCmdRPCResponse, GettyNotFound),
+			B: &GettyRPCResponse{header: GettyRPCResponseHeader{Error: "service{TestRpc}, method{Sub}"}},
+		},
+		newBody: NewGettyRPCResponse,
+		dump: `
+0000  51 00 05 09 16 20 01 00 00 00 03 00 00 00 00 00
+0010  00 00 04 00 00 00 04 00 00 00 00 00 00 00 00 29
+0020  00 7b 22 45 72 72 6f 72 22 3a 22 73 65 72 76 69
+0030  63 65 7b 54 65 73 74 52 70 63 7d 2c 20 6d 65 74
+0040  68 6f 64 7b 53 75 62 7d 22 7d 04 00 6e 75 6c 6c`,
+	},
+	{
+		name: "cancel",
+		pkg: GettyPackage{
+			H: vectorHeader(1, gettyCmdCancel, GettyOK),
+			B: &GettyRPCRequest{},
+		},
+		newBody: NewGettyRPCRequest,
+		dump: `
+0000  4f 00 05 09 16 20 01 00 00 00 01 00 00 00 00 00
+0010  00 00 08 00 00 00 00 00 00 00 00 00 00 00 00 27
+0020  00 7b 22 53 65 72 76 69 63 65 22 3a 22 22 2c 22
+0030  4d 65 74 68 6f 64 22 3a 22 22 2c 22 43 61 6c 6c
+0040  54 79 70 65 22 3a 30 7d 04 00 6e 75 6c 6c`,
+	},
+	{
+		name: "batch request",
+		pkg: GettyPackage{
+			H: vectorHeader(6, gettyCmdBatchRequest, GettyOK),
+			B: &GettyRPCBatchRequest{
+				sequences: []uint64{4, 5},
+				requests: []*GettyRPCRequest{
+					{header: GettyRPCRequestHeader{Service: "TestRpc", Method: "Add", CallType: gettyTwoWay}, body: 1},
+					{header: GettyRPCRequestHeader{Service: "TestRpc", Method: "Add", CallType: gettyTwoWay}, body: 2},
+				},
+			},
+		},
+		newBody: NewGettyRPCRequest,
+		dump: `
+0000  9e 00 05 09 16 20 01 00 00 00 06 00 00 00 00 00
+0010  00 00 09 00 00 00 00 00 00 00 00 00 00 00 00 02
+0020  00 04 00 00 00 00 00 00 00 31 00 7b 22 53 65 72
+0030  76 69 63 65 22 3a 22 54 65 73 74 52 70 63 22 2c
+0040  22 4d 65 74 68 6f 64 22 3a 22 41 64 64 22 2c 22
+0050  43 61 6c 6c 54 79 70 65 22 3a 32 7d 01 00 31 05
+0060  00 00 00 00 00 00 00 31 00 7b 22 53 65 72 76 69
+0070  63 65 22 3a 22 54 65 73 74 52 70 63 22 2c 22 4d
+0080  65 74 68 6f 64 22 3a 22 41 64 64 22 2c 22 43 61
+0090  6c 6c 54 79 70 65 22 3a 32 7d 01 00 32`,
+	},
+}
+
+// checkDecodedBody checks that the decoded body @got carries the header & encoded body of @want.
+func checkDecodedBody(t *testing.T, want, got RPCPackage) {
+	switch w := want.(type) {
+	case *GettyRPCRequest:
+		g := got.(*GettyRPCRequest)
+		if !reflect.DeepEqual(g.header, w.header) {
+			t.Errorf("request header = %#v, want %#v", g.header, w.header)
+		}
+		body, _ := Codecs[JSON].Encode(w.body)
+		if !bytes.Equal(g.GetBody(), body) {
+			t.Errorf("request body = %q, want %q", g.GetBody(), body)
+		}
+	case *GettyRPCResponse:
+		g := got.(*GettyRPCResponse)
+		if g.header != w.header {
+			t.Errorf("response header = %#v, want %#v", g.header, w.header)
+		}
+		body, _ := Codecs[JSON].Encode(w.body)
+		if !bytes.Equal(g.GetBody(), body) {
+			t.Errorf("response body = %q, want %q", g.GetBody(), body)
+		}
+	case *GettyRPCBatchRequest:
+		g := got.(*GettyRPCBatchRequest)
+		if !reflect.DeepEqual(g.sequences, w.sequences) || len(g.requests) != len(w.requests) {
+			t.Fatalf("batch sequences = %v, want %v", g.sequences, w.sequences)
+		}
+		for i := range w.requests {
+			checkDecodedBody(t, w.requests[i], g.requests[i])
+		}
+	}
+}
+
+func TestWireFormatVectors(t *testing.T) {
+	for _, v := range wireFormatVectors {
+		t.Run(v.name, func(t *testing.T) {
+			data := hexDump(t, v.dump)
+
+			pkg := v.pkg
+			buf, err := pkg.Marshal()
+			if err != nil {
+				t.Fatalf("Marshal() = error{%v}", err)
+			}
+			if !bytes.Equal(buf.Bytes(), data) {
+				t.Errorf("Marshal() =\n%s\nwant\n%s", hex.Dump(buf.Bytes()), hex.Dump(data))
+			}
+
+			var decoded GettyPackage
+			if v.newBody != nil {
+				decoded.B = v.newBody()
+			}
+			length, err := decoded.Unmarshal(bytes.NewBuffer(data))
+			if err != nil {
+				t.Fatalf("Unmarshal() = error{%v}", err)
+			}
+			if length != len(data) {
+				t.Errorf("Unmarshal() length = %d, want %d", length, len(data))
+			}
+			if decoded.H != v.pkg.H {
+				t.Errorf("Unmarshal() header = %#v, want %#v", decoded.H, v.pkg.H)
+			}
+			if v.pkg.B != nil {
+				checkDecodedBody(t, v.pkg.B, decoded.B)
+			}
+		})
+	}
+}
+
+// baselineMarshal encodes @pkg as the binary.Write encoding before the wire format version 1 was
+// specified, whose package length counts unsafe.Sizeof(GettyPackageHeader{}).
+func baselineMarshal(t *testing.T, pkg GettyPackage) []byte {
+	var body bytes.Buffer
+	if pkg.B != nil {
+		if _, err := pkg.B.Marshal(pkg.H.CodecType, &body); err != nil {
+			t.Fatalf("Marshal(body) = error{%v}", err)
+		}
+	}
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, uint16(int(unsafe.Sizeof(pkg.H))+body.Len()))
+	binary.Write(&buf, binary.LittleEndian, pkg.H)
+	buf.Write(body.Bytes())
+
+	return buf.Bytes()
+}
+
+func TestBaselineFrames(t *testing.T) {
+	// the frames of the peers of the binary.Write encoding, one after another in a stream
+	var stream []byte
+	for _, v := range wireFormatVectors {
+		frame := baselineMarshal(t, v.pkg)
+		if data := hexDump(t, v.dump); !bytes.Equal(frame, data) {
+			t.Errorf("baseline frame of %s =\n%s\nwant\n%s", v.name, hex.Dump(frame), hex.Dump(data))
+		}
+		stream = append(stream, frame...)
+	}
+
+	for _, v := range wireFormatVectors {
+		var decoded GettyPackage
+		if v.newBody != nil {
+			decoded.B = v.newBody()
+		}
+		length, err := decoded.Unmarshal(bytes.NewBuffer(stream))
+		if err != nil {
+			t.Fatalf("Unmarshal(%s) = error{%v}", v.name, err)
+		}
+		if decoded.H != v.pkg.H {
+			t.Errorf("Unmarshal(%s) header = %#v, want %#v", v.name, decoded.H, v.pkg.H)
+		}
+		if v.pkg.B != nil {
+			checkDecodedBody(t, v.pkg.B, decoded.B)
+		}
+		stream = stream[length:]
+	}
+	if len(stream) != 0 {
+		t.Errorf("%d bytes are left after the baseline frames are decoded", len(stream))
+	}
+}
+
+func TestGettyCommandString(t *testing.T) {
+	if s := gettyCommand(gettyCmdBatchRequest).String(); s != "getty-batch-request" {
+		t.Errorf("gettyCmdBatchRequest.String() = %s", s)
+	}
+	if s := gettyCommand(0xff).String(); s != "unknown(0xff)" {
+		t.Errorf("gettyCommand(0xff).String() = %s, want unknown(0xff)", s)
+	}
+}
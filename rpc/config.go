@@ -1,11 +1,14 @@
 package rpc
 
 import (
+	"crypto/tls"
 	"fmt"
+	"strconv"
 	"time"
 )
 
 import (
+	jerrors "github.com/juju/errors"
 	config "github.com/koding/multiconfig"
 )
 
@@ -30,6 +33,73 @@ type (
 		SessionName      string `default:"rpc" yaml:"session_name" json:"session_name,omitempty"`
 	}
 
+	RateLimitParam struct {
+		// tokens per second. there is no limit if it is not greater than 0.
+		Rate float64 `default:"0" yaml:"rate" json:"rate,omitempty"`
+		// maximum tokens of the bucket. its default value is ceil(Rate).
+		Burst int `default:"0" yaml:"burst" json:"burst,omitempty"`
+	}
+
+	RateLimitConfig struct {
+		// request metadata key of the caller identity
+		CallerKey string `default:"caller" yaml:"caller_key" json:"caller_key,omitempty"`
+		// limit of every remote host
+		Client RateLimitParam `yaml:"client" json:"client,omitempty"`
+		// limit of every caller identity
+		Caller RateLimitParam `yaml:"caller" json:"caller,omitempty"`
+		// default limit of every service method
+		Method RateLimitParam `yaml:"method" json:"method,omitempty"`
+		// limits of specific service methods, whose key is "service.method"
+		Methods map[string]RateLimitParam `yaml:"methods" json:"methods,omitempty"`
+	}
+
+	DispatchParam struct {
+		// "concurrent", "serial_session" or "serial_key"
+		Mode string `default:"concurrent" yaml:"mode" json:"mode,omitempty"`
+		// request metadata key of the ordering key in serial_key mode
+		Key string `yaml:"key" json:"key,omitempty"`
+	}
+
+	TLSConfig struct {
+		// use tls if it is true
+		Enable bool `default:"false" yaml:"enable" json:"enable,omitempty"`
+		// certificate & private key files. they are required by the server, and by the client in mutual tls.
+		CertFile string `yaml:"cert_file" json:"cert_file,omitempty"`
+		KeyFile  string `yaml:"key_file" json:"key_file,omitempty"`
+		// CA certificate file to verify the peer. the system CA pool is used by the client if it is empty.
+		CAFile string `yaml:"ca_file" json:"ca_file,omitempty"`
+		// server name to verify the server certificate. its default value is ServerHost. only used by the client.
+		ServerName string `yaml:"server_name" json:"server_name,omitempty"`
+		// "none", "request", "require", "verify-if-given" or "require-and-verify". only used by the server.
+		ClientAuth string `default:"none" yaml:"client_auth" json:"client_auth,omitempty"`
+		// skip verifying the server certificate. only used by the client for test.
+		InsecureSkipVerify bool `default:"false" yaml:"insecure_skip_verify" json:"insecure_skip_verify,omitempty"`
+		tlsConfig          *tls.Config
+	}
+
+	TracingConfig struct {
+		// span exporter: "none" or "stdout". Others can be set by (Server/Client)SetSpanExporter.
+		Exporter string `default:"none" yaml:"exporter" json:"exporter,omitempty"`
+	}
+
+	AuthConfig struct {
+		// "none", "token", "hmac" or "tls". Others can be set by (Server)SetAuthenticator & WithCredentials.
+		Type string `default:"none" yaml:"type" json:"type,omitempty"`
+		// token -> principal name. only used by the server.
+		Tokens map[string]string `yaml:"tokens" json:"tokens,omitempty"`
+		// hmac key id -> secret. only used by the server.
+		Secrets map[string]string `yaml:"secrets" json:"secrets,omitempty"`
+		// max clock skew of the hmac timestamp. only used by the server.
+		MaxClockSkew string `default:"5m" yaml:"max_clock_skew" json:"max_clock_skew,omitempty"`
+		// the server closes the sessions which are still unauthenticated after Timeout.
+		Timeout string `default:"5s" yaml:"timeout" json:"timeout,omitempty"`
+		timeout time.Duration
+		// credentials. only used by the client.
+		Token  string `yaml:"token" json:"token,omitempty"`
+		KeyID  string `yaml:"key_id" json:"key_id,omitempty"`
+		Secret string `yaml:"secret" json:"secret,omitempty"`
+	}
+
 	RegistryConfig struct {
 		Type             string `default:"etcd" yaml:"type" json:"type,omitempty"`
 		Addr             string `default:"127.0.0.1:2379" yaml:"addr" json:"addr,omitempty"`
@@ -43,11 +113,22 @@ type (
 	ServerConfig struct {
 		// local address
 		AppName     string   `default:"rcp-server" yaml:"app_name" json:"app_name,omitempty"`
+		LogConfFile string   `yaml:"log_conf_file" json:"log_conf_file,omitempty"`
 		Host        string   `default:"127.0.0.1" yaml:"host" json:"host,omitempty"`
-		Ports       []string `yaml:"ports" json:"ports,omitempty"` // `default:["10000"]`
-		ProfilePort int      `default:"10086" yaml:"profile_port" json:"profile_port,omitempty"`
-		CodecType   string   `default:"json" yaml:"codec_type" json:"codec_type,omitempty"`
-		codecType   gettyCodecType
+		Ports       []string `yaml:"ports" json:"ports,omitempty"`                               // `default:["10000"]`, or socket file paths in unix transport
+		ProfilePort int      `default:"10086" yaml:"profile_port" json:"profile_port,omitempty"` // admin http server port, disabled if it is 0
+		// the admin http server serves pprof & debug handlers on AdminHost:ProfilePort if EnableAdmin is true.
+		// AdminHost is the loopback address if it is empty.
+		EnableAdmin bool   `default:"false" yaml:"enable_admin" json:"enable_admin,omitempty"`
+		AdminHost   string `default:"127.0.0.1" yaml:"admin_host" json:"admin_host,omitempty"`
+
+		CodecType string `default:"json" yaml:"codec_type" json:"codec_type,omitempty"`
+		codecType gettyCodecType
+
+		// transport: "tcp", "ws", "wss" or "unix"
+		Transport string `default:"tcp" yaml:"transport" json:"transport,omitempty"`
+		// websocket request url path
+		WSPath string `default:"/" yaml:"ws_path" json:"ws_path,omitempty"`
 
 		// session
 		SessionTimeout string `default:"60s" yaml:"session_timeout" json:"session_timeout,omitempty"`
@@ -58,6 +139,25 @@ type (
 		FailFastTimeout string `default:"5s" yaml:"fail_fast_timeout" json:"fail_fast_timeout,omitempty"`
 		failFastTimeout time.Duration
 
+		// rate limit
+		RateLimit RateLimitConfig `yaml:"rate_limit" json:"rate_limit,omitempty"`
+
+		// dispatch modes of services or service methods, whose key is "service" or "service.method".
+		// the requests are handled concurrently in default.
+		Dispatch map[string]DispatchParam `yaml:"dispatch" json:"dispatch,omitempty"`
+
+		// do not register the built-in reflection service
+		DisableReflection bool `default:"false" yaml:"disable_reflection" json:"disable_reflection,omitempty"`
+
+		// tracing
+		Tracing TracingConfig `yaml:"tracing" json:"tracing,omitempty"`
+
+		// transport security
+		TLS TLSConfig `yaml:"tls" json:"tls,omitempty"`
+
+		// session authentication
+		Auth AuthConfig `yaml:"auth" json:"auth,omitempty"`
+
 		// session tcp parameters
 		GettySessionParam GettySessionParam `required:"true" yaml:"getty_session_param" json:"getty_session_param,omitempty"`
 
@@ -70,19 +170,38 @@ type (
 		// local address
 		AppName     string   `default:"rcp-client" yaml:"app_name" json:"app_name,omitempty"`
 		Host        string   `default:"127.0.0.1" yaml:"host" json:"host,omitempty"`
-		Ports       []string `yaml:"ports" json:"ports,omitempty"` // `default:["10000"]`
-		ProfilePort int      `default:"10086" yaml:"profile_port" json:"profile_port,omitempty"`
+		Ports       []string `yaml:"ports" json:"ports,omitempty"`                               // `default:["10000"]`
+		ProfilePort int      `default:"10086" yaml:"profile_port" json:"profile_port,omitempty"` // admin http server port, disabled if it is 0
+		// the admin http server serves pprof & debug handlers on AdminHost:ProfilePort if EnableAdmin is true.
+		// AdminHost is the loopback address if it is empty.
+		EnableAdmin bool   `default:"false" yaml:"enable_admin" json:"enable_admin,omitempty"`
+		AdminHost   string `default:"127.0.0.1" yaml:"admin_host" json:"admin_host,omitempty"`
 
-		// server
+		// server. ServerHost is the socket file path in unix transport.
 		ServerHost string `default:"127.0.0.1" yaml:"server_host" json:"server_host,omitempty"`
 		ServerPort int    `default:"10000" yaml:"server_port" json:"server_port,omitempty"`
 
+		// transport: "tcp", "ws", "wss" or "unix"
+		Transport string `default:"tcp" yaml:"transport" json:"transport,omitempty"`
+		// websocket request url path
+		WSPath string `default:"/" yaml:"ws_path" json:"ws_path,omitempty"`
+
 		// session pool
 		ConnectionNum int `default:"16" yaml:"connection_num" json:"connection_num,omitempty"`
+		// connect to the server when the first call comes, and calls wait for the first session
+		LazyConnect bool `default:"false" yaml:"lazy_connect" json:"lazy_connect,omitempty"`
 
 		// heartbeat
 		HeartbeatPeriod string `default:"15s" yaml:"heartbeat_period" json:"heartbeat_period,omitempty"`
 		heartbeatPeriod time.Duration
+		// close the session after so many consecutive heartbeats are not responded in their heartbeat
+		// periods. 0 means that the session is only closed by SessionTimeout.
+		MaxMissedHeartbeats int `default:"3" yaml:"max_missed_heartbeats" json:"max_missed_heartbeats,omitempty"`
+
+		// check the health of the server every heartbeat period, and do not route calls to it if it is not SERVING
+		HealthCheck bool `default:"false" yaml:"health_check" json:"health_check,omitempty"`
+		// the service whose health is checked. the whole server is checked if it is empty.
+		HealthCheckService string `yaml:"health_check_service" json:"health_check_service,omitempty"`
 
 		// session
 		SessionTimeout string `default:"60s" yaml:"session_timeout" json:"session_timeout,omitempty"`
@@ -92,6 +211,16 @@ type (
 		FailFastTimeout string `default:"5s" yaml:"fail_fast_timeout" json:"fail_fast_timeout,omitempty"`
 		failFastTimeout time.Duration
 
+		// tracing
+		Tracing TracingConfig `yaml:"tracing" json:"tracing,omitempty"`
+
+		// transport security
+		TLS TLSConfig `yaml:"tls" json:"tls,omitempty"`
+
+		// session authentication
+		Auth        AuthConfig `yaml:"auth" json:"auth,omitempty"`
+		credentials CredentialsFunc
+
 		// session tcp parameters
 		GettySessionParam GettySessionParam `required:"true" yaml:"getty_session_param" json:"getty_session_param,omitempty"`
 
@@ -100,69 +229,211 @@ type (
 	}
 )
 
-func loadClientConf(confFile string) *ClientConfig {
-	var err error
+// NewServerConfig returns a ServerConfig filled with the default values of its tags. Different
+// from the config file, it does not use any registry in default.
+func NewServerConfig() *ServerConfig {
+	conf := new(ServerConfig)
+	loader := &config.TagLoader{}
+	if err := loader.Load(conf); err != nil {
+		// the default tags are fixed, so it never happens
+		panic(fmt.Sprintf("TagLoader.Load(ServerConfig) = error{%v}", err))
+	}
+	conf.Registry.Addr = ""
+
+	return conf
+}
+
+// NewClientConfig returns a ClientConfig filled with the default values of its tags. Different
+// from the config file, it does not use any registry in default.
+func NewClientConfig() *ClientConfig {
 	conf := new(ClientConfig)
-	config.MustLoadWithPath(confFile, conf)
-	conf.heartbeatPeriod, err = time.ParseDuration(conf.HeartbeatPeriod)
-	if err != nil {
-		panic(fmt.Sprintf("time.ParseDuration(HeartbeatPeroid{%#v}) = error{%v}", conf.HeartbeatPeriod, err))
+	loader := &config.TagLoader{}
+	if err := loader.Load(conf); err != nil {
+		// the default tags are fixed, so it never happens
+		panic(fmt.Sprintf("TagLoader.Load(ClientConfig) = error{%v}", err))
+	}
+	conf.Registry.Addr = ""
+
+	return conf
+}
+
+// CheckValidity parses the duration strings of @p and checks its legality.
+func (p *GettySessionParam) CheckValidity() error {
+	var err error
+
+	if p.keepAlivePeriod, err = time.ParseDuration(p.KeepAlivePeriod); err != nil {
+		return jerrors.Annotatef(err, "time.ParseDuration(KeepAlivePeriod{%#v})", p.KeepAlivePeriod)
 	}
-	conf.sessionTimeout, err = time.ParseDuration(conf.SessionTimeout)
-	if err != nil {
-		panic(fmt.Sprintf("time.ParseDuration(SessionTimeout{%#v}) = error{%v}", conf.SessionTimeout, err))
+	if p.tcpReadTimeout, err = time.ParseDuration(p.TcpReadTimeout); err != nil {
+		return jerrors.Annotatef(err, "time.ParseDuration(TcpReadTimeout{%#v})", p.TcpReadTimeout)
 	}
-	conf.failFastTimeout, err = time.ParseDuration(conf.FailFastTimeout)
-	if err != nil {
-		panic(fmt.Sprintf("time.ParseDuration(FailFastTimeout{%#v}) = error{%v}", conf.FailFastTimeout, err))
+	if p.tcpReadTimeout <= 0 {
+		return jerrors.Errorf("illegal TcpReadTimeout{%#v}", p.TcpReadTimeout)
 	}
-	conf.GettySessionParam.keepAlivePeriod, err = time.ParseDuration(conf.GettySessionParam.KeepAlivePeriod)
-	if err != nil {
-		panic(fmt.Sprintf("time.ParseDuration(KeepAlivePeriod{%#v}) = error{%v}", conf.GettySessionParam.KeepAlivePeriod, err))
+	if p.tcpWriteTimeout, err = time.ParseDuration(p.TcpWriteTimeout); err != nil {
+		return jerrors.Annotatef(err, "time.ParseDuration(TcpWriteTimeout{%#v})", p.TcpWriteTimeout)
 	}
-	conf.GettySessionParam.tcpReadTimeout, err = time.ParseDuration(conf.GettySessionParam.TcpReadTimeout)
-	if err != nil {
-		panic(fmt.Sprintf("time.ParseDuration(TcpReadTimeout{%#v}) = error{%v}", conf.GettySessionParam.TcpReadTimeout, err))
+	if p.tcpWriteTimeout <= 0 {
+		return jerrors.Errorf("illegal TcpWriteTimeout{%#v}", p.TcpWriteTimeout)
 	}
-	conf.GettySessionParam.tcpWriteTimeout, err = time.ParseDuration(conf.GettySessionParam.TcpWriteTimeout)
-	if err != nil {
-		panic(fmt.Sprintf("time.ParseDuration(TcpWriteTimeout{%#v}) = error{%v}", conf.GettySessionParam.TcpWriteTimeout, err))
+	if p.waitTimeout, err = time.ParseDuration(p.WaitTimeout); err != nil {
+		return jerrors.Annotatef(err, "time.ParseDuration(WaitTimeout{%#v})", p.WaitTimeout)
 	}
-	conf.GettySessionParam.waitTimeout, err = time.ParseDuration(conf.GettySessionParam.WaitTimeout)
-	if err != nil {
-		panic(fmt.Sprintf("time.ParseDuration(WaitTimeout{%#v}) = error{%v}", conf.GettySessionParam.WaitTimeout, err))
+	if p.waitTimeout <= 0 {
+		return jerrors.Errorf("illegal WaitTimeout{%#v}", p.WaitTimeout)
 	}
-	return conf
+	if p.PkgRQSize < 1 || p.PkgWQSize < 1 {
+		return jerrors.Errorf("illegal PkgRQSize{%d} or PkgWQSize{%d}", p.PkgRQSize, p.PkgWQSize)
+	}
+
+	return nil
 }
 
-func loadServerConf(confFile string) *ServerConfig {
+// CheckValidity parses the duration strings of @c and checks its legality.
+func (c *ServerConfig) CheckValidity() error {
 	var err error
-	conf := new(ServerConfig)
-	config.MustLoadWithPath(confFile, conf)
 
-	conf.sessionTimeout, err = time.ParseDuration(conf.SessionTimeout)
-	if err != nil {
-		panic(fmt.Sprintf("time.ParseDuration(SessionTimeout{%#v}) = error{%v}", conf.SessionTimeout, err))
+	if c.codecType = String2CodecType(c.CodecType); c.codecType == gettyCodecUnknown {
+		return ErrIllegalCodecType
 	}
-	conf.failFastTimeout, err = time.ParseDuration(conf.FailFastTimeout)
-	if err != nil {
-		panic(fmt.Sprintf("time.ParseDuration(FailFastTimeout{%#v}) = error{%v}", conf.FailFastTimeout, err))
+	if err = checkTransport(c.Transport, c.TLS.Enable); err != nil {
+		return jerrors.Trace(err)
 	}
-	conf.GettySessionParam.keepAlivePeriod, err = time.ParseDuration(conf.GettySessionParam.KeepAlivePeriod)
-	if err != nil {
-		panic(fmt.Sprintf("time.ParseDuration(KeepAlivePeriod{%#v}) = error{%v}", conf.GettySessionParam.KeepAlivePeriod, err))
+	for _, p := range c.Ports {
+		if c.Transport == TransportUnix {
+			if p == "" {
+				return jerrors.New("illegal empty socket file path")
+			}
+			continue
+		}
+		if port, err := strconv.Atoi(p); err != nil || port <= 0 || port > 65535 {
+			return jerrors.Errorf("illegal port %s", p)
+		}
 	}
-	conf.GettySessionParam.tcpReadTimeout, err = time.ParseDuration(conf.GettySessionParam.TcpReadTimeout)
-	if err != nil {
-		panic(fmt.Sprintf("time.ParseDuration(TcpReadTimeout{%#v}) = error{%v}", conf.GettySessionParam.TcpReadTimeout, err))
+	if c.Transport == TransportWSS && (c.TLS.CertFile == "" || c.TLS.KeyFile == "") {
+		return jerrors.New("wss transport needs both TLS.CertFile and TLS.KeyFile")
 	}
-	conf.GettySessionParam.tcpWriteTimeout, err = time.ParseDuration(conf.GettySessionParam.TcpWriteTimeout)
-	if err != nil {
-		panic(fmt.Sprintf("time.ParseDuration(TcpWriteTimeout{%#v}) = error{%v}", conf.GettySessionParam.TcpWriteTimeout, err))
+	if c.sessionTimeout, err = time.ParseDuration(c.SessionTimeout); err != nil {
+		return jerrors.Annotatef(err, "time.ParseDuration(SessionTimeout{%#v})", c.SessionTimeout)
 	}
-	conf.GettySessionParam.waitTimeout, err = time.ParseDuration(conf.GettySessionParam.WaitTimeout)
-	if err != nil {
-		panic(fmt.Sprintf("time.ParseDuration(WaitTimeout{%#v}) = error{%v}", conf.GettySessionParam.WaitTimeout, err))
+	if c.sessionTimeout < time.Millisecond {
+		return jerrors.Errorf("illegal SessionTimeout{%#v}", c.SessionTimeout)
 	}
-	return conf
+	if c.SessionNumber < 1 {
+		return jerrors.Errorf("illegal SessionNumber{%d}", c.SessionNumber)
+	}
+	if c.failFastTimeout, err = time.ParseDuration(c.FailFastTimeout); err != nil {
+		return jerrors.Annotatef(err, "time.ParseDuration(FailFastTimeout{%#v})", c.FailFastTimeout)
+	}
+	if err = checkDispatch(c.Dispatch); err != nil {
+		return jerrors.Trace(err)
+	}
+	if _, err = newSpanExporter(c.Tracing); err != nil {
+		return jerrors.Trace(err)
+	}
+	if err = c.TLS.buildServerConfig(); err != nil {
+		return jerrors.Trace(err)
+	}
+	c.Auth.timeout = defaultAuthTimeout
+	if c.Auth.Timeout != "" {
+		if c.Auth.timeout, err = time.ParseDuration(c.Auth.Timeout); err != nil {
+			return jerrors.Annotatef(err, "time.ParseDuration(Auth.Timeout{%#v})", c.Auth.Timeout)
+		}
+	}
+	if c.Auth.timeout <= 0 {
+		return jerrors.Errorf("illegal Auth.Timeout{%#v}", c.Auth.Timeout)
+	}
+	if _, err = newAuthenticator(c.Auth); err != nil {
+		return jerrors.Trace(err)
+	}
+	if c.Auth.Type == AuthTypeTLS && (!c.TLS.Enable || c.TLS.ClientAuth != "require-and-verify") {
+		return jerrors.New("tls authenticator needs mutual tls whose TLS.ClientAuth is require-and-verify")
+	}
+
+	return jerrors.Trace(c.GettySessionParam.CheckValidity())
+}
+
+// CheckValidity parses the duration strings of @c and checks its legality.
+func (c *ClientConfig) CheckValidity() error {
+	var err error
+
+	if err = checkTransport(c.Transport, c.TLS.Enable); err != nil {
+		return jerrors.Trace(err)
+	}
+	if c.Transport == TransportUnix {
+		if c.ServerHost == "" {
+			return jerrors.New("illegal empty socket file path")
+		}
+	} else if c.ServerPort <= 0 || c.ServerPort > 65535 {
+		return jerrors.Errorf("illegal ServerPort{%d}", c.ServerPort)
+	}
+	if c.ConnectionNum < 1 {
+		return jerrors.Errorf("illegal ConnectionNum{%d}", c.ConnectionNum)
+	}
+	if c.heartbeatPeriod, err = time.ParseDuration(c.HeartbeatPeriod); err != nil {
+		return jerrors.Annotatef(err, "time.ParseDuration(HeartbeatPeroid{%#v})", c.HeartbeatPeriod)
+	}
+	if c.heartbeatPeriod < time.Millisecond {
+		return jerrors.Errorf("illegal HeartbeatPeriod{%#v}", c.HeartbeatPeriod)
+	}
+	if c.MaxMissedHeartbeats < 0 {
+		return jerrors.Errorf("illegal MaxMissedHeartbeats{%d}", c.MaxMissedHeartbeats)
+	}
+	if c.sessionTimeout, err = time.ParseDuration(c.SessionTimeout); err != nil {
+		return jerrors.Annotatef(err, "time.ParseDuration(SessionTimeout{%#v})", c.SessionTimeout)
+	}
+	if c.failFastTimeout, err = time.ParseDuration(c.FailFastTimeout); err != nil {
+		return jerrors.Annotatef(err, "time.ParseDuration(FailFastTimeout{%#v})", c.FailFastTimeout)
+	}
+	if _, err = newSpanExporter(c.Tracing); err != nil {
+		return jerrors.Trace(err)
+	}
+	if err = c.TLS.buildClientConfig(c.ServerHost); err != nil {
+		return jerrors.Trace(err)
+	}
+	if _, err = newCredentials(c.Auth); err != nil {
+		return jerrors.Trace(err)
+	}
+	if c.Auth.Type == AuthTypeTLS && (!c.TLS.Enable || c.TLS.CertFile == "") {
+		return jerrors.New("tls credentials need the client certificate TLS.CertFile")
+	}
+
+	return jerrors.Trace(c.GettySessionParam.CheckValidity())
+}
+
+// loadConf loads @confFile into @conf.
+func loadConf(confFile string, conf interface{}) error {
+	loader := config.NewWithPath(confFile)
+	if err := loader.Load(conf); err != nil {
+		return jerrors.Annotatef(err, "load config file %s", confFile)
+	}
+	if err := loader.Validate(conf); err != nil {
+		return jerrors.Annotatef(err, "validate config file %s", confFile)
+	}
+
+	return nil
+}
+
+func loadServerConf(confFile string) (*ServerConfig, error) {
+	conf := new(ServerConfig)
+	if err := loadConf(confFile, conf); err != nil {
+		return nil, jerrors.Trace(err)
+	}
+	if err := conf.CheckValidity(); err != nil {
+		return nil, jerrors.Trace(err)
+	}
+
+	return conf, nil
+}
+
+func loadClientConf(confFile string) (*ClientConfig, error) {
+	conf := new(ClientConfig)
+	if err := loadConf(confFile, conf); err != nil {
+		return nil, jerrors.Trace(err)
+	}
+	if err := conf.CheckValidity(); err != nil {
+		return nil, jerrors.Trace(err)
+	}
+
+	return conf, nil
 }
@@ -0,0 +1,138 @@
+package rpc
+
+import (
+	"crypto/x509"
+	"testing"
+)
+
+// checkNoPanic runs @f and reports the panic of it as an error of @name.
+func checkNoPanic(t *testing.T, name string, f func() error) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			t.Errorf("%s panics: %v", name, e)
+		}
+	}()
+
+	return f()
+}
+
+func TestServerConfigCheckValidity(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "ca")
+	cert := newTestLeaf(t, dir, "server", 2, x509.ExtKeyUsageServerAuth, ca)
+	serverTLS := TLSConfig{Enable: true, CertFile: cert.certFile, KeyFile: cert.keyFile}
+
+	if err := NewServerConfig().CheckValidity(); err != nil {
+		t.Fatalf("CheckValidity() of the default config = error{%v}", err)
+	}
+	tests := []struct {
+		name string
+		opt  ServerOption
+	}{
+		{"not number port", WithListenAddress("127.0.0.1", "http")},
+		{"zero port", WithListenAddress("127.0.0.1", "10000", "0")},
+		{"negative port", WithListenAddress("127.0.0.1", "-1")},
+		{"too large port", WithListenAddress("127.0.0.1", "65536")},
+		{"empty socket file", func(c *ServerConfig) { c.Transport, c.Ports = TransportUnix, []string{""} }},
+		{"unknown codec", WithServerCodecType("xml")},
+		{"unknown transport", func(c *ServerConfig) { c.Transport = "quic" }},
+		{"wss without tls", func(c *ServerConfig) { c.Transport = TransportWSS }},
+		{"wss without cert", func(c *ServerConfig) { c.Transport, c.TLS = TransportWSS, TLSConfig{Enable: true} }},
+		{"ws with tls", func(c *ServerConfig) { c.Transport, c.TLS = TransportWS, serverTLS }},
+		{"tls without cert", WithServerTLS(TLSConfig{Enable: true})},
+		{"tls without cert file", WithServerTLS(TLSConfig{Enable: true, CertFile: dir + "/none.pem", KeyFile: cert.keyFile})},
+		{"tls with unknown client auth", WithServerTLS(TLSConfig{Enable: true, CertFile: cert.certFile, KeyFile: cert.keyFile, ClientAuth: "always"})},
+		{"bad session timeout", func(c *ServerConfig) { c.SessionTimeout = "1 minute" }},
+		{"zero session timeout", WithServerSessionTimeout(0)},
+		{"zero session number", WithSessionNumber(0)},
+		{"bad fail fast timeout", func(c *ServerConfig) { c.FailFastTimeout = "5" }},
+		{"unknown dispatch mode", WithDispatchMode("Arith", "random", "")},
+		{"serial key without key", WithDispatchMode("Arith.Add", DispatchSerialKey, "")},
+		{"unknown span exporter", func(c *ServerConfig) { c.Tracing.Exporter = "jaeger" }},
+		{"unknown auth type", WithServerAuth(AuthConfig{Type: "kerberos"})},
+		{"bad auth timeout", WithServerAuth(AuthConfig{Type: AuthTypeNone, Timeout: "soon"})},
+		{"tls auth without tls", WithServerAuth(AuthConfig{Type: AuthTypeTLS})},
+		{"tls auth without mutual tls", func(c *ServerConfig) { c.TLS, c.Auth = serverTLS, AuthConfig{Type: AuthTypeTLS} }},
+		{"zero session param", WithServerSessionParam(GettySessionParam{})},
+		{"bad keep alive period", func(c *ServerConfig) { c.GettySessionParam.KeepAlivePeriod = "long" }},
+		{"zero read timeout", func(c *ServerConfig) { c.GettySessionParam.TcpReadTimeout = "0s" }},
+		{"negative wait timeout", func(c *ServerConfig) { c.GettySessionParam.WaitTimeout = "-1s" }},
+		{"zero package queue", func(c *ServerConfig) { c.GettySessionParam.PkgWQSize = 0 }},
+	}
+	for _, test := range tests {
+		conf := NewServerConfig()
+		test.opt(conf)
+		if err := checkNoPanic(t, test.name+" CheckValidity()", conf.CheckValidity); err == nil {
+			t.Errorf("CheckValidity() of %s = nil error", test.name)
+		}
+		err := checkNoPanic(t, test.name+" NewServerWithConfig()", func() error {
+			server, err := NewServerWithConfig(nil, test.opt)
+			if server != nil {
+				server.Stop()
+			}
+			return err
+		})
+		if err == nil {
+			t.Errorf("NewServerWithConfig() of %s = nil error", test.name)
+		}
+	}
+}
+
+func TestClientConfigCheckValidity(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "ca")
+	cert := newTestLeaf(t, dir, "client", 3, x509.ExtKeyUsageClientAuth, ca)
+
+	if err := NewClientConfig().CheckValidity(); err != nil {
+		t.Fatalf("CheckValidity() of the default config = error{%v}", err)
+	}
+	tests := []struct {
+		name string
+		opt  ClientOption
+	}{
+		{"zero port", WithServerAddress("127.0.0.1", 0)},
+		{"negative port", WithServerAddress("127.0.0.1", -1)},
+		{"too large port", WithServerAddress("127.0.0.1", 65536)},
+		{"empty socket file", func(c *ClientConfig) { c.Transport, c.ServerHost = TransportUnix, "" }},
+		{"unknown transport", func(c *ClientConfig) { c.Transport = "quic" }},
+		{"zero connection number", WithConnectionNum(0)},
+		{"negative connection number", WithConnectionNum(-1)},
+		{"bad heartbeat period", func(c *ClientConfig) { c.HeartbeatPeriod = "15" }},
+		{"zero heartbeat period", WithHeartbeatPeriod(0)},
+		{"negative max missed heartbeats", WithMaxMissedHeartbeats(-1)},
+		{"bad session timeout", func(c *ClientConfig) { c.SessionTimeout = "1 minute" }},
+		{"bad fail fast timeout", func(c *ClientConfig) { c.FailFastTimeout = "5" }},
+		{"wss without tls", func(c *ClientConfig) { c.Transport = TransportWSS }},
+		{"ws with tls", func(c *ClientConfig) { c.Transport, c.TLS = TransportWS, TLSConfig{Enable: true} }},
+		{"unix with tls", func(c *ClientConfig) { c.Transport, c.TLS = TransportUnix, TLSConfig{Enable: true} }},
+		{"tls without CA file", WithClientTLS(TLSConfig{Enable: true, CAFile: dir + "/none.pem"})},
+		{"tls without key file", WithClientTLS(TLSConfig{Enable: true, CertFile: cert.certFile})},
+		{"unknown span exporter", func(c *ClientConfig) { c.Tracing.Exporter = "jaeger" }},
+		{"unknown auth type", WithClientAuth(AuthConfig{Type: "kerberos"})},
+		{"token auth without token", WithClientAuth(AuthConfig{Type: AuthTypeToken})},
+		{"tls auth without tls", WithClientAuth(AuthConfig{Type: AuthTypeTLS})},
+		{"tls auth without cert", func(c *ClientConfig) {
+			c.TLS, c.Auth = TLSConfig{Enable: true, CAFile: ca.certFile}, AuthConfig{Type: AuthTypeTLS}
+		}},
+		{"zero session param", WithClientSessionParam(GettySessionParam{})},
+		{"zero write timeout", func(c *ClientConfig) { c.GettySessionParam.TcpWriteTimeout = "0s" }},
+		{"zero package queue", func(c *ClientConfig) { c.GettySessionParam.PkgRQSize = 0 }},
+	}
+	for _, test := range tests {
+		conf := NewClientConfig()
+		test.opt(conf)
+		if err := checkNoPanic(t, test.name+" CheckValidity()", conf.CheckValidity); err == nil {
+			t.Errorf("CheckValidity() of %s = nil error", test.name)
+		}
+		err := checkNoPanic(t, test.name+" NewClientWithConfig()", func() error {
+			client, err := NewClientWithConfig(nil, WithLazyConnect(), test.opt)
+			if client != nil {
+				client.Close()
+			}
+			return err
+		})
+		if err == nil {
+			t.Errorf("NewClientWithConfig() of %s = nil error", test.name)
+		}
+	}
+}
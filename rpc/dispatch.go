@@ -0,0 +1,173 @@
+package rpc
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+import (
+	"github.com/AlexStocks/getty"
+	jerrors "github.com/juju/errors"
+)
+
+// dispatch modes of DispatchParam
+const (
+	// the requests are handled concurrently on the session pool
+	DispatchConcurrent = "concurrent"
+	// the requests of one session are handled one by one in their arrival order
+	DispatchSerialSession = "serial_session"
+	// the requests with the same value of the metadata DispatchParam.Key are handled one by
+	// one in their arrival order, whichever sessions they come from
+	DispatchSerialKey = "serial_key"
+)
+
+// checkDispatch checks the dispatch modes of ServerConfig.Dispatch.
+func checkDispatch(dispatch map[string]DispatchParam) error {
+	for name, param := range dispatch {
+		if name == "" || strings.Count(name, ".") > 1 {
+			return jerrors.Errorf("illegal dispatch name{%s}, which should be \"service\" or \"service.method\"", name)
+		}
+		switch param.Mode {
+		case "", DispatchConcurrent, DispatchSerialSession:
+		case DispatchSerialKey:
+			if param.Key == "" {
+				return jerrors.Errorf("dispatch{%s} in %s mode needs the metadata Key", name, DispatchSerialKey)
+			}
+		default:
+			return jerrors.Errorf("illegal dispatch{%s} mode{%s}", name, param.Mode)
+		}
+	}
+
+	return nil
+}
+
+////////////////////////////////////////////
+// dispatcher
+////////////////////////////////////////////
+
+// dispatchQueueKey identifies an ordered queue. It is the session in serial_session mode,
+// or the metadata key & value in serial_key mode.
+type dispatchQueueKey struct {
+	session getty.Session
+	key     string
+}
+
+// dispatchTicket is the place of a serial request in its ordered queue. It is taken in the read
+// goroutine of the session, so the tickets are in the arrival order of the requests.
+type dispatchTicket struct {
+	ctx     context.Context
+	ready   chan struct{} // closed when fn is set
+	fn      func()
+	skipped bool // the queue has given up waiting for fn
+}
+
+// dispatcher runs the handlers of serial requests by their ordered queues. Every queue has a
+// goroutine which runs the handlers of its tickets one by one, and exits when the queue is empty,
+// so that the workers of the session pools never block waiting for their turns.
+type dispatcher struct {
+	lock   sync.Mutex
+	modes  map[string]DispatchParam
+	queues map[dispatchQueueKey][]*dispatchTicket
+}
+
+func newDispatcher(modes map[string]DispatchParam) *dispatcher {
+	return &dispatcher{
+		modes:  modes,
+		queues: make(map[dispatchQueueKey][]*dispatchTicket),
+	}
+}
+
+func (d *dispatcher) setModes(modes map[string]DispatchParam) {
+	d.lock.Lock()
+	d.modes = modes
+	d.lock.Unlock()
+}
+
+// ticket returns the ticket of the request @header of @session, or nil if the request
+// is handled concurrently. The mode of "service.method" overrides the one of "service".
+// The requests without the metadata key of serial_key mode are handled concurrently.
+func (d *dispatcher) ticket(ctx context.Context, session getty.Session, header GettyRPCRequestHeader) *dispatchTicket {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if len(d.modes) == 0 {
+		return nil
+	}
+
+	param, ok := d.modes[methodKey(header.Service, header.Method)]
+	if !ok {
+		param = d.modes[header.Service]
+	}
+	var key dispatchQueueKey
+	switch param.Mode {
+	case DispatchSerialSession:
+		key.session = session
+	case DispatchSerialKey:
+		value, ok := header.Meta[param.Key]
+		if !ok {
+			return nil
+		}
+		key.key = param.Key + "=" + value
+	default:
+		return nil
+	}
+
+	t := &dispatchTicket{ctx: ctx, ready: make(chan struct{})}
+	d.queues[key] = append(d.queues[key], t)
+	if len(d.queues[key]) == 1 {
+		go d.run(key)
+	}
+
+	return t
+}
+
+// dispatch runs @fn after the handlers of the former tickets of @t have finished. @fn runs at
+// once if the queue has given up waiting for it, e.g. its package was dropped by the session
+// pool for a while and the context of the request has been canceled.
+func (d *dispatcher) dispatch(t *dispatchTicket, fn func()) {
+	d.lock.Lock()
+	if t.skipped {
+		d.lock.Unlock()
+		fn()
+		return
+	}
+	t.fn = fn
+	close(t.ready)
+	d.lock.Unlock()
+}
+
+// run runs the handlers of the tickets of the queue @key one by one.
+func (d *dispatcher) run(key dispatchQueueKey) {
+	for {
+		d.lock.Lock()
+		t := d.queues[key][0]
+		d.lock.Unlock()
+
+		select {
+		case <-t.ready:
+			t.fn()
+		case <-t.ctx.Done():
+			// do not block the queue by the request which will not be handled in time
+			d.lock.Lock()
+			select {
+			case <-t.ready:
+			default:
+				t.skipped = true
+			}
+			d.lock.Unlock()
+			if !t.skipped {
+				t.fn()
+			}
+		}
+
+		d.lock.Lock()
+		queue := d.queues[key][1:]
+		if len(queue) == 0 {
+			delete(d.queues, key)
+			d.lock.Unlock()
+			return
+		}
+		d.queues[key] = queue
+		d.lock.Unlock()
+	}
+}
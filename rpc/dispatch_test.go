@@ -0,0 +1,179 @@
+package rpc
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDispatchDroppedSerialRequest(t *testing.T) {
+	// the session pool has one worker and a queue of two tasks, and drops the
+	// package which waits for them longer than 100ms
+	param := NewServerConfig().GettySessionParam
+	param.PkgRQSize = 2
+	param.WaitTimeout = "100ms"
+	server, port := newTestServer(t,
+		WithServerSessionParam(param),
+		WithDispatchMode("Arith.Add", DispatchSerialSession, ""))
+	client := newTestClient(t, port)
+	if err := waitReady(client); err != nil {
+		t.Fatalf("WaitReady() = error{%v}", err)
+	}
+
+	// occupy the worker and the queue of the session pool
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var reply int
+			client.Call("Arith", "Sleep", 500, &reply)
+		}()
+	}
+	if !waitUntil(func() bool { return server.InflightNum() == 3 }) {
+		t.Fatalf("in-flight request number = %d, want 3", server.InflightNum())
+	}
+
+	// the serial request without any deadline is dropped by the busy pool, and it is never responded
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		var sum int
+		client.CallWithContext(ctx, "Arith", "Add", 1, &sum)
+	}()
+	wg.Wait()
+	if !waitUntil(func() bool { return server.InflightNum() == 0 }) {
+		t.Fatalf("in-flight request number = %d, want 0", server.InflightNum())
+	}
+
+	// the next request of the same queue is not blocked by the dropped one
+	callCtx, callCancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer callCancel()
+	var sum int
+	if err := client.CallWithContext(callCtx, "Arith", "Add", 1, &sum); err != nil || sum != 2 {
+		t.Errorf("Arith.Add(1) after the dropped request = (%d, error{%v}), want 2", sum, err)
+	}
+}
+
+// Ledger is the service which records the order & the max concurrency of its calls.
+type Ledger struct {
+	lock    sync.Mutex
+	entries []int
+	current int
+	max     int
+}
+
+func (l *Ledger) Service() string {
+	return "Ledger"
+}
+
+func (l *Ledger) Version() string {
+	return "v1"
+}
+
+// Append records @n. The former entries of a batch sleep longer, so that they would be
+// recorded after the later ones if they were handled concurrently.
+func (l *Ledger) Append(n int, r *int) error {
+	l.lock.Lock()
+	l.current++
+	if l.current > l.max {
+		l.max = l.current
+	}
+	l.lock.Unlock()
+
+	time.Sleep(time.Duration(10-n%10) * 3 * time.Millisecond)
+
+	l.lock.Lock()
+	l.entries = append(l.entries, n)
+	l.current--
+	l.lock.Unlock()
+	*r = n
+	return nil
+}
+
+// appendBatches sends a batch of Ledger.Append(@base+0...@base+9) by every client of @clients concurrently.
+func appendBatches(t *testing.T, clients []*Client, opts ...CallOption) {
+	var wg sync.WaitGroup
+	for i, client := range clients {
+		wg.Add(1)
+		go func(base int, client *Client) {
+			defer wg.Done()
+			batch := client.Batch()
+			replies := make([]int, 10)
+			for j := range replies {
+				batch.Add("Ledger", "Append", base+j, &replies[j], opts...)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+			defer cancel()
+			if err := batch.Do(ctx); err != nil {
+				t.Errorf("Batch.Do() = error{%v}", err)
+			}
+		}(100*i, client)
+	}
+	wg.Wait()
+}
+
+// checkLedgerOrder checks that the entries of every batch are recorded in their order.
+func checkLedgerOrder(t *testing.T, ledger *Ledger, batches int) {
+	ledger.lock.Lock()
+	defer ledger.lock.Unlock()
+	if len(ledger.entries) != 10*batches {
+		t.Fatalf("ledger entry number = %d, want %d", len(ledger.entries), 10*batches)
+	}
+	last := make(map[int]int)
+	for _, n := range ledger.entries {
+		if prev, ok := last[n/100]; ok && n < prev {
+			t.Errorf("ledger entries = %v, entry %d is recorded after %d", ledger.entries, n, prev)
+			return
+		}
+		last[n/100] = n
+	}
+}
+
+func TestDispatchSerialOrder(t *testing.T) {
+	param := NewServerConfig().GettySessionParam
+	param.MaxMsgLen = 64 * 1024
+
+	t.Run(DispatchSerialSession, func(t *testing.T) {
+		server, port := newTestServer(t, WithServerSessionParam(param),
+			WithDispatchMode("Ledger.Append", DispatchSerialSession, ""))
+		ledger := &Ledger{}
+		if err := server.Register(ledger); err != nil {
+			t.Fatalf("Register(Ledger) = error{%v}", err)
+		}
+		clients := []*Client{newTestClient(t, port), newTestClient(t, port)}
+		for _, client := range clients {
+			if err := waitReady(client); err != nil {
+				t.Fatalf("WaitReady() = error{%v}", err)
+			}
+		}
+
+		appendBatches(t, clients)
+		checkLedgerOrder(t, ledger, len(clients))
+	})
+	t.Run(DispatchSerialKey, func(t *testing.T) {
+		server, port := newTestServer(t, WithServerSessionParam(param),
+			WithDispatchMode("Ledger", DispatchSerialKey, "account"))
+		ledger := &Ledger{}
+		if err := server.Register(ledger); err != nil {
+			t.Fatalf("Register(Ledger) = error{%v}", err)
+		}
+		clients := []*Client{newTestClient(t, port), newTestClient(t, port)}
+		for _, client := range clients {
+			if err := waitReady(client); err != nil {
+				t.Fatalf("WaitReady() = error{%v}", err)
+			}
+		}
+
+		// the requests of both sessions are in the same ordered queue
+		appendBatches(t, clients, WithCallMetadata(map[string]string{"account": "alice"}))
+		checkLedgerOrder(t, ledger, len(clients))
+		ledger.lock.Lock()
+		max := ledger.max
+		ledger.lock.Unlock()
+		if max != 1 {
+			t.Errorf("max concurrent calls of the same key = %d, want 1", max)
+		}
+	})
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"time"
 )
 
@@ -12,10 +13,22 @@ import (
 
 func main() {
 	log.LoadConfiguration("client_log.xml")
-	client := rpc.NewClient("client_config.toml")
+	client, err := rpc.NewClientE("client_config.toml")
+	if err != nil {
+		log.Error(err)
+		return
+	}
 	// client.SetCodecType(rpc.ProtoBuffer)//默认是json序列化
 	defer client.Close()
 
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	err = client.WaitReady(ctx)
+	cancel()
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
 	for i := 0; i < 100; i++ {
 		go func() {
 			var res string
@@ -28,20 +41,21 @@ func main() {
 		}()
 	}
 
+	// typed client generated by gettygen
+	testRpc := data.NewTestRpcClient(client)
 	for i := 0; i < 100; i++ {
 		go func() {
-			var result int
-			err := client.Call("TestRpc", "Add", 1, &result)
+			result, err := testRpc.Add(context.Background(), 1)
 			if err != nil {
 				log.Error(err)
 				return
 			}
-			log.Info(result)
+			log.Info(*result)
 		}()
 	}
 
 	var errInt int
-	err := client.Call("TestRpc", "Err", 2, &errInt)
+	err = client.Call("TestRpc", "Err", 2, &errInt)
 	if err != nil {
 		log.Error(err)
 	}
@@ -10,6 +10,16 @@ type TestABC struct {
 	A, B, C string
 }
 
+//go:generate gettygen -type TestRpcService -service TestRpc -version v1.0
+
+// TestRpcService is the interface of the TestRpc service, from which gettygen generates
+// the typed TestRpcClient & RegisterTestRpcService.
+type TestRpcService interface {
+	Test(arg TestABC, res *string) error
+	Add(n int, res *int) error
+	Err(n int, res *int) error
+}
+
 type TestRpc struct {
 	i int
 }
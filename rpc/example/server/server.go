@@ -13,6 +13,6 @@ func main() {
 	if err != nil {
 		panic(jerrors.ErrorStack(err))
 	}
-	err = srv.Register(new(data.TestRpc))
+	err = data.RegisterTestRpcService(srv, new(data.TestRpc))
 	srv.Run()
 }
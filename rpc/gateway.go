@@ -0,0 +1,288 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+import (
+	log "github.com/AlexStocks/log4go"
+	jerrors "github.com/juju/errors"
+)
+
+const (
+	// GatewayTimeoutHeader is the request header which sets the timeout of a gateway call,
+	// in the time.ParseDuration format, e.g. "500ms".
+	GatewayTimeoutHeader = "Getty-Timeout"
+	// GatewayMetaHeaderPrefix is the prefix of the request headers which the default header
+	// matcher passes through as request metadata. The prefix is stripped from the meta key.
+	GatewayMetaHeaderPrefix = "Getty-Meta-"
+
+	defaultGatewayTimeout     = 3 * time.Second
+	defaultGatewayMaxBodySize = 1 << 20
+
+	// nginx's status code of the requests whose clients close the connection
+	statusClientClosedRequest = 499
+)
+
+// error codes of the gateway error body
+const (
+	GatewayInvalidArgument  = "invalid_argument"
+	GatewayNotFound         = "not_found"
+	GatewayMethodNotAllowed = "method_not_allowed"
+	GatewayBodyTooLarge     = "body_too_large"
+	GatewayUnauthenticated  = "unauthenticated"
+	GatewayRateLimited      = "rate_limited"
+	GatewayDeadlineExceeded = "deadline_exceeded"
+	GatewayCanceled         = "canceled"
+	GatewayUnavailable      = "unavailable"
+	GatewayInternal         = "internal"
+)
+
+var (
+	ErrIllegalGatewayCodec = jerrors.New("gateway client should use json codec")
+)
+
+////////////////////////////////////////////
+// Gateway Options
+////////////////////////////////////////////
+
+// HeaderMatcher returns the meta key of the http request header @key, or false if
+// the header should not be passed through. @key is in the canonical format.
+type HeaderMatcher func(key string) (string, bool)
+
+// DefaultHeaderMatcher passes through the "Getty-Meta-*" headers, whose meta keys are the
+// lowercase header keys without the prefix, and the w3c trace context headers.
+func DefaultHeaderMatcher(key string) (string, bool) {
+	if strings.HasPrefix(key, GatewayMetaHeaderPrefix) && len(key) > len(GatewayMetaHeaderPrefix) {
+		return strings.ToLower(key[len(GatewayMetaHeaderPrefix):]), true
+	}
+	switch strings.ToLower(key) {
+	case TraceparentKey, TracestateKey:
+		return strings.ToLower(key), true
+	}
+
+	return "", false
+}
+
+type gatewayOptions struct {
+	prefix        string
+	timeout       time.Duration
+	maxTimeout    time.Duration
+	maxBodySize   int64
+	headerMatcher HeaderMatcher
+}
+
+// GatewayOption modifies the options of NewGateway.
+type GatewayOption func(*gatewayOptions)
+
+// @prefix is stripped from the request path before it is parsed as "/{service}/{method}".
+func WithGatewayPrefix(prefix string) GatewayOption {
+	return func(o *gatewayOptions) {
+		o.prefix = "/" + strings.Trim(prefix, "/")
+	}
+}
+
+// @timeout is the timeout of the calls without the Getty-Timeout header. Its default value is 3s.
+func WithGatewayTimeout(timeout time.Duration) GatewayOption {
+	return func(o *gatewayOptions) {
+		o.timeout = timeout
+	}
+}
+
+// @timeout is the max value of the Getty-Timeout header. It is unlimited in default.
+func WithGatewayMaxTimeout(timeout time.Duration) GatewayOption {
+	return func(o *gatewayOptions) {
+		o.maxTimeout = timeout
+	}
+}
+
+// @size is the max size of the request body. Its default value is 1MB.
+func WithGatewayMaxBodySize(size int64) GatewayOption {
+	return func(o *gatewayOptions) {
+		o.maxBodySize = size
+	}
+}
+
+// @matcher selects the request headers which are passed through as request metadata.
+func WithHeaderMatcher(matcher HeaderMatcher) GatewayOption {
+	return func(o *gatewayOptions) {
+		o.headerMatcher = matcher
+	}
+}
+
+////////////////////////////////////////////
+// Gateway
+////////////////////////////////////////////
+
+// GatewayError is the body of the failed gateway responses:
+// {"error": {"code": "not_found", "message": "..."}}.
+type GatewayError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type gatewayErrorBody struct {
+	Error GatewayError `json:"error"`
+}
+
+// Gateway is an http.Handler which maps "POST /{service}/{method}" with a JSON body onto
+// Client.Call of its backend. The response body is the JSON reply of the method.
+type Gateway struct {
+	client *Client
+	opts   gatewayOptions
+}
+
+// NewGateway returns a gateway in front of the servers of @client, which should use json codec.
+func NewGateway(client *Client, opts ...GatewayOption) (*Gateway, error) {
+	if client.codecType != JSON {
+		return nil, ErrIllegalGatewayCodec
+	}
+	g := &Gateway{
+		client: client,
+		opts: gatewayOptions{
+			timeout:       defaultGatewayTimeout,
+			maxBodySize:   defaultGatewayMaxBodySize,
+			headerMatcher: DefaultHeaderMatcher,
+		},
+	}
+	for _, opt := range opts {
+		opt(&g.opts)
+	}
+	if g.opts.prefix == "/" {
+		g.opts.prefix = ""
+	}
+
+	return g, nil
+}
+
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeGatewayError(w, http.StatusMethodNotAllowed, GatewayMethodNotAllowed, "method "+r.Method+" is not allowed")
+		return
+	}
+	service, method, ok := g.parsePath(r.URL.Path)
+	if !ok {
+		writeGatewayError(w, http.StatusNotFound, GatewayNotFound, "path "+r.URL.Path+" is not /{service}/{method}")
+		return
+	}
+	timeout, err := g.timeout(r)
+	if err != nil {
+		writeGatewayError(w, http.StatusBadRequest, GatewayInvalidArgument, err.Error())
+		return
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, g.opts.maxBodySize+1))
+	if err != nil {
+		writeGatewayError(w, http.StatusBadRequest, GatewayInvalidArgument, "read body error: "+err.Error())
+		return
+	}
+	if int64(len(body)) > g.opts.maxBodySize {
+		writeGatewayError(w, http.StatusRequestEntityTooLarge, GatewayBodyTooLarge, "request body is too large")
+		return
+	}
+	if len(strings.TrimSpace(string(body))) == 0 {
+		body = []byte("null")
+	}
+	if !json.Valid(body) {
+		writeGatewayError(w, http.StatusBadRequest, GatewayInvalidArgument, "request body is not valid json")
+		return
+	}
+
+	meta := make(map[string]string)
+	for key, values := range r.Header {
+		if k, ok := g.opts.headerMatcher(key); ok && len(values) > 0 {
+			meta[k] = values[0]
+		}
+	}
+	ctx := r.Context()
+	if sc, ok := extractSpanContext(meta); ok {
+		ctx = ContextWithSpan(ctx, &Span{SpanContext: sc})
+	}
+	delete(meta, TraceparentKey)
+	delete(meta, TracestateKey)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var reply json.RawMessage
+	err = g.client.CallWithContext(ctx, service, method, json.RawMessage(body), &reply, WithCallMetadata(meta))
+	if err != nil {
+		status, code := gatewayStatus(err)
+		if status == http.StatusInternalServerError {
+			log.Warn("gateway call{%s.%s} = error{%s}", service, method, jerrors.ErrorStack(err))
+		}
+		writeGatewayError(w, status, code, err.Error())
+		return
+	}
+	if len(reply) == 0 {
+		reply = json.RawMessage("null")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(reply)
+}
+
+// parsePath returns the service and the method of "{prefix}/{service}/{method}".
+func (g *Gateway) parsePath(path string) (string, string, bool) {
+	if !strings.HasPrefix(path, g.opts.prefix+"/") {
+		return "", "", false
+	}
+	parts := strings.Split(path[len(g.opts.prefix)+1:], "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+
+	return parts[0], parts[1], true
+}
+
+// timeout returns the timeout of the Getty-Timeout header of @r, or the default timeout.
+func (g *Gateway) timeout(r *http.Request) (time.Duration, error) {
+	value := r.Header.Get(GatewayTimeoutHeader)
+	if value == "" {
+		return g.opts.timeout, nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		return 0, jerrors.Errorf("illegal %s header{%s}", GatewayTimeoutHeader, value)
+	}
+	if g.opts.maxTimeout > 0 && timeout > g.opts.maxTimeout {
+		timeout = g.opts.maxTimeout
+	}
+
+	return timeout, nil
+}
+
+// gatewayStatus maps the error of Client.Call to the http status code and the gateway error code.
+func gatewayStatus(err error) (int, string) {
+	switch jerrors.Cause(err) {
+	case ErrInvalidArgument:
+		return http.StatusBadRequest, GatewayInvalidArgument
+	case ErrNotFoundServiceOrMethod:
+		return http.StatusNotFound, GatewayNotFound
+	case ErrUnauthenticated:
+		return http.StatusUnauthorized, GatewayUnauthenticated
+	case ErrRateLimited:
+		return http.StatusTooManyRequests, GatewayRateLimited
+	case context.DeadlineExceeded:
+		return http.StatusGatewayTimeout, GatewayDeadlineExceeded
+	case context.Canceled:
+		return statusClientClosedRequest, GatewayCanceled
+	case ErrClientNotReady, errSessionNotExist:
+		return http.StatusServiceUnavailable, GatewayUnavailable
+	}
+
+	return http.StatusInternalServerError, GatewayInternal
+}
+
+func writeGatewayError(w http.ResponseWriter, status int, code, message string) {
+	body, _ := json.Marshal(gatewayErrorBody{Error: GatewayError{Code: code, Message: message}})
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	w.Write(body)
+}
@@ -0,0 +1,116 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+import (
+	jerrors "github.com/juju/errors"
+)
+
+// Echo is the service which replies the request metadata.
+type Echo struct{}
+
+func (e *Echo) Service() string {
+	return "Echo"
+}
+
+func (e *Echo) Version() string {
+	return "v1"
+}
+
+// Meta replies the request metadata of @key.
+func (e *Echo) Meta(ctx context.Context, key string, r *string) error {
+	*r = CallMetaFromContext(ctx)[key]
+	return nil
+}
+
+func TestGatewayStatus(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{ErrInvalidArgument, http.StatusBadRequest, GatewayInvalidArgument},
+		{ErrNotFoundServiceOrMethod, http.StatusNotFound, GatewayNotFound},
+		{ErrUnauthenticated, http.StatusUnauthorized, GatewayUnauthenticated},
+		{ErrRateLimited, http.StatusTooManyRequests, GatewayRateLimited},
+		{context.DeadlineExceeded, http.StatusGatewayTimeout, GatewayDeadlineExceeded},
+		{context.Canceled, statusClientClosedRequest, GatewayCanceled},
+		{ErrClientNotReady, http.StatusServiceUnavailable, GatewayUnavailable},
+		{errSessionNotExist, http.StatusServiceUnavailable, GatewayUnavailable},
+		{jerrors.New("handler error"), http.StatusInternalServerError, GatewayInternal},
+	}
+	for _, test := range tests {
+		err := jerrors.Annotate(test.err, "call")
+		if status, code := gatewayStatus(err); status != test.status || code != test.code {
+			t.Errorf("gatewayStatus(%v) = (%d, %s), want (%d, %s)", err, status, code, test.status, test.code)
+		}
+	}
+}
+
+func TestGateway(t *testing.T) {
+	server, port := newTestServer(t)
+	if err := server.Register(&Echo{}); err != nil {
+		t.Fatalf("Register(Echo) = error{%v}", err)
+	}
+	client := newTestClient(t, port)
+	if err := waitReady(client); err != nil {
+		t.Fatalf("WaitReady() = error{%v}", err)
+	}
+	gateway, err := NewGateway(client, WithGatewayPrefix("/rpc/"))
+	if err != nil {
+		t.Fatalf("NewGateway() = error{%v}", err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		header map[string]string
+		body   string
+		status int
+		reply  string // reply body, or the gateway error code
+	}{
+		{"call", "POST", "/rpc/Arith/Add", nil, "1", http.StatusOK, "2"},
+		{"metadata", "POST", "/rpc/Echo/Meta", map[string]string{"Getty-Meta-Caller": "alice"}, `"caller"`, http.StatusOK, `"alice"`},
+		{"get", "GET", "/rpc/Arith/Add", nil, "", http.StatusMethodNotAllowed, GatewayMethodNotAllowed},
+		{"illegal path", "POST", "/rpc/Arith", nil, "1", http.StatusNotFound, GatewayNotFound},
+		{"unknown service", "POST", "/rpc/NoSuchService/Add", nil, "1", http.StatusNotFound, GatewayNotFound},
+		{"invalid json", "POST", "/rpc/Arith/Add", nil, "{", http.StatusBadRequest, GatewayInvalidArgument},
+		{"invalid argument", "POST", "/rpc/Arith/Add", nil, `"one"`, http.StatusBadRequest, GatewayInvalidArgument},
+		{"illegal timeout", "POST", "/rpc/Arith/Add", map[string]string{GatewayTimeoutHeader: "soon"}, "1",
+			http.StatusBadRequest, GatewayInvalidArgument},
+		{"timeout", "POST", "/rpc/Arith/Sleep", map[string]string{GatewayTimeoutHeader: "100ms"}, "2000",
+			http.StatusGatewayTimeout, GatewayDeadlineExceeded},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+			for k, v := range test.header {
+				req.Header.Set(k, v)
+			}
+			rsp := httptest.NewRecorder()
+			gateway.ServeHTTP(rsp, req)
+
+			if rsp.Code != test.status {
+				t.Fatalf("status = %d, want %d, body %s", rsp.Code, test.status, rsp.Body.String())
+			}
+			if test.status == http.StatusOK {
+				if body := strings.TrimSpace(rsp.Body.String()); body != test.reply {
+					t.Errorf("reply = %s, want %s", body, test.reply)
+				}
+				return
+			}
+			var body gatewayErrorBody
+			if err := json.Unmarshal(rsp.Body.Bytes(), &body); err != nil || body.Error.Code != test.reply {
+				t.Errorf("error body = %s, want code %s", rsp.Body.String(), test.reply)
+			}
+		})
+	}
+}
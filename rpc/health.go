@@ -0,0 +1,254 @@
+package rpc
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+import (
+	"github.com/AlexStocks/getty"
+	log "github.com/AlexStocks/log4go"
+	jerrors "github.com/juju/errors"
+)
+
+const (
+	// HealthServiceName is the name of the built-in health checking service.
+	HealthServiceName = "Health"
+
+	defaultHealthWatchTimeout = 30 * time.Second
+	maxHealthWatchTimeout     = 5 * time.Minute
+)
+
+type HealthStatus string
+
+const (
+	HealthUnknown    HealthStatus = "UNKNOWN"
+	HealthServing    HealthStatus = "SERVING"
+	HealthNotServing HealthStatus = "NOT_SERVING"
+)
+
+////////////////////////////////////////////
+// health status
+////////////////////////////////////////////
+
+// healthStatus keeps the serving status of the server, whose key is "", and of its services.
+type healthStatus struct {
+	lock     sync.RWMutex
+	status   map[string]HealthStatus
+	changed  chan struct{} // closed and replaced when any status changes
+	shutdown bool
+}
+
+func newHealthStatus() *healthStatus {
+	return &healthStatus{
+		status:  map[string]HealthStatus{"": HealthServing},
+		changed: make(chan struct{}),
+	}
+}
+
+func (h *healthStatus) set(service string, status HealthStatus) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.shutdown || h.status[service] == status {
+		return
+	}
+	h.status[service] = status
+	close(h.changed)
+	h.changed = make(chan struct{})
+}
+
+// get returns the status of @service and the channel which will be closed when it changes.
+func (h *healthStatus) get(service string) (HealthStatus, <-chan struct{}) {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	status, ok := h.status[service]
+	if !ok {
+		status = HealthUnknown
+	}
+
+	return status, h.changed
+}
+
+// stop sets all status NOT_SERVING and ignores further updates.
+func (h *healthStatus) stop() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.shutdown {
+		return
+	}
+	h.shutdown = true
+	for service := range h.status {
+		h.status[service] = HealthNotServing
+	}
+	close(h.changed)
+	h.changed = make(chan struct{})
+}
+
+// SetServingStatus sets the serving status of @service, or of the whole server if @service is "".
+// Registered services are SERVING in default. It does nothing after Shutdown, which sets all
+// status NOT_SERVING.
+func (s *Server) SetServingStatus(service string, status HealthStatus) {
+	s.health.set(service, status)
+}
+
+// ServingStatus returns the serving status of @service, or of the whole server if @service is "".
+func (s *Server) ServingStatus(service string) HealthStatus {
+	status, _ := s.health.get(service)
+	return status
+}
+
+// healthHandler answers http health probes. It returns 200 if the service of the query
+// parameter "service" is SERVING, or 503 otherwise.
+func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
+	status := s.ServingStatus(r.URL.Query().Get("service"))
+	if status != HealthServing {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	w.Write([]byte(status + "\n"))
+}
+
+////////////////////////////////////////////
+// health service
+////////////////////////////////////////////
+
+type HealthCheckRequest struct {
+	// service name used by Client.Call, or "" for the whole server
+	Service string `json:"service"`
+}
+
+type HealthCheckResponse struct {
+	Status HealthStatus `json:"status"`
+}
+
+type HealthWatchRequest struct {
+	Service string `json:"service"`
+	// the status known by the client. Watch returns when the status differs from it.
+	Status HealthStatus `json:"status"`
+	// max wait time in milliseconds. its default value is 30s, and its max value is 5m.
+	TimeoutMillis int64 `json:"timeout_millis"`
+}
+
+// HealthService is registered by every server. A balancer can take the server out of
+// rotation if it is not SERVING.
+type HealthService struct {
+	server *Server
+}
+
+func (h *HealthService) Service() string {
+	return HealthServiceName
+}
+
+func (h *HealthService) Version() string {
+	return "v1"
+}
+
+// Check returns the serving status of @req.Service, which is UNKNOWN if the service does not exist.
+func (h *HealthService) Check(ctx context.Context, req *HealthCheckRequest, rsp *HealthCheckResponse) error {
+	rsp.Status = h.server.ServingStatus(req.Service)
+	return nil
+}
+
+// Watch is a long poll. It returns the serving status of @req.Service when it differs from
+// @req.Status, or when the wait time runs out. It returns the error of @ctx if the request is
+// canceled or expired, e.g. by its client or the close of its session.
+func (h *HealthService) Watch(ctx context.Context, req *HealthWatchRequest, rsp *HealthCheckResponse) error {
+	timeout := time.Duration(req.TimeoutMillis) * time.Millisecond
+	if timeout <= 0 {
+		timeout = defaultHealthWatchTimeout
+	}
+	if timeout > maxHealthWatchTimeout {
+		timeout = maxHealthWatchTimeout
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		status, changed := h.server.health.get(req.Service)
+		if status != req.Status {
+			rsp.Status = status
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-timer.C:
+			rsp.Status = status
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// registerHealth adds the health service into the service map. It is not
+// registered into the registry center.
+func (s *Server) registerHealth() {
+	s.registerBuiltinService(HealthServiceName, &HealthService{server: s})
+}
+
+////////////////////////////////////////////
+// client health check
+////////////////////////////////////////////
+
+// CheckHealth returns the serving status of @service, or of the whole server if @service is "".
+func (c *Client) CheckHealth(ctx context.Context, service string) (HealthStatus, error) {
+	var rsp HealthCheckResponse
+	if err := c.CallWithContext(ctx, HealthServiceName, "Check", &HealthCheckRequest{Service: service}, &rsp); err != nil {
+		return HealthUnknown, jerrors.Trace(err)
+	}
+
+	return rsp.Status, nil
+}
+
+// WatchHealth waits until the serving status of @service differs from @last, and returns the new
+// status. It returns the current status when the server wait time @timeout runs out, so @ctx
+// should live longer than @timeout.
+func (c *Client) WatchHealth(ctx context.Context, service string, last HealthStatus, timeout time.Duration) (HealthStatus, error) {
+	var rsp HealthCheckResponse
+	req := &HealthWatchRequest{Service: service, Status: last, TimeoutMillis: int64(timeout / time.Millisecond)}
+	if err := c.CallWithContext(ctx, HealthServiceName, "Watch", req, &rsp); err != nil {
+		return HealthUnknown, jerrors.Trace(err)
+	}
+
+	return rsp.Status, nil
+}
+
+// checkSessionHealth checks the health of the server by @session, and takes @session out of
+// rotation if the server is not SERVING. The session is kept if the check fails, whose
+// liveness is the business of the heartbeat.
+func (c *Client) checkSessionHealth(session getty.Session) {
+	defer c.setHealthChecking(session, false)
+
+	b := &GettyRPCRequest{}
+	b.header.Service = HealthServiceName
+	b.header.Method = "Check"
+	b.header.CallType = gettyTwoWay
+	b.body = &HealthCheckRequest{Service: c.conf.HealthCheckService}
+
+	var rsp HealthCheckResponse
+	resp := NewPendingResponse()
+	resp.reply = &rsp
+	if err := c.transfer(session, b, resp); err != nil {
+		log.Warn("session{%s} health check error{%s}", session.Stat(), jerrors.ErrorStack(err))
+		return
+	}
+
+	timer := time.NewTimer(c.conf.failFastTimeout)
+	defer timer.Stop()
+	select {
+	case <-resp.done:
+	case <-timer.C:
+		if c.RemovePendingResponse(resp.seq) != nil {
+			c.cancel(session, resp.seq)
+		}
+		log.Warn("session{%s} health check timeout", session.Stat())
+		return
+	}
+	if resp.err != nil {
+		log.Warn("session{%s} health check error{%s}", session.Stat(), resp.err)
+		return
+	}
+
+	c.setSessionHealth(session, rsp.Status == HealthServing)
+}
@@ -0,0 +1,109 @@
+package rpc
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestHealthCheck(t *testing.T) {
+	server, port := newTestServer(t)
+	client := newTestClient(t, port)
+	if err := waitReady(client); err != nil {
+		t.Fatalf("WaitReady() = error{%v}", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	for service, want := range map[string]HealthStatus{
+		"":              HealthServing,
+		"Arith":         HealthServing,
+		"NoSuchService": HealthUnknown,
+	} {
+		if status, err := client.CheckHealth(ctx, service); err != nil || status != want {
+			t.Errorf("CheckHealth(%q) = (%s, error{%v}), want %s", service, status, err, want)
+		}
+	}
+
+	server.SetServingStatus("Arith", HealthNotServing)
+	if status, err := client.CheckHealth(ctx, "Arith"); err != nil || status != HealthNotServing {
+		t.Errorf("CheckHealth(Arith) = (%s, error{%v}), want %s", status, err, HealthNotServing)
+	}
+}
+
+func TestHealthWatch(t *testing.T) {
+	server, port := newTestServer(t)
+	client := newTestClient(t, port)
+	if err := waitReady(client); err != nil {
+		t.Fatalf("WaitReady() = error{%v}", err)
+	}
+
+	t.Run("status changes", func(t *testing.T) {
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			server.SetServingStatus("Arith", HealthNotServing)
+		}()
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		start := time.Now()
+		status, err := client.WatchHealth(ctx, "Arith", HealthServing, 2*time.Second)
+		if err != nil || status != HealthNotServing {
+			t.Errorf("WatchHealth(Arith) = (%s, error{%v}), want %s", status, err, HealthNotServing)
+		}
+		if cost := time.Since(start); cost > time.Second {
+			t.Errorf("WatchHealth(Arith) costs %s, want about 100ms", cost)
+		}
+	})
+	t.Run("wait time runs out", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		status, err := client.WatchHealth(ctx, "Arith", HealthNotServing, 100*time.Millisecond)
+		if err != nil || status != HealthNotServing {
+			t.Errorf("WatchHealth(Arith) = (%s, error{%v}), want %s", status, err, HealthNotServing)
+		}
+	})
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		if _, err := client.WatchHealth(ctx, "Arith", HealthNotServing, time.Minute); err == nil {
+			t.Errorf("WatchHealth(Arith) after its ctx is done = nil error")
+		}
+		// the cancel frame of the client returns the server handler
+		if !waitUntil(func() bool { return server.InflightNum() == 0 }) {
+			t.Errorf("Health.Watch is still in flight after its call is canceled")
+		}
+	})
+}
+
+func TestHealthServiceWatchCtxDone(t *testing.T) {
+	h := &HealthService{server: &Server{health: newHealthStatus()}}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	var rsp HealthCheckResponse
+	start := time.Now()
+	err := h.Watch(ctx, &HealthWatchRequest{Status: HealthServing, TimeoutMillis: 60000}, &rsp)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Watch() = error{%v}, want context.DeadlineExceeded", err)
+	}
+	if cost := time.Since(start); cost > time.Second {
+		t.Errorf("Watch() costs %s after its ctx is done", cost)
+	}
+}
+
+func TestClientHealthCheck(t *testing.T) {
+	server, port := newTestServer(t)
+	client := newTestClient(t, port, WithHeartbeatPeriod(100*time.Millisecond), WithHealthCheck("Arith"))
+	if err := waitReady(client); err != nil {
+		t.Fatalf("WaitReady() = error{%v}", err)
+	}
+
+	server.SetServingStatus("Arith", HealthNotServing)
+	if !waitUntil(func() bool { return client.selectSession() == nil }) {
+		t.Fatalf("the session to the NOT_SERVING server is still in rotation")
+	}
+	server.SetServingStatus("Arith", HealthServing)
+	if !waitUntil(func() bool { return client.selectSession() != nil }) {
+		t.Fatalf("the session to the SERVING server is not put back into rotation")
+	}
+}
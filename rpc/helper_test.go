@@ -0,0 +1,115 @@
+package rpc
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Arith is the service of the tests.
+type Arith struct{}
+
+func (a *Arith) Service() string {
+	return "Arith"
+}
+
+func (a *Arith) Version() string {
+	return "v1"
+}
+
+func (a *Arith) Add(n int, r *int) error {
+	*r = n + 1
+	return nil
+}
+
+// Traceparent replies the traceparent of the server span carried by @ctx.
+func (a *Arith) Traceparent(ctx context.Context, n int, r *string) error {
+	if span := SpanFromContext(ctx); span != nil {
+		*r = span.SpanContext.Traceparent()
+	}
+	return nil
+}
+
+// Sleep replies @ms after sleeping @ms milliseconds, or returns the error of @ctx if it is done before that.
+func (a *Arith) Sleep(ctx context.Context, ms int, r *int) error {
+	select {
+	case <-time.After(time.Duration(ms) * time.Millisecond):
+		*r = ms
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// freePort returns a tcp port which is not in use now.
+func freePort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen() = error{%v}", err)
+	}
+	defer l.Close()
+
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// newTestServer starts a server of Arith on a free port, which is shut down at the end of the test.
+func newTestServer(t *testing.T, opts ...ServerOption) (*Server, int) {
+	port := freePort(t)
+	opts = append([]ServerOption{
+		WithListenAddress("127.0.0.1", strconv.Itoa(port)),
+		WithServerProfilePort(0),
+		WithServerFailFastTimeout(time.Second),
+	}, opts...)
+	server, err := NewServerWithConfig(nil, opts...)
+	if err != nil {
+		t.Fatalf("NewServerWithConfig() = error{%v}", err)
+	}
+	if err = server.Register(&Arith{}); err != nil {
+		t.Fatalf("Register(Arith) = error{%v}", err)
+	}
+	if err = server.Start(); err != nil {
+		t.Fatalf("Start() = error{%v}", err)
+	}
+	t.Cleanup(server.Stop)
+
+	return server, port
+}
+
+// newTestClient returns a client of the server on @port, which is closed at the end of the test.
+func newTestClient(t *testing.T, port int, opts ...ClientOption) *Client {
+	opts = append([]ClientOption{
+		WithServerAddress("127.0.0.1", port),
+		WithClientProfilePort(0),
+		WithConnectionNum(1),
+		WithClientFailFastTimeout(time.Second),
+	}, opts...)
+	client, err := NewClientWithConfig(nil, opts...)
+	if err != nil {
+		t.Fatalf("NewClientWithConfig() = error{%v}", err)
+	}
+	t.Cleanup(client.Close)
+
+	return client
+}
+
+// waitReady waits for the first session of @client at most 3 seconds.
+func waitReady(client *Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return client.WaitReady(ctx)
+}
+
+// waitUntil polls @cond until it returns true or 3 seconds pass, and returns its last result.
+func waitUntil(cond func() bool) bool {
+	deadline := time.Now().Add(3 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return true
+}
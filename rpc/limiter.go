@@ -0,0 +1,370 @@
+package rpc
+
+import (
+	"container/list"
+	"math"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// max bucket number of a limiter. The least recently used bucket is evicted for a new key if it
+	// is idle, otherwise the new key shares the overflow bucket of the limiter.
+	maxLimitBuckets = 4096
+
+	clientLimiterName = "client"
+	callerLimiterName = "caller"
+	methodLimiterName = "method"
+
+	// key of the statistic which aggregates the counters of the evicted buckets & the overflow bucket
+	otherLimitKey = "(other)"
+)
+
+////////////////////////////////////////////
+// tokenBucket
+////////////////////////////////////////////
+
+// tokenBucket adds @rate tokens per second and stores @burst tokens at most.
+type tokenBucket struct {
+	lock    sync.Mutex
+	key     string
+	rate    float64
+	burst   float64
+	tokens  float64
+	last    time.Time
+	counter *limitCounter
+}
+
+// limitBurst returns the bucket size of @param, which is the rate rounded up in default.
+func limitBurst(param RateLimitParam) float64 {
+	burst := float64(param.Burst)
+	if burst <= 0 {
+		burst = math.Max(1, math.Ceil(param.Rate))
+	}
+
+	return burst
+}
+
+func newTokenBucket(key string, param RateLimitParam, counter *limitCounter) *tokenBucket {
+	burst := limitBurst(param)
+
+	return &tokenBucket{
+		key:     key,
+		rate:    param.Rate,
+		burst:   burst,
+		tokens:  burst,
+		last:    time.Now(),
+		counter: counter,
+	}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed.Seconds()*b.rate)
+		b.last = now
+	}
+}
+
+// take consumes a token if there is any.
+func (b *tokenBucket) take(now time.Time) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.refill(now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+
+	return true
+}
+
+// setLimit applies @param to the bucket, whose tokens are kept within the new burst.
+func (b *tokenBucket) setLimit(param RateLimitParam, now time.Time) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.refill(now)
+	b.rate = param.Rate
+	b.burst = limitBurst(param)
+	b.tokens = math.Min(b.tokens, b.burst)
+}
+
+// refund gives back the token consumed by take, whose request is rejected by another bucket.
+func (b *tokenBucket) refund() {
+	b.lock.Lock()
+	b.tokens = math.Min(b.burst, b.tokens+1)
+	b.lock.Unlock()
+}
+
+// idle returns true if the bucket is full again, so deleting it loses nothing.
+func (b *tokenBucket) idle(now time.Time) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.refill(now)
+
+	return b.tokens >= b.burst
+}
+
+////////////////////////////////////////////
+// keyedLimiter
+////////////////////////////////////////////
+
+// limitCounter is the statistic of a bucket.
+type limitCounter struct {
+	allowed  uint64
+	rejected uint64
+}
+
+// fold adds the counts of @c into @to.
+func (c *limitCounter) fold(to *limitCounter) {
+	atomic.AddUint64(&to.allowed, atomic.LoadUint64(&c.allowed))
+	atomic.AddUint64(&to.rejected, atomic.LoadUint64(&c.rejected))
+}
+
+// keyedLimiter keeps a token bucket for every key. The keys may come from the clients, so the
+// bucket number is limited by maxLimitBuckets, and the counters of the evicted buckets are folded
+// into one aggregate instead of being kept by their keys.
+type keyedLimiter struct {
+	name      string
+	param     RateLimitParam
+	overrides map[string]RateLimitParam
+	lock      sync.RWMutex
+	buckets   map[string]*list.Element // values of the elements are *tokenBucket
+	lru       *list.List               // the most recently used bucket is at the front
+	overflow  *tokenBucket             // bucket of the new keys when all buckets are busy
+	other     *limitCounter            // counters of the evicted buckets & the overflow bucket
+}
+
+func newKeyedLimiter(name string, param RateLimitParam, overrides map[string]RateLimitParam) *keyedLimiter {
+	l := &keyedLimiter{
+		name:      name,
+		param:     param,
+		overrides: overrides,
+		buckets:   make(map[string]*list.Element),
+		lru:       list.New(),
+		other:     &limitCounter{},
+	}
+	if param.Rate > 0 {
+		l.overflow = newTokenBucket(otherLimitKey, param, l.other)
+	}
+
+	return l
+}
+
+func (l *keyedLimiter) limitParam(key string) RateLimitParam {
+	if param, ok := l.overrides[key]; ok {
+		return param
+	}
+
+	return l.param
+}
+
+// bucket returns the token bucket of @key, or nil if @key is not limited. If there are
+// maxLimitBuckets buckets already, the least recently used one is evicted for @key if it is idle,
+// otherwise @key shares the overflow bucket. The buckets of the overridden keys are never limited
+// by the number, because the keys are configured by the server.
+func (l *keyedLimiter) bucket(key string, now time.Time) *tokenBucket {
+	param := l.limitParam(key)
+	if param.Rate <= 0 {
+		return nil
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if elem := l.buckets[key]; elem != nil {
+		l.lru.MoveToFront(elem)
+		return elem.Value.(*tokenBucket)
+	}
+	if _, ok := l.overrides[key]; !ok && len(l.buckets) >= maxLimitBuckets {
+		if !l.evict(now) {
+			return l.overflow
+		}
+	}
+	bucket := newTokenBucket(key, param, &limitCounter{})
+	l.buckets[key] = l.lru.PushFront(bucket)
+
+	return bucket
+}
+
+// evict deletes the least recently used bucket if it is idle, whose counters are folded into @l.other.
+// Pls make sure that @l.lock has been locked.
+func (l *keyedLimiter) evict(now time.Time) bool {
+	elem := l.lru.Back()
+	if elem == nil {
+		return false
+	}
+	bucket := elem.Value.(*tokenBucket)
+	if !bucket.idle(now) {
+		return false
+	}
+	bucket.counter.fold(l.other)
+	l.lru.Remove(elem)
+	delete(l.buckets, bucket.key)
+
+	return true
+}
+
+// inherit takes over the buckets & counters of @old, whose tokens are kept under the limits of @l.
+// The buckets of the keys which are not limited by @l any more are evicted. The overflow bucket of
+// @l starts full.
+func (l *keyedLimiter) inherit(old *keyedLimiter) {
+	now := time.Now()
+	old.lock.RLock()
+	defer old.lock.RUnlock()
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	old.other.fold(l.other)
+	for elem := old.lru.Back(); elem != nil; elem = elem.Prev() {
+		bucket := elem.Value.(*tokenBucket)
+		param := l.limitParam(bucket.key)
+		if param.Rate <= 0 {
+			bucket.counter.fold(l.other)
+			continue
+		}
+		bucket.setLimit(param, now)
+		l.buckets[bucket.key] = l.lru.PushFront(bucket)
+	}
+}
+
+func (l *keyedLimiter) stats() []RateLimitStat {
+	l.lock.RLock()
+	stats := make([]RateLimitStat, 0, len(l.buckets)+1)
+	for key, elem := range l.buckets {
+		bucket := elem.Value.(*tokenBucket)
+		param := l.limitParam(key)
+		stats = append(stats, RateLimitStat{
+			Limiter:  l.name,
+			Key:      key,
+			Rate:     param.Rate,
+			Burst:    int(limitBurst(param)),
+			Allowed:  atomic.LoadUint64(&bucket.counter.allowed),
+			Rejected: atomic.LoadUint64(&bucket.counter.rejected),
+		})
+	}
+	allowed, rejected := atomic.LoadUint64(&l.other.allowed), atomic.LoadUint64(&l.other.rejected)
+	if allowed != 0 || rejected != 0 {
+		stats = append(stats, RateLimitStat{
+			Limiter:  l.name,
+			Key:      otherLimitKey,
+			Rate:     l.param.Rate,
+			Burst:    int(limitBurst(l.param)),
+			Allowed:  allowed,
+			Rejected: rejected,
+		})
+	}
+	l.lock.RUnlock()
+
+	return stats
+}
+
+////////////////////////////////////////////
+// rateLimiter
+////////////////////////////////////////////
+
+// RateLimitStat is the statistic of a token bucket, or of the evicted buckets & the overflow bucket of
+// a limiter whose Key is "(other)".
+type RateLimitStat struct {
+	Limiter  string  `json:"limiter"` // "client", "caller" or "method"
+	Key      string  `json:"key"`
+	Rate     float64 `json:"rate"`
+	Burst    int     `json:"burst"`
+	Allowed  uint64  `json:"allowed"`
+	Rejected uint64  `json:"rejected"`
+}
+
+// rateLimiter limits requests by remote address, by caller identity and by service method.
+type rateLimiter struct {
+	callerKey string
+	client    *keyedLimiter
+	caller    *keyedLimiter
+	method    *keyedLimiter
+}
+
+func newRateLimiter(conf RateLimitConfig) *rateLimiter {
+	return &rateLimiter{
+		callerKey: conf.CallerKey,
+		client:    newKeyedLimiter(clientLimiterName, conf.Client, nil),
+		caller:    newKeyedLimiter(callerLimiterName, conf.Caller, nil),
+		method:    newKeyedLimiter(methodLimiterName, conf.Method, conf.Methods),
+	}
+}
+
+// reload returns the limiter of @conf, which inherits the buckets & statistics of @l, so that
+// reloading the limits does not reset them. The caller limiter starts over if CallerKey changes.
+func (l *rateLimiter) reload(conf RateLimitConfig) *rateLimiter {
+	n := newRateLimiter(conf)
+	n.client.inherit(l.client)
+	n.method.inherit(l.method)
+	if n.callerKey == l.callerKey {
+		n.caller.inherit(l.caller)
+	}
+
+	return n
+}
+
+func methodKey(service, method string) string {
+	return service + "." + method
+}
+
+func remoteHost(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+
+	return host
+}
+
+// allow returns the name of the limiter which rejects the request, or "" if the request is allowed.
+// A request takes a token from every bucket only if all of them have one, so the rejected requests
+// of a caller do not drain the shared method bucket.
+func (l *rateLimiter) allow(remoteAddr string, header GettyRPCRequestHeader) string {
+	now := time.Now()
+	limiters := [...]*keyedLimiter{l.method, l.client, l.caller}
+	buckets := [...]*tokenBucket{
+		l.method.bucket(methodKey(header.Service, header.Method), now),
+		l.client.bucket(remoteHost(remoteAddr), now),
+		nil,
+	}
+	if caller := header.Meta[l.callerKey]; caller != "" {
+		buckets[2] = l.caller.bucket(caller, now)
+	}
+
+	for i, bucket := range buckets {
+		if bucket == nil || bucket.take(now) {
+			continue
+		}
+		for _, taken := range buckets[:i] {
+			if taken != nil {
+				taken.refund()
+			}
+		}
+		atomic.AddUint64(&bucket.counter.rejected, 1)
+		return limiters[i].name
+	}
+	for _, bucket := range buckets {
+		if bucket != nil {
+			atomic.AddUint64(&bucket.counter.allowed, 1)
+		}
+	}
+
+	return ""
+}
+
+func (l *rateLimiter) stats() []RateLimitStat {
+	var stats []RateLimitStat
+
+	stats = append(stats, l.client.stats()...)
+	stats = append(stats, l.caller.stats()...)
+	stats = append(stats, l.method.stats()...)
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Limiter != stats[j].Limiter {
+			return stats[i].Limiter < stats[j].Limiter
+		}
+		return stats[i].Key < stats[j].Key
+	})
+
+	return stats
+}
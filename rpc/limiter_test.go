@@ -0,0 +1,146 @@
+package rpc
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+import (
+	jerrors "github.com/juju/errors"
+)
+
+// limitStat returns the statistic of @key of @limiter in @stats.
+func limitStat(stats []RateLimitStat, limiter, key string) (RateLimitStat, bool) {
+	for _, stat := range stats {
+		if stat.Limiter == limiter && stat.Key == key {
+			return stat, true
+		}
+	}
+
+	return RateLimitStat{}, false
+}
+
+func TestRateLimiterEvictsIdleBucket(t *testing.T) {
+	l := newRateLimiter(RateLimitConfig{
+		CallerKey: "caller",
+		Caller:    RateLimitParam{Rate: 1000, Burst: 1},
+	})
+	header := GettyRPCRequestHeader{Service: "Arith", Method: "Add"}
+	for i := 0; i < maxLimitBuckets; i++ {
+		header.Meta = map[string]string{"caller": strconv.Itoa(i)}
+		if limiter := l.allow("127.0.0.1:10000", header); limiter != "" {
+			t.Fatalf("allow(caller %d) is rejected by %s limiter", i, limiter)
+		}
+	}
+	// caller 0 is used again, so caller 1 is the least recently used one
+	time.Sleep(10 * time.Millisecond)
+	header.Meta = map[string]string{"caller": "0"}
+	l.allow("127.0.0.1:10000", header)
+	// the buckets are refilled after 1ms, and the new caller evicts caller 1
+	time.Sleep(10 * time.Millisecond)
+	header.Meta = map[string]string{"caller": "new"}
+	l.allow("127.0.0.1:10000", header)
+
+	stats := l.caller.stats()
+	if len(stats) != maxLimitBuckets+1 {
+		t.Fatalf("caller stat number = %d, want %d", len(stats), maxLimitBuckets+1)
+	}
+	if _, ok := limitStat(stats, callerLimiterName, "1"); ok {
+		t.Errorf("the least recently used caller 1 is not evicted")
+	}
+	if stat, ok := limitStat(stats, callerLimiterName, otherLimitKey); !ok || stat.Allowed != 1 {
+		t.Errorf("stat of evicted callers = %+v, want 1 allowed", stat)
+	}
+	if stat, ok := limitStat(stats, callerLimiterName, "new"); !ok || stat.Allowed != 1 {
+		t.Errorf("stat of the new caller = %+v, want 1 allowed", stat)
+	}
+}
+
+func TestRateLimiterBucketCap(t *testing.T) {
+	l := newRateLimiter(RateLimitConfig{
+		CallerKey: "caller",
+		Caller:    RateLimitParam{Rate: 0.001, Burst: 1},
+	})
+	header := GettyRPCRequestHeader{Service: "Arith", Method: "Add"}
+	// a client rotates its caller identities, whose buckets are all busy
+	for i := 0; i < 2*maxLimitBuckets; i++ {
+		header.Meta = map[string]string{"caller": strconv.Itoa(i)}
+		// the keys over the cap share the overflow bucket, whose only token is taken by the first one
+		want := ""
+		if i > maxLimitBuckets {
+			want = callerLimiterName
+		}
+		if limiter := l.allow("127.0.0.1:10000", header); limiter != want {
+			t.Fatalf("allow(caller %d) = %q, want %q", i, limiter, want)
+		}
+	}
+
+	if n := len(l.caller.buckets); n != maxLimitBuckets {
+		t.Errorf("caller bucket number = %d, want %d", n, maxLimitBuckets)
+	}
+	if n := l.caller.lru.Len(); n != maxLimitBuckets {
+		t.Errorf("caller lru length = %d, want %d", n, maxLimitBuckets)
+	}
+	stat, _ := limitStat(l.stats(), callerLimiterName, otherLimitKey)
+	if stat.Allowed != 1 || stat.Rejected != maxLimitBuckets-1 {
+		t.Errorf("stat of the overflow bucket = %+v, want {allowed:1, rejected:%d}", stat, maxLimitBuckets-1)
+	}
+}
+
+func TestRateLimiterReload(t *testing.T) {
+	conf := RateLimitConfig{
+		CallerKey: "caller",
+		Method:    RateLimitParam{Rate: 0.001, Burst: 2},
+	}
+	l := newRateLimiter(conf)
+	header := GettyRPCRequestHeader{Service: "Arith", Method: "Add"}
+	for i := 0; i < 3; i++ {
+		l.allow("127.0.0.1:10000", header)
+	}
+
+	// the bucket keeps its tokens & statistic under the new burst
+	conf.Method.Burst = 10
+	l = l.reload(conf)
+	if limiter := l.allow("127.0.0.1:10000", header); limiter != methodLimiterName {
+		t.Errorf("allow() after reload = %q, want rejected by the empty method bucket", limiter)
+	}
+	stat, _ := limitStat(l.stats(), methodLimiterName, "Arith.Add")
+	if stat.Allowed != 2 || stat.Rejected != 2 || stat.Burst != 10 {
+		t.Errorf("stat after reload = %+v, want {allowed:2, rejected:2, burst:10}", stat)
+	}
+
+	// the bucket of the key which is not limited any more is pruned, and its statistic is kept
+	conf.Method = RateLimitParam{}
+	l = l.reload(conf)
+	if limiter := l.allow("127.0.0.1:10000", header); limiter != "" {
+		t.Errorf("allow() without limit = %q, want allowed", limiter)
+	}
+	stat, _ = limitStat(l.stats(), methodLimiterName, otherLimitKey)
+	if stat.Allowed != 2 || stat.Rejected != 2 {
+		t.Errorf("stat of pruned buckets = %+v, want {allowed:2, rejected:2}", stat)
+	}
+}
+
+func TestRateLimitedCall(t *testing.T) {
+	server, port := newTestServer(t, WithRateLimit(RateLimitConfig{
+		Method: RateLimitParam{Rate: 0.001, Burst: 1},
+	}))
+	client := newTestClient(t, port)
+	if err := waitReady(client); err != nil {
+		t.Fatalf("WaitReady() = error{%v}", err)
+	}
+
+	var sum int
+	if err := client.Call("Arith", "Add", 1, &sum); err != nil || sum != 2 {
+		t.Fatalf("Arith.Add(1) = (%d, error{%v}), want 2", sum, err)
+	}
+	if err := client.Call("Arith", "Add", 1, &sum); jerrors.Cause(err) != ErrRateLimited {
+		t.Fatalf("Arith.Add(1) over the limit = error{%v}, want ErrRateLimited", err)
+	}
+
+	stat, ok := limitStat(server.RateLimitStats(), methodLimiterName, "Arith.Add")
+	if !ok || stat.Allowed != 1 || stat.Rejected != 1 {
+		t.Errorf("stat of Arith.Add = %+v, want {allowed:1, rejected:1}", stat)
+	}
+}
@@ -1,8 +1,11 @@
 package rpc
 
 import (
+	"context"
 	"reflect"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -13,13 +16,45 @@ import (
 	log "github.com/AlexStocks/log4go"
 )
 
+const (
+	// max number of the goroutines which handle the concurrent requests of a batch
+	batchWorkers = 8
+)
+
 var (
 	errTooManySessions = jerrors.New("too many echo sessions")
 )
 
 type rpcSession struct {
-	session getty.Session
-	reqNum  int32
+	session   getty.Session
+	reqNum    int32
+	principal *Principal  // nil before authentication
+	authTimer *time.Timer // closes the server session if it is not authenticated in time
+	unhealthy bool        // the client session is out of rotation by health check
+	checking  bool        // the health check of the client session is in flight
+	// cancel functions of the in-flight requests of the server session by their sequences
+	cancels map[uint64]context.CancelFunc
+
+	// heartbeat of the client session
+	heartbeat     *PendingResponse // the in-flight heartbeat, nil if it has been responded
+	heartbeatSent time.Time
+	rtt           time.Duration // round trip time of the last heartbeat
+	srtt          time.Duration // smoothed round trip time, 0 before the first heartbeat response
+	missed        int           // number of the consecutive missed heartbeats
+}
+
+// latency returns the smoothed round trip time of the client session, which is doubled by
+// every missed heartbeat. The balancer prefers the session with lower latency.
+func (s *rpcSession) latency() time.Duration {
+	return s.srtt << uint(s.missed)
+}
+
+// cancelAll cancels all in-flight requests of the session.
+func (s *rpcSession) cancelAll() {
+	for seq, cancel := range s.cancels {
+		cancel()
+		delete(s.cancels, seq)
+	}
 }
 
 ////////////////////////////////////////////
@@ -27,20 +62,95 @@ type rpcSession struct {
 ////////////////////////////////////////////
 
 type RpcServerHandler struct {
+	server         *Server
 	maxSessionNum  int
 	sessionTimeout time.Duration
 	sessionMap     map[getty.Session]*rpcSession
 	rwlock         sync.RWMutex
 }
 
-func NewRpcServerHandler(maxSessionNum int, sessionTimeout time.Duration) *RpcServerHandler {
+func NewRpcServerHandler(server *Server) *RpcServerHandler {
+	conf := server.config()
 	return &RpcServerHandler{
-		maxSessionNum:  maxSessionNum,
-		sessionTimeout: sessionTimeout,
+		server:         server,
+		maxSessionNum:  conf.SessionNumber,
+		sessionTimeout: conf.sessionTimeout,
 		sessionMap:     make(map[getty.Session]*rpcSession),
 	}
 }
 
+// deleteSession removes @session and cancels its in-flight requests. It must be called with h.rwlock held.
+func (h *RpcServerHandler) deleteSession(session getty.Session) {
+	if rs, ok := h.sessionMap[session]; ok {
+		rs.cancelAll()
+		delete(h.sessionMap, session)
+	}
+}
+
+// newRequestContext returns the base context of the request @seq of @session, which is
+// canceled by the cancel frame of the client or when @session is closed. It expires after
+// @timeout if @timeout is greater than 0. Both of it and cancelRequest are called in the read
+// goroutine of @session, so the context is registered before the cancel frame of the request
+// is handled, and the time waiting for a worker of the session pool is within @timeout.
+func (h *RpcServerHandler) newRequestContext(session getty.Session, seq uint64, timeout time.Duration) context.Context {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	h.rwlock.Lock()
+	if rs, ok := h.sessionMap[session]; ok {
+		rs.cancels[seq] = cancel
+	} else {
+		cancel()
+	}
+	h.rwlock.Unlock()
+
+	return ctx
+}
+
+// finishRequest releases the context of the request @seq of @session.
+func (h *RpcServerHandler) finishRequest(session getty.Session, seq uint64) {
+	h.rwlock.Lock()
+	if rs, ok := h.sessionMap[session]; ok {
+		if cancel, ok := rs.cancels[seq]; ok {
+			cancel()
+			delete(rs.cancels, seq)
+		}
+	}
+	h.rwlock.Unlock()
+}
+
+// cancelRequest cancels the context of the request @seq of @session, whose client has given up
+// waiting for its response. The cancel frame of a finished request is ignored.
+func (h *RpcServerHandler) cancelRequest(session getty.Session, seq uint64) {
+	h.rwlock.Lock()
+	rs, ok := h.sessionMap[session]
+	if !ok {
+		h.rwlock.Unlock()
+		return
+	}
+	cancel, ok := rs.cancels[seq]
+	delete(rs.cancels, seq)
+	h.rwlock.Unlock()
+
+	if ok {
+		log.Debug("session{%s} cancels request{sequence:%d}", session.Stat(), seq)
+		cancel()
+	}
+}
+
+func (h *RpcServerHandler) setSessionParams(maxSessionNum int, sessionTimeout time.Duration) {
+	h.rwlock.Lock()
+	h.maxSessionNum = maxSessionNum
+	h.sessionTimeout = sessionTimeout
+	h.rwlock.Unlock()
+}
+
 func (h *RpcServerHandler) OnOpen(session getty.Session) error {
 	var err error
 	h.rwlock.RLock()
@@ -53,27 +163,107 @@ func (h *RpcServerHandler) OnOpen(session getty.Session) error {
 	}
 
 	log.Info("got session:%s", session.Stat())
+	rs := &rpcSession{session: session, cancels: make(map[uint64]context.CancelFunc)}
+	if h.server.authenticator() != nil {
+		rs.authTimer = time.AfterFunc(h.server.config().Auth.timeout, func() {
+			h.closeUnauthenticated(session)
+		})
+	}
 	h.rwlock.Lock()
-	h.sessionMap[session] = &rpcSession{session: session}
+	h.sessionMap[session] = rs
 	h.rwlock.Unlock()
 	return nil
 }
 
+// closeUnauthenticated closes @session if it has not been authenticated.
+func (h *RpcServerHandler) closeUnauthenticated(session getty.Session) {
+	h.rwlock.Lock()
+	rs, ok := h.sessionMap[session]
+	if !ok || rs.principal != nil {
+		h.rwlock.Unlock()
+		return
+	}
+	h.deleteSession(session)
+	h.rwlock.Unlock()
+
+	log.Warn("session{%s} is not authenticated in time, will be closed.", session.Stat())
+	session.Close()
+}
+
+// authenticate validates the credentials of the auth handshake frame @req, and stores
+// the principal in the attributes of @session. @session will be closed if it fails.
+func (h *RpcServerHandler) authenticate(session getty.Session, req GettyRPCRequestPackage) {
+	auth := h.server.authenticator()
+	if auth == nil {
+		h.replyCmd(session, req, gettyCmdAuthResponse, "")
+		return
+	}
+
+	principal, err := auth.Authenticate(&Credentials{
+		Meta:       req.header.Meta,
+		RemoteAddr: session.RemoteAddr(),
+		TLS:        tlsConnectionState(session.Conn()),
+	})
+	if err != nil {
+		log.Warn("session{%s} authentication error{%s}, will be closed.", session.Stat(), err)
+		resp := GettyPackage{
+			H: req.H,
+		}
+		resp.H.Command = gettyCmdAuthResponse
+		resp.H.Code = GettyUnauthenticated
+		resp.B = &GettyRPCResponse{
+			header: GettyRPCResponseHeader{
+				Error: err.Error(),
+			},
+		}
+		session.WritePkg(resp, 5*time.Second)
+		h.rwlock.Lock()
+		h.deleteSession(session)
+		h.rwlock.Unlock()
+		// the response in the write queue will be flushed before the session exits
+		session.Close()
+		return
+	}
+
+	session.SetAttribute(PrincipalAttrKey, principal)
+	h.rwlock.Lock()
+	if rs, ok := h.sessionMap[session]; ok {
+		rs.principal = principal
+		if rs.authTimer != nil {
+			rs.authTimer.Stop()
+		}
+	}
+	h.rwlock.Unlock()
+	log.Info("session{%s} is authenticated as %s principal{%s}", session.Stat(), principal.AuthType, principal.Name)
+	h.replyCmd(session, req, gettyCmdAuthResponse, "")
+}
+
 func (h *RpcServerHandler) OnError(session getty.Session, err error) {
 	log.Info("session{%s} got error{%v}, will be closed.", session.Stat(), err)
 	h.rwlock.Lock()
-	delete(h.sessionMap, session)
+	h.deleteSession(session)
 	h.rwlock.Unlock()
 }
 
 func (h *RpcServerHandler) OnClose(session getty.Session) {
 	log.Info("session{%s} is closing......", session.Stat())
 	h.rwlock.Lock()
-	delete(h.sessionMap, session)
+	h.deleteSession(session)
 	h.rwlock.Unlock()
 }
 
 func (h *RpcServerHandler) OnMessage(session getty.Session, pkg interface{}) {
+	if batch, ok := pkg.(GettyRPCBatchRequestPackage); ok {
+		h.handleBatch(session, batch)
+		return
+	}
+	if req, ok := pkg.(GettyRPCRequestPackage); ok && req.ticket != nil {
+		// handle the serial request after the former requests of its queue
+		ticket := req.ticket
+		req.ticket = nil
+		h.server.dispatcher.dispatch(ticket, func() { h.OnMessage(session, req) })
+		return
+	}
 	h.rwlock.Lock()
 	if _, ok := h.sessionMap[session]; ok {
 		h.sessionMap[session].reqNum++
@@ -85,18 +275,165 @@ func (h *RpcServerHandler) OnMessage(session getty.Session, pkg interface{}) {
 		log.Error("illegal packge{%#v}", pkg)
 		return
 	}
+	if req.H.Command == gettyCmdRPCRequest {
+		// it is counted by RpcServerPackageHandler.Read
+		defer atomic.AddInt32(&h.server.inflight, -1)
+	}
+	if req.ctx != nil {
+		defer h.finishRequest(session, req.H.Sequence)
+	}
 	// heartbeat
 	if req.H.Command == gettyCmdHbRequest {
 		h.replyCmd(session, req, gettyCmdHbResponse, "")
 		return
 	}
-	if req.header.CallType == gettyTwoWayNoReply {
+	if req.H.Command == gettyCmdAuthRequest {
+		h.authenticate(session, req)
+		return
+	}
+	if req.H.Command == gettyCmdCancel {
+		// it has been handled by RpcServerPackageHandler.Read
+		return
+	}
+	service, method := requestLabels(req)
+	if req.err != nil {
+		log.Warn("session{%s} request{service:%s, method:%s} = error{%s: %s}",
+			session.Stat(), req.header.Service, req.header.Method, req.code, req.err)
+		h.replyErr(session, req, req.code, req.err.Error())
+		callMetrics.observe(serverSide, service, method, req.code, 0)
+		return
+	}
+	if req.ctx != nil && req.ctx.Err() != nil {
+		log.Warn("session{%s} request{service:%s, method:%s} is expired before dispatch, error{%s}",
+			session.Stat(), req.header.Service, req.header.Method, req.ctx.Err())
+		code := GettyErrorCode(GettyDeadlineExceeded)
+		if req.ctx.Err() == context.Canceled {
+			code = GettyFail
+		}
+		h.replyErr(session, req, code, req.ctx.Err().Error())
+		callMetrics.observe(serverSide, service, method, code, 0)
+		return
+	}
+	if limiter := h.server.limiter().allow(session.RemoteAddr(), req.header); limiter != "" {
+		log.Warn("session{%s} request{service:%s, method:%s} is rejected by %s rate limiter",
+			session.Stat(), req.header.Service, req.header.Method, limiter)
+		h.replyErr(session, req, GettyRateLimited, limiter+" rate limit exceeded")
+		callMetrics.observe(serverSide, service, method, GettyRateLimited, 0)
+		return
+	}
+	start := time.Now()
+	ctx, span := h.serviceContext(session, req)
+	var err error
+	if req.methodType.handler != nil {
+		err = h.callHandler(ctx, session, req)
+	} else if req.header.CallType == gettyTwoWayNoReply {
 		h.replyCmd(session, req, gettyCmdRPCResponse, "")
-		function := req.methodType.method.Func
-		function.Call([]reflect.Value{req.service.rcvr, req.argv, req.replyv})
+		err = req.methodType.call(ctx, req.service.rcvr, req.argv, req.replyv)
+	} else {
+		err = h.callService(ctx, session, req, req.service, req.methodType, req.argv, req.replyv)
+	}
+	if span != nil {
+		span.finish(err)
+	}
+	code := GettyOK
+	if err != nil {
+		code = GettyFail
+	}
+	callMetrics.observe(serverSide, service, method, code, time.Since(start))
+}
+
+// handleBatch handles the requests of @batch in the worker of the session pool which runs it, so
+// the batch is limited by the pool as a single request is. The serial requests are put into their
+// ordered queues, and the others are handled by batchWorkers goroutines at most.
+func (h *RpcServerHandler) handleBatch(session getty.Session, batch GettyRPCBatchRequestPackage) {
+	log.Debug("session{%s} got %d batch requests", session.Stat(), len(batch.requests))
+	requests := make([]GettyRPCRequestPackage, 0, len(batch.requests))
+	for _, req := range batch.requests {
+		if req.ticket != nil {
+			// it does not block, and its handler runs in the goroutine of its queue
+			h.OnMessage(session, req)
+			continue
+		}
+		requests = append(requests, req)
+	}
+
+	workers := batchWorkers
+	if workers > len(requests) {
+		workers = len(requests)
+	}
+	queue := make(chan GettyRPCRequestPackage)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for req := range queue {
+				h.OnMessage(session, req)
+			}
+		}()
+	}
+	for _, req := range requests {
+		queue <- req
+	}
+	close(queue)
+	wg.Wait()
+}
+
+// OnDrop releases the requests of @pkg, which will not be handled because the session pool
+// has been busy for a while or the session has been closed.
+func (h *RpcServerHandler) OnDrop(session getty.Session, pkg interface{}) {
+	switch p := pkg.(type) {
+	case GettyRPCBatchRequestPackage:
+		for _, req := range p.requests {
+			h.dropRequest(session, req)
+		}
+	case GettyRPCRequestPackage:
+		h.dropRequest(session, p)
+	}
+}
+
+func (h *RpcServerHandler) dropRequest(session getty.Session, req GettyRPCRequestPackage) {
+	if req.H.Command != gettyCmdRPCRequest {
 		return
 	}
-	h.callService(session, req, req.service, req.methodType, req.argv, req.replyv)
+	log.Warn("session{%s} drops request{service:%s, method:%s, sequence:%d}",
+		session.Stat(), req.header.Service, req.header.Method, req.H.Sequence)
+	if req.ctx != nil {
+		// cancel the context, so that the ordered queue of the request skips its ticket
+		h.finishRequest(session, req.H.Sequence)
+	}
+	if req.arg != nil {
+		req.methodType.putArg(req.arg)
+	}
+	atomic.AddInt32(&h.server.inflight, -1)
+}
+
+// serviceContext returns the context passed to the service method, which carries the
+// request metadata, the principal of @session and the server span whose parent is extracted from the request metadata.
+func (h *RpcServerHandler) serviceContext(session getty.Session, req GettyRPCRequestPackage) (context.Context, *Span) {
+	ctx := req.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if req.header.Meta != nil {
+		ctx = context.WithValue(ctx, callMetaContextKey{}, req.header.Meta)
+	}
+	if principal := SessionPrincipal(session); principal != nil {
+		ctx = context.WithValue(ctx, principalContextKey{}, principal)
+	}
+
+	parent, _ := extractSpanContext(req.header.Meta)
+	span := h.server.tracer.startSpan(methodKey(req.header.Service, req.header.Method), SpanKindServer, parent)
+	if span == nil {
+		return ctx, nil
+	}
+	span.SetAttribute("rpc.system", "getty")
+	span.SetAttribute("rpc.service", req.header.Service)
+	span.SetAttribute("rpc.method", req.header.Method)
+	span.SetAttribute("net.peer.addr", session.RemoteAddr())
+	span.SetAttribute("getty.log_id", strconv.FormatUint(uint64(req.H.LogID), 10))
+
+	return ContextWithSpan(ctx, span), span
 }
 
 func (h *RpcServerHandler) OnCron(session getty.Session) {
@@ -118,12 +455,64 @@ func (h *RpcServerHandler) OnCron(session getty.Session) {
 
 	if flag {
 		h.rwlock.Lock()
-		delete(h.sessionMap, session)
+		h.deleteSession(session)
 		h.rwlock.Unlock()
 		session.Close()
 	}
 }
 
+func (h *RpcServerHandler) sessionNum() int {
+	h.rwlock.RLock()
+	defer h.rwlock.RUnlock()
+	return len(h.sessionMap)
+}
+
+func (h *RpcServerHandler) sessionInfos() []SessionInfo {
+	h.rwlock.RLock()
+	defer h.rwlock.RUnlock()
+
+	infos := make([]SessionInfo, 0, len(h.sessionMap))
+	for _, s := range h.sessionMap {
+		infos = append(infos, newSessionInfo(s))
+	}
+
+	return infos
+}
+
+// goAway asks all clients not to send new requests any more.
+func (h *RpcServerHandler) goAway() {
+	h.rwlock.RLock()
+	defer h.rwlock.RUnlock()
+	for session := range h.sessionMap {
+		pkg := GettyPackage{
+			H: GettyPackageHeader{
+				Magic:   gettyPackageMagic,
+				LogID:   (uint32)(randomID()),
+				Command: gettyCmdGoAway,
+			},
+		}
+		if err := session.WritePkg(pkg, 5*time.Second); err != nil {
+			log.Warn("session{%s}.WritePkg(go away) = error{%s}", session.Stat(), jerrors.ErrorStack(err))
+		}
+	}
+}
+
+func (h *RpcServerHandler) closeSessions() {
+	h.rwlock.Lock()
+	sessions := make([]getty.Session, 0, len(h.sessionMap))
+	for session, rs := range h.sessionMap {
+		rs.cancelAll()
+		sessions = append(sessions, session)
+	}
+	h.sessionMap = make(map[getty.Session]*rpcSession)
+	h.rwlock.Unlock()
+
+	for _, session := range sessions {
+		log.Info("close server session{%s}", session.Stat())
+		session.Close()
+	}
+}
+
 func (h *RpcServerHandler) replyCmd(session getty.Session, req GettyRPCRequestPackage, cmd gettyCommand, err string) {
 	resp := GettyPackage{
 		H: req.H,
@@ -141,15 +530,27 @@ func (h *RpcServerHandler) replyCmd(session getty.Session, req GettyRPCRequestPa
 	session.WritePkg(resp, 5*time.Second)
 }
 
-func (h *RpcServerHandler) callService(session getty.Session, req GettyRPCRequestPackage,
-	service *service, methodType *methodType, argv, replyv reflect.Value) {
+func (h *RpcServerHandler) replyErr(session getty.Session, req GettyRPCRequestPackage, code GettyErrorCode, err string) {
+	resp := GettyPackage{
+		H: req.H,
+	}
+	resp.H.Command = gettyCmdRPCResponse
+	resp.H.Code = code
+	resp.B = &GettyRPCResponse{
+		header: GettyRPCResponseHeader{
+			Error: err,
+		},
+	}
+
+	session.WritePkg(resp, 5*time.Second)
+}
+
+func (h *RpcServerHandler) callService(ctx context.Context, session getty.Session, req GettyRPCRequestPackage,
+	service *service, methodType *methodType, argv, replyv reflect.Value) error {
 
-	function := methodType.method.Func
-	returnValues := function.Call([]reflect.Value{service.rcvr, argv, replyv})
-	errInter := returnValues[0].Interface()
-	if errInter != nil {
-		h.replyCmd(session, req, gettyCmdRPCResponse, errInter.(error).Error())
-		return
+	if err := methodType.call(ctx, service.rcvr, argv, replyv); err != nil {
+		h.replyCmd(session, req, gettyCmdRPCResponse, err.Error())
+		return err
 	}
 
 	resp := GettyPackage{
@@ -162,6 +563,49 @@ func (h *RpcServerHandler) callService(session getty.Session, req GettyRPCReques
 	}
 
 	session.WritePkg(resp, 5*time.Second)
+	return nil
+}
+
+// callHandler invokes the pre-bound handler of @req. The reply is encoded before it is queued,
+// so that the pooled argument & reply can be reused at once.
+func (h *RpcServerHandler) callHandler(ctx context.Context, session getty.Session, req GettyRPCRequestPackage) error {
+	m := req.methodType
+	reply := m.getReply()
+	defer func() {
+		m.putArg(req.arg)
+		m.putReply(reply)
+	}()
+
+	if req.header.CallType == gettyTwoWayNoReply {
+		h.replyCmd(session, req, gettyCmdRPCResponse, "")
+		return m.handler.Call(ctx, req.arg, reply)
+	}
+	if err := m.handler.Call(ctx, req.arg, reply); err != nil {
+		h.replyCmd(session, req, gettyCmdRPCResponse, err.Error())
+		return err
+	}
+	body, err := Codecs[req.H.CodecType].Encode(reply)
+	if err != nil {
+		log.Warn("session{%s} encode reply of {service:%s, method:%s} = error{%s}",
+			session.Stat(), req.header.Service, req.header.Method, err)
+		h.replyCmd(session, req, gettyCmdRPCResponse, err.Error())
+		return jerrors.Trace(err)
+	}
+	if body == nil {
+		body = []byte{} // empty protobuf message
+	}
+
+	resp := GettyPackage{
+		H: req.H,
+	}
+	resp.H.Code = GettyOK
+	resp.H.Command = gettyCmdRPCResponse
+	resp.B = &GettyRPCResponse{
+		bodyData: body,
+	}
+
+	session.WritePkg(resp, 5*time.Second)
+	return nil
 }
 
 ////////////////////////////////////////////
@@ -176,9 +620,15 @@ func NewRpcClientHandler(client *Client) *RpcClientHandler {
 	return &RpcClientHandler{client: client}
 }
 
+// OnOpen adds @session into the session pool. If the client has credentials, it sends
+// the auth handshake frame instead, and @session will be added after the server accepts it.
 func (h *RpcClientHandler) OnOpen(session getty.Session) error {
-	h.client.addSession(session)
-	return nil
+	if h.client.credentials == nil {
+		h.client.addSession(session)
+		return nil
+	}
+
+	return jerrors.Trace(h.client.handshake(session))
 }
 
 func (h *RpcClientHandler) OnError(session getty.Session, err error) {
@@ -186,9 +636,12 @@ func (h *RpcClientHandler) OnError(session getty.Session, err error) {
 	h.client.removeSession(session)
 }
 
+// OnClose removes @session and fails its pending responses. They are not failed by removeSession,
+// because the responses of the session which got a go-away frame are still received until it is closed.
 func (h *RpcClientHandler) OnClose(session getty.Session) {
 	log.Info("session{%s} is closing......", session.Stat())
 	h.client.removeSession(session)
+	h.client.failPendingResponses(session)
 }
 
 func (h *RpcClientHandler) OnMessage(session getty.Session, pkg interface{}) {
@@ -198,6 +651,23 @@ func (h *RpcClientHandler) OnMessage(session getty.Session, pkg interface{}) {
 		return
 	}
 	log.Debug("get rpc response{%s}", p)
+	if p.H.Command == gettyCmdGoAway {
+		// the server is shutting down. Do not send new requests by this session any more,
+		// but its pending responses will still be received until the server closes it.
+		log.Info("session{%s} got go away frame", session.Stat())
+		h.client.removeSession(session)
+		return
+	}
+	if p.H.Command == gettyCmdAuthResponse {
+		if p.H.Code != GettyOK {
+			log.Error("session{%s} authentication error{%s}", session.Stat(), p.header.Error)
+			session.Close()
+			return
+		}
+		log.Info("session{%s} is authenticated", session.Stat())
+		h.client.addSession(session)
+		return
+	}
 	h.client.updateSession(session)
 
 	pendingResponse := h.client.RemovePendingResponse(p.H.Sequence)
@@ -205,6 +675,33 @@ func (h *RpcClientHandler) OnMessage(session getty.Session, pkg interface{}) {
 		return
 	}
 	if p.H.Command == gettyCmdHbResponse {
+		h.client.heartbeatResponded(session, pendingResponse)
+		pendingResponse.done <- struct{}{}
+		return
+	}
+	if p.H.Code == GettyRateLimited {
+		pendingResponse.err = jerrors.Annotate(ErrRateLimited, p.header.Error)
+		pendingResponse.done <- struct{}{}
+		return
+	}
+	if p.H.Code == GettyUnauthenticated {
+		pendingResponse.err = jerrors.Annotate(ErrUnauthenticated, p.header.Error)
+		pendingResponse.done <- struct{}{}
+		return
+	}
+	if p.H.Code == GettyNotFound {
+		pendingResponse.err = jerrors.Annotate(ErrNotFoundServiceOrMethod, p.header.Error)
+		pendingResponse.done <- struct{}{}
+		return
+	}
+	if p.H.Code == GettyInvalidArgument {
+		pendingResponse.err = jerrors.Annotate(ErrInvalidArgument, p.header.Error)
+		pendingResponse.done <- struct{}{}
+		return
+	}
+	if p.H.Code == GettyDeadlineExceeded {
+		pendingResponse.err = jerrors.Annotate(context.DeadlineExceeded, p.header.Error)
+		pendingResponse.done <- struct{}{}
 		return
 	}
 	if p.H.Code == GettyFail && len(p.header.Error) > 0 {
@@ -241,4 +738,11 @@ func (h *RpcClientHandler) OnCron(session getty.Session) {
 	}
 
 	h.client.heartbeat(session)
+	if h.client.conf.HealthCheck {
+		// do not wait for the response in the session handle goroutine, and skip the check
+		// if the former one is still waiting for its response
+		if h.client.setHealthChecking(session, true) {
+			go h.client.checkSessionHealth(session)
+		}
+	}
 }
@@ -0,0 +1,198 @@
+package rpc
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+import (
+	jerrors "github.com/juju/errors"
+)
+
+// Probe is the service which reports how the contexts of its calls are done.
+type Probe struct {
+	done chan error
+}
+
+func (p *Probe) Service() string {
+	return "Probe"
+}
+
+func (p *Probe) Version() string {
+	return "v1"
+}
+
+// Wait blocks until its context is done, and reports the error of the context.
+func (p *Probe) Wait(ctx context.Context, n int, r *int) error {
+	<-ctx.Done()
+	p.done <- ctx.Err()
+	return ctx.Err()
+}
+
+// newProbeServer starts a test server with the Probe service.
+func newProbeServer(t *testing.T) (*Probe, int) {
+	server, port := newTestServer(t)
+	probe := &Probe{done: make(chan error, 1)}
+	if err := server.Register(probe); err != nil {
+		t.Fatalf("Register(Probe) = error{%v}", err)
+	}
+
+	return probe, port
+}
+
+// waitProbe waits for the context of the call of @probe to be canceled.
+func waitProbe(t *testing.T, probe *Probe) {
+	select {
+	case err := <-probe.done:
+		if err != context.Canceled {
+			t.Errorf("context error of Probe.Wait = %v, want context.Canceled", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Errorf("context of Probe.Wait is not canceled")
+	}
+}
+
+func TestCancelCall(t *testing.T) {
+	probe, port := newProbeServer(t)
+	client := newTestClient(t, port)
+	if err := waitReady(client); err != nil {
+		t.Fatalf("WaitReady() = error{%v}", err)
+	}
+
+	// no deadline, which would be propagated to the handler ctx
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+	var r int
+	if err := client.CallWithContext(ctx, "Probe", "Wait", 1, &r); err == nil {
+		t.Fatalf("Probe.Wait(1) = nil error after its ctx is done")
+	}
+	// the cancel frame of the client cancels the handler ctx
+	waitProbe(t, probe)
+}
+
+func TestSessionCloseCancelsHandlers(t *testing.T) {
+	probe, port := newProbeServer(t)
+	client := newTestClient(t, port)
+	if err := waitReady(client); err != nil {
+		t.Fatalf("WaitReady() = error{%v}", err)
+	}
+
+	go func() {
+		var r int
+		client.Call("Probe", "Wait", 1, &r)
+	}()
+	if !waitUntil(func() bool { return client.PendingResponseCount() == 1 }) {
+		t.Fatalf("pending response number = %d, want 1", client.PendingResponseCount())
+	}
+	// wait for the request to be handled by the server
+	time.Sleep(100 * time.Millisecond)
+	client.Close()
+	waitProbe(t, probe)
+}
+
+// Budget is the service which reports the deadlines of its calls.
+type Budget struct {
+	client *Client
+	count  int32
+}
+
+func (b *Budget) Service() string {
+	return "Budget"
+}
+
+func (b *Budget) Version() string {
+	return "v1"
+}
+
+// Remaining replies the remaining milliseconds of its deadline, or -1 if it has no deadline.
+func (b *Budget) Remaining(ctx context.Context, n int, r *int64) error {
+	*r = -1
+	if deadline, ok := ctx.Deadline(); ok {
+		*r = int64(time.Until(deadline) / time.Millisecond)
+	}
+	return nil
+}
+
+// Relay replies the remaining milliseconds of the nested call of Remaining.
+func (b *Budget) Relay(ctx context.Context, n int, r *int64) error {
+	return b.client.Call("Budget", "Remaining", n, r, WithCallContext(ctx))
+}
+
+// Block replies @ms after sleeping @ms milliseconds.
+func (b *Budget) Block(ms int, r *int) error {
+	time.Sleep(time.Duration(ms) * time.Millisecond)
+	*r = ms
+	return nil
+}
+
+// Count counts its calls.
+func (b *Budget) Count(n int, r *int) error {
+	*r = int(atomic.AddInt32(&b.count, 1))
+	return nil
+}
+
+func TestDeadlinePropagation(t *testing.T) {
+	server, port := newTestServer(t)
+	budget := &Budget{}
+	if err := server.Register(budget); err != nil {
+		t.Fatalf("Register(Budget) = error{%v}", err)
+	}
+	budget.client = newTestClient(t, port)
+	client := newTestClient(t, port)
+	for _, c := range []*Client{budget.client, client} {
+		if err := waitReady(c); err != nil {
+			t.Fatalf("WaitReady() = error{%v}", err)
+		}
+	}
+
+	var remaining int64
+	if err := client.Call("Budget", "Remaining", 0, &remaining); err != nil || remaining != -1 {
+		t.Errorf("Budget.Remaining() without deadline = (%d, error{%v}), want -1", remaining, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := client.CallWithContext(ctx, "Budget", "Remaining", 0, &remaining); err != nil ||
+		remaining <= 0 || remaining > 1000 {
+		t.Errorf("Budget.Remaining() of 1s deadline = (%d, error{%v}), want (0, 1000]", remaining, err)
+	}
+	var relayed int64
+	if err := client.CallWithContext(ctx, "Budget", "Relay", 0, &relayed); err != nil ||
+		relayed <= 0 || relayed > remaining {
+		t.Errorf("Budget.Relay() of 1s deadline = (%d, error{%v}), want (0, %d]", relayed, err, remaining)
+	}
+}
+
+func TestExpiredBeforeDispatch(t *testing.T) {
+	server, port := newTestServer(t, WithDispatchMode("Budget", DispatchSerialSession, ""))
+	budget := &Budget{}
+	if err := server.Register(budget); err != nil {
+		t.Fatalf("Register(Budget) = error{%v}", err)
+	}
+	client := newTestClient(t, port)
+	if err := waitReady(client); err != nil {
+		t.Fatalf("WaitReady() = error{%v}", err)
+	}
+
+	go func() {
+		var r int
+		client.Call("Budget", "Block", 500, &r)
+	}()
+	if !waitUntil(func() bool { return server.InflightNum() == 1 }) {
+		t.Fatalf("in-flight request number = %d, want 1", server.InflightNum())
+	}
+	// the request expires while it waits behind Block in its ordered queue
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	var n int
+	if err := client.CallWithContext(ctx, "Budget", "Count", 1, &n); jerrors.Cause(err) != context.DeadlineExceeded {
+		t.Errorf("Budget.Count() = error{%v}, want context.DeadlineExceeded", err)
+	}
+	if !waitUntil(func() bool { return server.InflightNum() == 0 }) {
+		t.Fatalf("in-flight request number = %d, want 0", server.InflightNum())
+	}
+	if count := atomic.LoadInt32(&budget.count); count != 0 {
+		t.Errorf("expired Budget.Count() is handled %d times, want 0", count)
+	}
+}
@@ -0,0 +1,184 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+import (
+	"github.com/AlexStocks/getty"
+	jerrors "github.com/juju/errors"
+)
+
+const (
+	serverSide = "server"
+	clientSide = "client"
+
+	// service & method label of the requests whose service methods are not resolved
+	unknownLabel = "unknown"
+)
+
+var (
+	// latency histogram buckets in seconds
+	latencyBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+	callMetrics = newRPCMetrics()
+)
+
+func init() {
+	getty.RegisterMetricsCollector("rpc", callMetrics.write)
+}
+
+////////////////////////////////////////////
+// rpc metrics
+////////////////////////////////////////////
+
+type callKey struct {
+	side    string
+	service string
+	method  string
+	code    GettyErrorCode
+}
+
+type callStat struct {
+	count   uint64
+	sum     float64
+	buckets []uint64 // buckets[i] is the number of calls whose latency is not greater than latencyBuckets[i]
+}
+
+// rpcMetrics counts rpc calls and their latencies by side, service, method and error code.
+type rpcMetrics struct {
+	lock  sync.Mutex
+	stats map[callKey]*callStat
+}
+
+func newRPCMetrics() *rpcMetrics {
+	return &rpcMetrics{stats: make(map[callKey]*callStat)}
+}
+
+func (m *rpcMetrics) observe(side, service, method string, code GettyErrorCode, cost time.Duration) {
+	if !getty.MetricsEnabled() {
+		return
+	}
+
+	key := callKey{side: side, service: service, method: method, code: code}
+	seconds := cost.Seconds()
+
+	m.lock.Lock()
+	stat, ok := m.stats[key]
+	if !ok {
+		stat = &callStat{buckets: make([]uint64, len(latencyBuckets))}
+		m.stats[key] = stat
+	}
+	stat.count++
+	stat.sum += seconds
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			stat.buckets[i]++
+		}
+	}
+	m.lock.Unlock()
+}
+
+// requestLabels returns the service & method labels of the server request @req. They are the
+// real names only if the service method of @req has been resolved, so that the clients can not
+// create unlimited series by the names of their requests.
+func requestLabels(req GettyRPCRequestPackage) (string, string) {
+	if req.methodType == nil {
+		return unknownLabel, unknownLabel
+	}
+
+	return req.header.Service, req.header.Method
+}
+
+// errorCode maps the error of Client.Call to the error code of its response.
+func errorCode(err error) GettyErrorCode {
+	switch {
+	case err == nil:
+		return GettyOK
+	case jerrors.Cause(err) == ErrRateLimited:
+		return GettyRateLimited
+	case jerrors.Cause(err) == ErrUnauthenticated:
+		return GettyUnauthenticated
+	case jerrors.Cause(err) == ErrNotFoundServiceOrMethod:
+		return GettyNotFound
+	case jerrors.Cause(err) == ErrInvalidArgument:
+		return GettyInvalidArgument
+	case jerrors.Cause(err) == context.DeadlineExceeded:
+		return GettyDeadlineExceeded
+	default:
+		return GettyFail
+	}
+}
+
+func (m *rpcMetrics) write(w io.Writer) error {
+	type entry struct {
+		key  callKey
+		stat callStat
+	}
+
+	m.lock.Lock()
+	entries := make([]entry, 0, len(m.stats))
+	for key, stat := range m.stats {
+		e := entry{key: key, stat: *stat}
+		e.stat.buckets = append([]uint64(nil), stat.buckets...)
+		entries = append(entries, e)
+	}
+	m.lock.Unlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i].key, entries[j].key
+		if a.side != b.side {
+			return a.side < b.side
+		}
+		if a.service != b.service {
+			return a.service < b.service
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.code < b.code
+	})
+
+	if _, err := io.WriteString(w, "# HELP getty_rpc_requests_total Number of rpc requests.\n"+
+		"# TYPE getty_rpc_requests_total counter\n"); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if _, err := fmt.Fprintf(w, "getty_rpc_requests_total{%s} %d\n", e.key.labels(), e.stat.count); err != nil {
+			return err
+		}
+	}
+
+	if _, err := io.WriteString(w, "# HELP getty_rpc_request_duration_seconds Latency of rpc requests.\n"+
+		"# TYPE getty_rpc_request_duration_seconds histogram\n"); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		labels := e.key.labels()
+		for i, bound := range latencyBuckets {
+			if _, err := fmt.Fprintf(w, "getty_rpc_request_duration_seconds_bucket{%s,le=\"%s\"} %d\n",
+				labels, strconv.FormatFloat(bound, 'g', -1, 64), e.stat.buckets[i]); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "getty_rpc_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n"+
+			"getty_rpc_request_duration_seconds_sum{%s} %g\n"+
+			"getty_rpc_request_duration_seconds_count{%s} %d\n",
+			labels, e.stat.count, labels, e.stat.sum, labels, e.stat.count); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (k callKey) labels() string {
+	return fmt.Sprintf(`side="%s",service="%s",method="%s",code="%s"`,
+		k.side, getty.MetricsLabel(k.service), getty.MetricsLabel(k.method), k.code)
+}
@@ -0,0 +1,122 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+import (
+	"github.com/AlexStocks/getty"
+)
+
+func TestServerMetricsLabels(t *testing.T) {
+	_, port := newTestServer(t)
+	client := newTestClient(t, port)
+	if err := waitReady(client); err != nil {
+		t.Fatalf("WaitReady() = error{%v}", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	var sum int
+	if err := client.CallWithContext(ctx, "Arith", "Add", 1, &sum); err != nil {
+		t.Fatalf("Arith.Add(1) = error{%v}", err)
+	}
+	if err := client.CallWithContext(ctx, "MetricsNoSuchService", "Method", 1, &sum); err == nil {
+		t.Fatalf("MetricsNoSuchService.Method(1) succeeds")
+	}
+
+	// the server observes the call after its response has been sent
+	var buf bytes.Buffer
+	waitUntil(func() bool {
+		buf.Reset()
+		callMetrics.write(&buf)
+		return strings.Contains(buf.String(), `side="server",service="unknown",method="unknown",code="not-found"`)
+	})
+	metrics := buf.String()
+	for _, want := range []string{
+		`getty_rpc_requests_total{side="server",service="Arith",method="Add",code="ok"}`,
+		`getty_rpc_requests_total{side="server",service="unknown",method="unknown",code="not-found"}`,
+	} {
+		if !strings.Contains(metrics, want) {
+			t.Errorf("metrics do not contain %s", want)
+		}
+	}
+	if strings.Contains(metrics, `side="server",service="MetricsNoSuchService"`) {
+		t.Errorf("metrics contain the server series of the unknown service:\n%s", metrics)
+	}
+}
+
+// scrapeMetrics returns the status & body of a scrape request to getty.MetricsHandler.
+func scrapeMetrics() (int, string) {
+	rsp := httptest.NewRecorder()
+	getty.MetricsHandler().ServeHTTP(rsp, httptest.NewRequest("GET", "/metrics", nil))
+	return rsp.Code, rsp.Body.String()
+}
+
+// metricValue returns the value of the sample @series in @metrics.
+func metricValue(metrics, series string) (float64, bool) {
+	for _, line := range strings.Split(metrics, "\n") {
+		if strings.HasPrefix(line, series+" ") {
+			v, err := strconv.ParseFloat(strings.TrimPrefix(line, series+" "), 64)
+			return v, err == nil
+		}
+	}
+
+	return 0, false
+}
+
+func TestMetricsHandler(t *testing.T) {
+	_, port := newTestServer(t)
+	client := newTestClient(t, port)
+	if err := waitReady(client); err != nil {
+		t.Fatalf("WaitReady() = error{%v}", err)
+	}
+	var sum int
+	if err := client.Call("Arith", "Add", 1, &sum); err != nil {
+		t.Fatalf("Arith.Add(1) = error{%v}", err)
+	}
+
+	const (
+		clientCount = `getty_rpc_request_duration_seconds_count{side="client",service="Arith",method="Add",code="ok"}`
+		serverCount = `getty_rpc_requests_total{side="server",service="Arith",method="Add",code="ok"}`
+	)
+	var metrics string
+	waitUntil(func() bool {
+		_, metrics = scrapeMetrics()
+		_, ok := metricValue(metrics, serverCount)
+		return ok
+	})
+	for _, series := range []string{
+		`getty_sessions{endpoint="TCP_SERVER"}`,
+		`getty_sessions{endpoint="TCP_CLIENT"}`,
+		`getty_read_pkgs_total{endpoint="TCP_SERVER"}`,
+		clientCount,
+		serverCount,
+	} {
+		if v, ok := metricValue(metrics, series); !ok || v < 1 {
+			t.Errorf("metric %s = (%g, %t), want at least 1", series, v, ok)
+		}
+	}
+
+	getty.SetMetricsEnabled(false)
+	defer getty.SetMetricsEnabled(true)
+	if code, _ := scrapeMetrics(); code != http.StatusNotFound {
+		t.Errorf("scrape status of disabled metrics = %d, want %d", code, http.StatusNotFound)
+	}
+	before, _ := metricValue(metrics, clientCount)
+	if err := client.Call("Arith", "Add", 1, &sum); err != nil {
+		t.Fatalf("Arith.Add(1) = error{%v}", err)
+	}
+	var buf bytes.Buffer
+	callMetrics.write(&buf)
+	if after, _ := metricValue(buf.String(), clientCount); after != before {
+		t.Errorf("client calls observed with disabled metrics = %g, want %g", after, before)
+	}
+}
@@ -0,0 +1,291 @@
+package rpc
+
+import (
+	"context"
+	"time"
+)
+
+/////////////////////////////////////////
+// Call Options
+/////////////////////////////////////////
+
+type CallOption func(*CallOptions)
+
+type CallOptions struct {
+	meta map[string]string
+	ctx  context.Context
+}
+
+// @key & @value will be sent to the server as a request metadata.
+func WithCallMeta(key, value string) CallOption {
+	return func(o *CallOptions) {
+		if o.meta == nil {
+			o.meta = make(map[string]string)
+		}
+		o.meta[key] = value
+	}
+}
+
+// @meta will be sent to the server as request metadata.
+func WithCallMetadata(meta map[string]string) CallOption {
+	return func(o *CallOptions) {
+		if o.meta == nil {
+			o.meta = make(map[string]string, len(meta))
+		}
+		for k, v := range meta {
+			o.meta[k] = v
+		}
+	}
+}
+
+// The span carried by @ctx will be the parent of the client span of the call.
+// Pls pass the context of a service method to propagate the trace to the downstream servers.
+func WithCallContext(ctx context.Context) CallOption {
+	return func(o *CallOptions) {
+		o.ctx = ctx
+	}
+}
+
+/////////////////////////////////////////
+// Service Context
+/////////////////////////////////////////
+
+type callMetaContextKey struct{}
+
+// CallMetaFromContext returns the request metadata carried by the context of a service method.
+func CallMetaFromContext(ctx context.Context) map[string]string {
+	meta, _ := ctx.Value(callMetaContextKey{}).(map[string]string)
+	return meta
+}
+
+/////////////////////////////////////////
+// Server Options
+/////////////////////////////////////////
+
+// ServerOption modifies the ServerConfig passed to NewServerWithConfig.
+type ServerOption func(*ServerConfig)
+
+func WithServerAppName(name string) ServerOption {
+	return func(c *ServerConfig) {
+		c.AppName = name
+	}
+}
+
+// @host & @ports: server listen addresses
+func WithListenAddress(host string, ports ...string) ServerOption {
+	return func(c *ServerConfig) {
+		c.Host = host
+		c.Ports = ports
+	}
+}
+
+// @port: admin http server port, which is disabled if it is 0
+func WithServerProfilePort(port int) ServerOption {
+	return func(c *ServerConfig) {
+		c.ProfilePort = port
+	}
+}
+
+// @host & @port: admin http server address. the admin http server is disabled in default.
+// @host is the loopback address if it is empty. Pls do not expose it to the public network.
+func WithServerAdmin(host string, port int) ServerOption {
+	return func(c *ServerConfig) {
+		c.EnableAdmin = true
+		c.AdminHost = host
+		c.ProfilePort = port
+	}
+}
+
+// @codec: "json" or "protobuf"
+func WithServerCodecType(codec string) ServerOption {
+	return func(c *ServerConfig) {
+		c.CodecType = codec
+	}
+}
+
+func WithServerSessionTimeout(timeout time.Duration) ServerOption {
+	return func(c *ServerConfig) {
+		c.SessionTimeout = timeout.String()
+	}
+}
+
+// @num: max session number
+func WithSessionNumber(num int) ServerOption {
+	return func(c *ServerConfig) {
+		c.SessionNumber = num
+	}
+}
+
+func WithServerFailFastTimeout(timeout time.Duration) ServerOption {
+	return func(c *ServerConfig) {
+		c.FailFastTimeout = timeout.String()
+	}
+}
+
+func WithRateLimit(limit RateLimitConfig) ServerOption {
+	return func(c *ServerConfig) {
+		c.RateLimit = limit
+	}
+}
+
+// @name: "service" or "service.method"
+// @mode: DispatchConcurrent, DispatchSerialSession or DispatchSerialKey
+// @key: the request metadata key of the ordering key in DispatchSerialKey mode
+func WithDispatchMode(name, mode, key string) ServerOption {
+	return func(c *ServerConfig) {
+		dispatch := make(map[string]DispatchParam, len(c.Dispatch)+1)
+		for k, v := range c.Dispatch {
+			dispatch[k] = v
+		}
+		dispatch[name] = DispatchParam{Mode: mode, Key: key}
+		c.Dispatch = dispatch
+	}
+}
+
+func WithServerSessionParam(param GettySessionParam) ServerOption {
+	return func(c *ServerConfig) {
+		c.GettySessionParam = param
+	}
+}
+
+func WithServerTLS(tls TLSConfig) ServerOption {
+	return func(c *ServerConfig) {
+		c.TLS = tls
+	}
+}
+
+// @enable: whether to register the built-in reflection service, which is enabled in default
+func WithReflection(enable bool) ServerOption {
+	return func(c *ServerConfig) {
+		c.DisableReflection = !enable
+	}
+}
+
+// @auth: the authenticator config of the sessions
+func WithServerAuth(auth AuthConfig) ServerOption {
+	return func(c *ServerConfig) {
+		c.Auth = auth
+	}
+}
+
+// @registry: the server will not register its services if @registry.Addr is empty
+func WithRegistry(registry RegistryConfig) ServerOption {
+	return func(c *ServerConfig) {
+		c.Registry = registry
+	}
+}
+
+/////////////////////////////////////////
+// Client Options
+/////////////////////////////////////////
+
+// ClientOption modifies the ClientConfig passed to NewClientWithConfig.
+type ClientOption func(*ClientConfig)
+
+func WithClientAppName(name string) ClientOption {
+	return func(c *ClientConfig) {
+		c.AppName = name
+	}
+}
+
+// @host & @port: the address of the rpc server
+func WithServerAddress(host string, port int) ClientOption {
+	return func(c *ClientConfig) {
+		c.ServerHost = host
+		c.ServerPort = port
+	}
+}
+
+// @port: admin http server port, which is disabled if it is 0
+func WithClientProfilePort(port int) ClientOption {
+	return func(c *ClientConfig) {
+		c.ProfilePort = port
+	}
+}
+
+// @host & @port: admin http server address. the admin http server is disabled in default.
+// @host is the loopback address if it is empty. Pls do not expose it to the public network.
+func WithClientAdmin(host string, port int) ClientOption {
+	return func(c *ClientConfig) {
+		c.EnableAdmin = true
+		c.AdminHost = host
+		c.ProfilePort = port
+	}
+}
+
+// @num: session number of the connection pool
+func WithConnectionNum(num int) ClientOption {
+	return func(c *ClientConfig) {
+		c.ConnectionNum = num
+	}
+}
+
+// the client will not connect to the server until the first call or WaitReady, and calls
+// wait for the first session.
+func WithLazyConnect() ClientOption {
+	return func(c *ClientConfig) {
+		c.LazyConnect = true
+	}
+}
+
+func WithHeartbeatPeriod(period time.Duration) ClientOption {
+	return func(c *ClientConfig) {
+		c.HeartbeatPeriod = period.String()
+	}
+}
+
+// close the session after @num consecutive heartbeats are not responded in their heartbeat
+// periods. 0 disables it.
+func WithMaxMissedHeartbeats(num int) ClientOption {
+	return func(c *ClientConfig) {
+		c.MaxMissedHeartbeats = num
+	}
+}
+
+// check the health of @service, or of the whole server if @service is "", every heartbeat
+// period, and do not route calls to the server if it is not SERVING.
+func WithHealthCheck(service string) ClientOption {
+	return func(c *ClientConfig) {
+		c.HealthCheck = true
+		c.HealthCheckService = service
+	}
+}
+
+func WithClientSessionTimeout(timeout time.Duration) ClientOption {
+	return func(c *ClientConfig) {
+		c.SessionTimeout = timeout.String()
+	}
+}
+
+func WithClientFailFastTimeout(timeout time.Duration) ClientOption {
+	return func(c *ClientConfig) {
+		c.FailFastTimeout = timeout.String()
+	}
+}
+
+func WithClientTLS(tls TLSConfig) ClientOption {
+	return func(c *ClientConfig) {
+		c.TLS = tls
+	}
+}
+
+// @auth: the credentials config of the sessions
+func WithClientAuth(auth AuthConfig) ClientOption {
+	return func(c *ClientConfig) {
+		c.Auth = auth
+	}
+}
+
+// @credentials generates the auth handshake frame of every session, and it
+// takes precedence over the Auth config.
+func WithCredentials(credentials CredentialsFunc) ClientOption {
+	return func(c *ClientConfig) {
+		c.credentials = credentials
+	}
+}
+
+func WithClientSessionParam(param GettySessionParam) ClientOption {
+	return func(c *ClientConfig) {
+		c.GettySessionParam = param
+	}
+}
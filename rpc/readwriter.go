@@ -3,6 +3,8 @@ package rpc
 import (
 	"bytes"
 	"reflect"
+	"sync/atomic"
+	"time"
 
 	"github.com/AlexStocks/getty"
 
@@ -39,20 +41,90 @@ func (p *RpcServerPackageHandler) Read(ss getty.Session, data []byte) (interface
 		return nil, 0, jerrors.Trace(err)
 	}
 
-	req := GettyRPCRequestPackage{
-		H:      pkg.H,
-		header: pkg.B.GetHeader().(GettyRPCRequestHeader),
+	if pkg.H.Command == gettyCmdBatchRequest {
+		batch := GettyRPCBatchRequestPackage{H: pkg.H}
+		// the batch frame without any request has no body
+		if b, ok := pkg.B.(*GettyRPCBatchRequest); ok {
+			batch.requests = make([]GettyRPCRequestPackage, 0, len(b.requests))
+			for i, r := range b.requests {
+				h := pkg.H
+				h.Sequence = b.sequences[i]
+				h.Command = gettyCmdRPCRequest
+				req, err := p.readRequest(ss, h, r.header, r.GetBody())
+				if err != nil {
+					// release the former requests, which will not be handled
+					p.server.handler.OnDrop(ss, batch)
+					return nil, 0, jerrors.Trace(err)
+				}
+				batch.requests = append(batch.requests, req)
+			}
+		}
+		return batch, length, nil
+	}
+
+	req, err := p.readRequest(ss, pkg.H, pkg.B.GetHeader().(GettyRPCRequestHeader), pkg.B.GetBody())
+	if err != nil {
+		return nil, 0, jerrors.Trace(err)
 	}
-	if req.H.Command == gettyCmdHbRequest {
-		return req, length, nil
+	return req, length, nil
+}
+
+// readRequest resolves the service method of the request @header and decodes its @body.
+func (p *RpcServerPackageHandler) readRequest(ss getty.Session, h GettyPackageHeader, header GettyRPCRequestHeader, body []byte) (GettyRPCRequestPackage, error) {
+	var err error
+	req := GettyRPCRequestPackage{
+		H:      h,
+		header: header,
+	}
+	if req.H.Command == gettyCmdCancel {
+		// cancel the request here in the read goroutine, because its handler may occupy
+		// the worker of the session pool which would run OnMessage of the cancel frame.
+		p.server.handler.cancelRequest(ss, req.H.Sequence)
+		return req, nil
+	}
+	if req.H.Command == gettyCmdHbRequest || req.H.Command == gettyCmdAuthRequest {
+		return req, nil
+	}
+	// count the request from now on, so that Shutdown waits for the requests which are waiting
+	// for the workers of the session pool or for their turns in the ordered queues
+	atomic.AddInt32(&p.server.inflight, 1)
+	if p.server.authenticator() != nil && SessionPrincipal(ss) == nil {
+		// reject the request of the unauthenticated session before its service is resolved
+		// and its argument is decoded
+		req.code = GettyUnauthenticated
+		req.err = jerrors.New("session is not authenticated")
+		return req, nil
 	}
 	// get service & method
-	req.service = p.server.serviceMap[req.header.Service]
+	req.service = p.server.lookupService(req.header.Service)
 	if req.service != nil {
 		req.methodType = req.service.method[req.header.Method]
 	}
 	if req.service == nil || req.methodType == nil {
-		return nil, 0, ErrNotFoundServiceOrMethod
+		// reply the error and keep the session
+		req.code = GettyNotFound
+		req.err = jerrors.Errorf("service{%s}, method{%s}", req.header.Service, req.header.Method)
+		return req, nil
+	}
+	codec := Codecs[req.H.CodecType]
+	if codec == nil {
+		atomic.AddInt32(&p.server.inflight, -1)
+		return req, jerrors.Errorf("can not find codec for %d", req.H.CodecType)
+	}
+	req.ctx = p.server.handler.newRequestContext(ss, req.H.Sequence,
+		time.Duration(req.header.Timeout)*time.Millisecond)
+	// take the ticket in the read goroutine to keep the arrival order of the serial requests
+	req.ticket = p.server.dispatcher.ticket(req.ctx, ss, req.header)
+	// pre-bound handler
+	if req.methodType.handler != nil {
+		req.arg = req.methodType.getArg()
+		if err = codec.Decode(body, req.arg); err != nil {
+			req.methodType.putArg(req.arg)
+			req.arg = nil
+			req.code = GettyInvalidArgument
+			req.err = err
+		}
+		return req, nil
 	}
 	// get args
 	argIsValue := false
@@ -62,13 +134,11 @@ func (p *RpcServerPackageHandler) Read(ss getty.Session, data []byte) (interface
 		req.argv = reflect.New(req.methodType.ArgType)
 		argIsValue = true
 	}
-	codec := Codecs[req.H.CodecType]
-	if codec == nil {
-		return nil, 0, jerrors.Errorf("can not find codec for %d", req.H.CodecType)
-	}
-	err = codec.Decode(pkg.B.GetBody(), req.argv.Interface())
+	err = codec.Decode(body, req.argv.Interface())
 	if err != nil {
-		return nil, 0, jerrors.Trace(err)
+		req.code = GettyInvalidArgument
+		req.err = err
+		return req, nil
 	}
 	if argIsValue {
 		req.argv = req.argv.Elem()
@@ -76,7 +146,7 @@ func (p *RpcServerPackageHandler) Read(ss getty.Session, data []byte) (interface
 	// get reply
 	req.replyv = reflect.New(req.methodType.ReplyType.Elem())
 
-	return req, length, nil
+	return req, nil
 }
 
 func (p *RpcServerPackageHandler) Write(ss getty.Session, pkg interface{}) error {
@@ -0,0 +1,280 @@
+package rpc
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+import (
+	jerrors "github.com/juju/errors"
+)
+
+const (
+	// ReflectionServiceName is the name of the built-in reflection service.
+	ReflectionServiceName = "ReflectionService"
+)
+
+var (
+	typeOfTime          = reflect.TypeOf(time.Time{})
+	typeOfJSONMarshaler = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	typeOfTextMarshaler = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+////////////////////////////////////////////
+// service description
+////////////////////////////////////////////
+
+// MethodDesc describes a service method. The schemas are JSON schemas of the json codec.
+type MethodDesc struct {
+	Name        string                 `json:"name"`
+	ArgType     string                 `json:"arg_type"`
+	ReplyType   string                 `json:"reply_type"`
+	ArgSchema   map[string]interface{} `json:"arg_schema"`
+	ReplySchema map[string]interface{} `json:"reply_schema"`
+}
+
+// ServiceDesc describes a registered service. Name is the service name used by Client.Call,
+// and Service & Version are returned by its GettyRPCService interface.
+type ServiceDesc struct {
+	Name    string       `json:"name"`
+	Service string       `json:"service"`
+	Version string       `json:"version"`
+	Methods []MethodDesc `json:"methods"`
+}
+
+func newServiceDesc(svc *service) ServiceDesc {
+	desc := ServiceDesc{Name: svc.name}
+	if rcvr, ok := svc.rcvr.Interface().(GettyRPCService); ok {
+		desc.Service = rcvr.Service()
+		desc.Version = rcvr.Version()
+	}
+	for name, mtype := range svc.method {
+		desc.Methods = append(desc.Methods, MethodDesc{
+			Name:        name,
+			ArgType:     mtype.ArgType.String(),
+			ReplyType:   mtype.ReplyType.String(),
+			ArgSchema:   jsonSchema(mtype.ArgType),
+			ReplySchema: jsonSchema(mtype.ReplyType),
+		})
+	}
+	sort.Slice(desc.Methods, func(i, j int) bool {
+		return desc.Methods[i].Name < desc.Methods[j].Name
+	})
+
+	return desc
+}
+
+////////////////////////////////////////////
+// reflection service
+////////////////////////////////////////////
+
+type ListServicesRequest struct{}
+
+type ListServicesResponse struct {
+	Services []ServiceDesc `json:"services"`
+}
+
+type DescribeServiceRequest struct {
+	Service string `json:"service"`
+}
+
+// ReflectionService is registered by every server unless DisableReflection is set. Generic
+// clients can build requests by its service descriptions without compiled stubs.
+type ReflectionService struct {
+	server *Server
+}
+
+func (r *ReflectionService) Service() string {
+	return ReflectionServiceName
+}
+
+func (r *ReflectionService) Version() string {
+	return "v1"
+}
+
+// ListServices returns all registered services in name order.
+func (r *ReflectionService) ListServices(ctx context.Context, req *ListServicesRequest, rsp *ListServicesResponse) error {
+	for _, svc := range r.server.serviceList() {
+		rsp.Services = append(rsp.Services, newServiceDesc(svc))
+	}
+	sort.Slice(rsp.Services, func(i, j int) bool {
+		return rsp.Services[i].Name < rsp.Services[j].Name
+	})
+
+	return nil
+}
+
+// DescribeService returns the description of the service @req.Service.
+func (r *ReflectionService) DescribeService(ctx context.Context, req *DescribeServiceRequest, rsp *ServiceDesc) error {
+	svc := r.server.lookupService(req.Service)
+	if svc == nil {
+		return jerrors.Annotatef(ErrNotFoundServiceOrMethod, "service{%s}", req.Service)
+	}
+	*rsp = newServiceDesc(svc)
+
+	return nil
+}
+
+// registerReflection adds the reflection service into the service map. It is not
+// registered into the registry center.
+func (s *Server) registerReflection() {
+	s.registerBuiltinService(ReflectionServiceName, &ReflectionService{server: s})
+}
+
+// registerBuiltinService adds @rcvr into the service map by the name @name.
+func (s *Server) registerBuiltinService(name string, rcvr GettyRPCService) {
+	svc := &service{
+		name:   name,
+		typ:    reflect.TypeOf(rcvr),
+		rcvr:   reflect.ValueOf(rcvr),
+		method: suitableMethods(reflect.TypeOf(rcvr)),
+	}
+	s.lock.Lock()
+	s.serviceMap[name] = svc
+	s.lock.Unlock()
+	s.health.set(name, HealthServing)
+}
+
+// ListServices returns the descriptions of all services of the server by its reflection service.
+func (c *Client) ListServices(ctx context.Context) ([]ServiceDesc, error) {
+	var rsp ListServicesResponse
+	if err := c.CallWithContext(ctx, ReflectionServiceName, "ListServices", &ListServicesRequest{}, &rsp); err != nil {
+		return nil, jerrors.Trace(err)
+	}
+
+	return rsp.Services, nil
+}
+
+// DescribeService returns the description of @service by the reflection service of the server.
+func (c *Client) DescribeService(ctx context.Context, service string) (*ServiceDesc, error) {
+	var rsp ServiceDesc
+	if err := c.CallWithContext(ctx, ReflectionServiceName, "DescribeService",
+		&DescribeServiceRequest{Service: service}, &rsp); err != nil {
+		return nil, jerrors.Trace(err)
+	}
+
+	return &rsp, nil
+}
+
+////////////////////////////////////////////
+// json schema
+////////////////////////////////////////////
+
+// jsonSchema returns the JSON schema of the json encoding of @t. Named struct types
+// are put into "$defs" so that recursive types can be described.
+func jsonSchema(t reflect.Type) map[string]interface{} {
+	b := &schemaBuilder{defs: make(map[string]interface{})}
+	schema := b.schema(t)
+	if len(b.defs) != 0 {
+		schema["$defs"] = b.defs
+	}
+
+	return schema
+}
+
+type schemaBuilder struct {
+	defs map[string]interface{}
+}
+
+func (b *schemaBuilder) schema(t reflect.Type) map[string]interface{} {
+	switch {
+	case t == typeOfTime:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t.Implements(typeOfJSONMarshaler) || reflect.PtrTo(t).Implements(typeOfJSONMarshaler):
+		// its encoding is unknown
+		return map[string]interface{}{}
+	case t.Implements(typeOfTextMarshaler) || reflect.PtrTo(t).Implements(typeOfTextMarshaler):
+		return map[string]interface{}{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return b.schema(t.Elem())
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]interface{}{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Array:
+		return map[string]interface{}{"type": "array", "items": b.schema(t.Elem()),
+			"minItems": t.Len(), "maxItems": t.Len()}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.structSchema(t)
+		}
+		name := t.String()
+		if _, ok := b.defs[name]; !ok {
+			b.defs[name] = map[string]interface{}{} // placeholder for recursive types
+			b.defs[name] = b.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/$defs/" + name}
+	}
+
+	// interface or types which can not be encoded by json
+	return map[string]interface{}{}
+}
+
+func (b *schemaBuilder) structSchema(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	b.fields(t, properties)
+
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
+
+// fields adds the json fields of the struct @t into @properties. The fields of
+// embedded structs without json tags are promoted as encoding/json does.
+func (b *schemaBuilder) fields(t reflect.Type, properties map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if idx := strings.Index(tag, ","); idx >= 0 {
+			name, opts = tag[:idx], tag[idx+1:]
+		}
+
+		ft := field.Type
+		if field.Anonymous && name == "" {
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				b.fields(ft, properties)
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			continue // unexported
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if _, ok := properties[name]; ok {
+			continue
+		}
+		if strings.Contains(","+opts+",", ",string,") {
+			properties[name] = map[string]interface{}{"type": "string"}
+			continue
+		}
+		properties[name] = b.schema(ft)
+	}
+}
@@ -0,0 +1,113 @@
+package rpc
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+import (
+	jerrors "github.com/juju/errors"
+)
+
+type schemaEmbedded struct {
+	Extra float64
+}
+
+type schemaNode struct {
+	Name     string          `json:"name"`
+	Skipped  int             `json:"-"`
+	Count    int64           `json:"count,string"`
+	Data     []byte          `json:"data"`
+	At       time.Time       `json:"at"`
+	Children []*schemaNode   `json:"children"`
+	Labels   map[string]uint `json:"labels"`
+	schemaEmbedded
+	hidden int
+}
+
+func TestJSONSchema(t *testing.T) {
+	ref := map[string]interface{}{"$ref": "#/$defs/rpc.schemaNode"}
+	want := map[string]interface{}{
+		"$ref": "#/$defs/rpc.schemaNode",
+		"$defs": map[string]interface{}{
+			"rpc.schemaNode": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"name":     map[string]interface{}{"type": "string"},
+					"count":    map[string]interface{}{"type": "string"},
+					"data":     map[string]interface{}{"type": "string", "contentEncoding": "base64"},
+					"at":       map[string]interface{}{"type": "string", "format": "date-time"},
+					"children": map[string]interface{}{"type": "array", "items": ref},
+					"labels": map[string]interface{}{"type": "object",
+						"additionalProperties": map[string]interface{}{"type": "integer", "minimum": 0}},
+					"Extra": map[string]interface{}{"type": "number"},
+				},
+			},
+		},
+	}
+	if schema := jsonSchema(reflect.TypeOf(&schemaNode{})); !reflect.DeepEqual(schema, want) {
+		t.Errorf("jsonSchema(*schemaNode) = %#v, want %#v", schema, want)
+	}
+	if schema := jsonSchema(reflect.TypeOf(0)); !reflect.DeepEqual(schema, map[string]interface{}{"type": "integer"}) {
+		t.Errorf("jsonSchema(int) = %#v, want integer", schema)
+	}
+}
+
+func TestReflectionService(t *testing.T) {
+	// the service descriptions are larger than the default max message length
+	serverParam := NewServerConfig().GettySessionParam
+	serverParam.MaxMsgLen = 64 * 1024
+	_, port := newTestServer(t, WithServerSessionParam(serverParam))
+	clientParam := NewClientConfig().GettySessionParam
+	clientParam.MaxMsgLen = 64 * 1024
+	client := newTestClient(t, port, WithClientSessionParam(clientParam))
+	if err := waitReady(client); err != nil {
+		t.Fatalf("WaitReady() = error{%v}", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	services, err := client.ListServices(ctx)
+	if err != nil {
+		t.Fatalf("ListServices() = error{%v}", err)
+	}
+	var names []string
+	for _, svc := range services {
+		names = append(names, svc.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"Arith", HealthServiceName, ReflectionServiceName}) {
+		t.Errorf("ListServices() = %v, want [Arith %s %s]", names, HealthServiceName, ReflectionServiceName)
+	}
+
+	desc, err := client.DescribeService(ctx, "Arith")
+	if err != nil {
+		t.Fatalf("DescribeService(Arith) = error{%v}", err)
+	}
+	if desc.Service != "Arith" || len(desc.Methods) == 0 || desc.Methods[0].Name != "Add" {
+		t.Fatalf("DescribeService(Arith) = %+v, want the methods of Arith", desc)
+	}
+	add := desc.Methods[0]
+	if add.ArgType != "int" || add.ReplyType != "*int" || add.ArgSchema["type"] != "integer" {
+		t.Errorf("description of Arith.Add = %+v, want (int, *int)", add)
+	}
+
+	if _, err := client.DescribeService(ctx, "NoSuchService"); err == nil {
+		t.Errorf("DescribeService(NoSuchService) = nil error")
+	}
+}
+
+func TestReflectionDisabled(t *testing.T) {
+	_, port := newTestServer(t, WithReflection(false))
+	client := newTestClient(t, port)
+	if err := waitReady(client); err != nil {
+		t.Fatalf("WaitReady() = error{%v}", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if _, err := client.ListServices(ctx); jerrors.Cause(err) != ErrNotFoundServiceOrMethod {
+		t.Errorf("ListServices() of the server without reflection = error{%v}, want ErrNotFoundServiceOrMethod", err)
+	}
+}
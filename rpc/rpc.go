@@ -1,6 +1,7 @@
 package rpc
 
 import (
+	"context"
 	"reflect"
 	"sync"
 	"unicode"
@@ -9,10 +10,12 @@ import (
 
 import (
 	log "github.com/AlexStocks/log4go"
+	jerrors "github.com/juju/errors"
 )
 
 var (
-	typeOfError = reflect.TypeOf((*error)(nil)).Elem()
+	typeOfError   = reflect.TypeOf((*error)(nil)).Elem()
+	typeOfContext = reflect.TypeOf((*context.Context)(nil)).Elem()
 )
 
 type GettyRPCService interface {
@@ -20,11 +23,101 @@ type GettyRPCService interface {
 	Version() string
 }
 
+// MethodHandler is a pre-bound rpc method, which is dispatched without reflection.
+// Its argument & reply objects are pooled, so Call must not retain them after it returns.
+type MethodHandler struct {
+	// NewArg returns a new pointer into which the request body is decoded. It returns *T if the
+	// argument type T of the method is not a pointer.
+	NewArg func() interface{}
+	// NewReply returns a new reply, whose type is the reply type of the method.
+	NewReply func() interface{}
+	// Call invokes the method with the objects returned by NewArg & NewReply.
+	Call func(ctx context.Context, arg, reply interface{}) error
+}
+
+// DispatchTable maps method names to their pre-bound handlers.
+type DispatchTable map[string]*MethodHandler
+
 type methodType struct {
 	sync.Mutex
 	method    reflect.Method
+	CtxType   bool // the first argument is a context.Context
 	ArgType   reflect.Type
 	ReplyType reflect.Type
+
+	// pre-bound handler which is invoked instead of method.Func if it is not nil
+	handler   *MethodHandler
+	argPool   sync.Pool
+	replyPool sync.Pool
+}
+
+// call invokes the method of @rcvr and returns its result.
+func (m *methodType) call(ctx context.Context, rcvr, argv, replyv reflect.Value) error {
+	var in []reflect.Value
+	if m.CtxType {
+		in = []reflect.Value{rcvr, reflect.ValueOf(ctx), argv, replyv}
+	} else {
+		in = []reflect.Value{rcvr, argv, replyv}
+	}
+	returnValues := m.method.Func.Call(in)
+	if errInter := returnValues[0].Interface(); errInter != nil {
+		return errInter.(error)
+	}
+
+	return nil
+}
+
+// bind makes @m dispatched by @h, whose argument & reply types must be the same as @m's.
+func (m *methodType) bind(h *MethodHandler) error {
+	if h.NewArg == nil || h.NewReply == nil || h.Call == nil {
+		return jerrors.Errorf("handler of method %s should set NewArg, NewReply and Call", m.method.Name)
+	}
+	argType := m.ArgType
+	if argType.Kind() != reflect.Ptr {
+		argType = reflect.PtrTo(argType)
+	}
+	if t := reflect.TypeOf(h.NewArg()); t != argType {
+		return jerrors.Errorf("NewArg of method %s returns %v instead of %v", m.method.Name, t, argType)
+	}
+	if t := reflect.TypeOf(h.NewReply()); t != m.ReplyType {
+		return jerrors.Errorf("NewReply of method %s returns %v instead of %v", m.method.Name, t, m.ReplyType)
+	}
+
+	m.handler = h
+	m.argPool.New = h.NewArg
+	m.replyPool.New = h.NewReply
+	return nil
+}
+
+func (m *methodType) getArg() interface{} {
+	return m.argPool.Get()
+}
+
+func (m *methodType) putArg(arg interface{}) {
+	resetObject(arg)
+	m.argPool.Put(arg)
+}
+
+func (m *methodType) getReply() interface{} {
+	return m.replyPool.Get()
+}
+
+func (m *methodType) putReply(reply interface{}) {
+	resetObject(reply)
+	m.replyPool.Put(reply)
+}
+
+// resetObject clears the pooled pointer @obj by its Reset method, which protobuf messages have,
+// or by setting it to the zero value.
+func resetObject(obj interface{}) {
+	if r, ok := obj.(interface {
+		Reset()
+	}); ok {
+		r.Reset()
+		return
+	}
+	v := reflect.ValueOf(obj).Elem()
+	v.Set(reflect.Zero(v.Type()))
 }
 
 type service struct {
@@ -61,19 +154,24 @@ func suitableMethods(typ reflect.Type) map[string]*methodType {
 		if method.PkgPath != "" {
 			continue
 		}
-		// Method needs three ins: receiver, *args, *reply.
-		if mtype.NumIn() != 3 {
-			log.Warn("method %s has wrong number of ins %d which should be 3", mname, mtype.NumIn())
+		// Method needs three ins: receiver, *args, *reply,
+		// or four ins: receiver, context.Context, *args, *reply.
+		ctxType := mtype.NumIn() == 4 && mtype.In(1) == typeOfContext
+		argIdx := 1
+		if ctxType {
+			argIdx = 2
+		} else if mtype.NumIn() != 3 {
+			log.Warn("method %s has wrong number of ins %d which should be 3 or 4", mname, mtype.NumIn())
 			continue
 		}
 		// First arg need not be a pointer.
-		argType := mtype.In(1)
+		argType := mtype.In(argIdx)
 		if !isExportedOrBuiltinType(argType) {
 			log.Error("method{%s} argument type not exported{%v}", mname, argType)
 			continue
 		}
 		// Second arg must be a pointer.
-		replyType := mtype.In(2)
+		replyType := mtype.In(argIdx + 1)
 		if replyType.Kind() != reflect.Ptr {
 			log.Error("method{%s} reply type not a pointer{%v}", mname, replyType)
 			continue
@@ -93,7 +191,7 @@ func suitableMethods(typ reflect.Type) map[string]*methodType {
 			log.Error("method{%s}'s return type{%s} is not error", mname, returnType.String())
 			continue
 		}
-		methods[mname] = &methodType{method: method, ArgType: argType, ReplyType: replyType}
+		methods[mname] = &methodType{method: method, CtxType: ctxType, ArgType: argType, ReplyType: replyType}
 	}
 	return methods
 }
@@ -0,0 +1,105 @@
+package rpc
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// addHandler returns the pre-bound handler of Arith.Add, which adds 10 instead of 1
+// so that the tests can tell it from the reflection path, and counts its calls.
+func addHandler(calls *int32) *MethodHandler {
+	return &MethodHandler{
+		NewArg:   func() interface{} { return new(int) },
+		NewReply: func() interface{} { return new(int) },
+		Call: func(ctx context.Context, arg, reply interface{}) error {
+			atomic.AddInt32(calls, 1)
+			*reply.(*int) = *arg.(*int) + 10
+			return nil
+		},
+	}
+}
+
+func TestRegisterDispatchTable(t *testing.T) {
+	var calls int32
+	tests := []struct {
+		name  string
+		table DispatchTable
+		err   string
+	}{
+		{"unknown method", DispatchTable{"Sub": addHandler(&calls)}, "no method Sub"},
+		{"no call", DispatchTable{"Add": {NewArg: func() interface{} { return new(int) },
+			NewReply: func() interface{} { return new(int) }}}, "should set NewArg, NewReply and Call"},
+		{"arg type", DispatchTable{"Add": {NewArg: func() interface{} { return new(string) },
+			NewReply: func() interface{} { return new(int) }, Call: addHandler(&calls).Call}}, "NewArg of method Add"},
+		{"reply type", DispatchTable{"Add": {NewArg: func() interface{} { return new(int) },
+			NewReply: func() interface{} { return 0 }, Call: addHandler(&calls).Call}}, "NewReply of method Add"},
+	}
+	server, _ := newTestServer(t)
+	for _, test := range tests {
+		err := server.RegisterDispatchTable("Fast"+strings.Replace(test.name, " ", "", -1), &Arith{}, test.table)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("RegisterDispatchTable(%s) = error{%v}, want %s", test.name, err, test.err)
+		}
+	}
+}
+
+func TestDispatchTable(t *testing.T) {
+	var calls int32
+	server, port := newTestServer(t)
+	if err := server.RegisterDispatchTable("FastArith", &Arith{}, DispatchTable{"Add": addHandler(&calls)}); err != nil {
+		t.Fatalf("RegisterDispatchTable(FastArith) = error{%v}", err)
+	}
+	client := newTestClient(t, port)
+	if err := waitReady(client); err != nil {
+		t.Fatalf("WaitReady() = error{%v}", err)
+	}
+
+	// the pooled argument & reply objects are reset between the calls
+	for i := 1; i <= 3; i++ {
+		var sum int
+		if err := client.Call("FastArith", "Add", i, &sum); err != nil || sum != i+10 {
+			t.Errorf("FastArith.Add(%d) = (%d, error{%v}), want %d by the pre-bound handler", i, sum, err, i+10)
+		}
+	}
+	if n := atomic.LoadInt32(&calls); n != 3 {
+		t.Errorf("pre-bound handler calls = %d, want 3", n)
+	}
+	// the methods out of the table fall back to reflection
+	var ms int
+	if err := client.Call("FastArith", "Sleep", 1, &ms); err != nil || ms != 1 {
+		t.Errorf("FastArith.Sleep(1) = (%d, error{%v}), want 1", ms, err)
+	}
+	var sum int
+	if err := client.Call("Arith", "Add", 1, &sum); err != nil || sum != 2 {
+		t.Errorf("Arith.Add(1) = (%d, error{%v}), want 2 by reflection", sum, err)
+	}
+}
+
+type resettable struct {
+	n     int
+	reset bool
+}
+
+func (r *resettable) Reset() {
+	*r = resettable{reset: true}
+}
+
+func TestResetObject(t *testing.T) {
+	n := 3
+	resetObject(&n)
+	if n != 0 {
+		t.Errorf("resetObject(*int) = %d, want 0", n)
+	}
+	s := struct{ A []int }{A: []int{1}}
+	resetObject(&s)
+	if s.A != nil {
+		t.Errorf("resetObject(*struct) = %+v, want zero value", s)
+	}
+	r := &resettable{n: 1}
+	resetObject(r)
+	if !r.reset || r.n != 0 {
+		t.Errorf("resetObject(Reset()) = %+v, want reset by its Reset method", r)
+	}
+}
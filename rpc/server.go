@@ -1,13 +1,16 @@
 package rpc
 
 import (
-	"fmt"
+	"context"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
@@ -23,30 +26,92 @@ import (
 )
 
 type Server struct {
-	conf          *ServerConfig
-	serviceMap    map[string]*service
-	tcpServerList []getty.Server
-	registry      gxregistry.Registry
-	sa            gxregistry.ServiceAttr
-	nodes         []*gxregistry.Node
+	confFile     string
+	reloadLock   sync.Mutex   // serializes reloads
+	lock         sync.RWMutex // for conf, rateLimiter, serviceMap, tcpServerMap, nodes, services & auth
+	conf         *ServerConfig
+	serviceMap   map[string]*service
+	tcpServerMap map[string]getty.Server // port -> getty server
+	registry     gxregistry.Registry
+	sa           gxregistry.ServiceAttr
+	nodes        []*gxregistry.Node
+	services     []gxregistry.Service // services registered in the registry
+	rateLimiter  *rateLimiter
+	dispatcher   *dispatcher
+	handler      *RpcServerHandler
+	admin        *http.Server
+	tracer       tracer
+	auth         Authenticator
+	health       *healthStatus
+
+	inflight int32 // number of requests which have been read but not finished
+	draining int32
+	stopOnce sync.Once
 }
 
+const (
+	drainCheckInterval = 10 * time.Millisecond
+)
+
 var (
 	ErrIllegalCodecType = jerrors.New("illegal codec type")
 )
 
 func NewServer(confFile string) (*Server, error) {
-	conf := loadServerConf(confFile)
-	if conf.codecType = String2CodecType(conf.CodecType); conf.codecType == gettyCodecUnknown {
-		return nil, ErrIllegalCodecType
+	conf, err := loadServerConf(confFile)
+	if err != nil {
+		return nil, jerrors.Trace(err)
+	}
+
+	s, err := NewServerWithConfig(conf)
+	if err != nil {
+		return nil, jerrors.Trace(err)
+	}
+	s.confFile = confFile
+
+	return s, nil
+}
+
+// NewServerWithConfig creates a server by @conf, which is NewServerConfig() if it is nil,
+// and @opts. @conf will not be modified. The server created by it can not be reloaded.
+func NewServerWithConfig(conf *ServerConfig, opts ...ServerOption) (*Server, error) {
+	if conf == nil {
+		conf = NewServerConfig()
+	}
+	c := *conf
+	conf = &c
+	for _, opt := range opts {
+		opt(conf)
+	}
+	if err := conf.CheckValidity(); err != nil {
+		return nil, jerrors.Trace(err)
+	}
+	if conf.LogConfFile != "" {
+		log.LoadConfiguration(conf.LogConfFile)
 	}
 
 	s := &Server{
-		serviceMap: make(map[string]*service),
-		conf:       conf,
+		serviceMap:   make(map[string]*service),
+		tcpServerMap: make(map[string]getty.Server),
+		conf:         conf,
+		rateLimiter:  newRateLimiter(conf.RateLimit),
+		dispatcher:   newDispatcher(conf.Dispatch),
+		health:       newHealthStatus(),
+	}
+	s.handler = NewRpcServerHandler(s)
+	s.registerHealth()
+	if !conf.DisableReflection {
+		s.registerReflection()
+	}
+	exporter, err := newSpanExporter(conf.Tracing)
+	if err != nil {
+		return nil, jerrors.Trace(err)
+	}
+	s.tracer.setExporter(exporter)
+	if s.auth, err = newAuthenticator(conf.Auth); err != nil {
+		return nil, jerrors.Trace(err)
 	}
 
-	var err error
 	var registry gxregistry.Registry
 	if len(s.conf.Registry.Addr) != 0 {
 		addrList := strings.Split(s.conf.Registry.Addr, ",")
@@ -75,54 +140,114 @@ func NewServer(confFile string) (*Server, error) {
 				Role:     gxregistry.SRT_Provider,
 				Protocol: s.conf.CodecType,
 			}
-
-			for _, p := range s.conf.Ports {
-				port, err := strconv.Atoi(p)
-				if err != nil {
-					return nil, jerrors.New(fmt.Sprintf("illegal port %s", p))
-				}
-
-				s.nodes = append(s.nodes,
-					&gxregistry.Node{
-						ID:      s.conf.Registry.NodeID + "-" + net.JoinHostPort(s.conf.Host, p),
-						Address: s.conf.Host,
-						Port:    int32(port)})
-			}
+			s.nodes = s.registryNodes(s.conf.Ports)
 		}
 	}
 
 	return s, nil
 }
 
+func (s *Server) registryNodes(ports []string) []*gxregistry.Node {
+	var nodes []*gxregistry.Node
+
+	for _, p := range ports {
+		// @p has been checked in (ServerConfig)CheckValidity
+		port, _ := strconv.Atoi(p)
+		nodes = append(nodes,
+			&gxregistry.Node{
+				ID:      s.conf.Registry.NodeID + "-" + net.JoinHostPort(s.conf.Host, p),
+				Address: s.conf.Host,
+				Port:    int32(port)})
+	}
+
+	return nodes
+}
+
+// config returns current config, which may be replaced by reload.
+func (s *Server) config() *ServerConfig {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.conf
+}
+
+// SetSpanExporter sets the exporter of the server spans. Tracing is disabled if @exporter is nil,
+// except that the spans whose parents come from the clients are still propagated.
+func (s *Server) SetSpanExporter(exporter SpanExporter) {
+	s.tracer.setExporter(exporter)
+}
+
+// SetAuthenticator sets the authenticator of new sessions, which must send an auth handshake frame
+// before any request. Authentication is disabled if @auth is nil. Pls invoke it before Start.
+func (s *Server) SetAuthenticator(auth Authenticator) {
+	s.lock.Lock()
+	s.auth = auth
+	s.lock.Unlock()
+}
+
+func (s *Server) authenticator() Authenticator {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.auth
+}
+
+func (s *Server) limiter() *rateLimiter {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.rateLimiter
+}
+
+// Run starts the server and handles the signals until the server stops. It exits the process
+// by log.Exit at last. Pls use Start & Shutdown instead if the app manages its own lifecycle.
 func (s *Server) Run() {
 	s.Init()
-	log.Info("%s starts successfull! its version=%s, its listen ends=%s:%s\n",
-		s.conf.AppName, getty.Version, s.conf.Host, s.conf.Ports)
-	s.initSignal()
+	HandleSignals(s)
+	log.Exit("app exit now...")
+	log.Close()
 }
 
+// Register publishes the methods of @rcvr as the service whose name is the type name of @rcvr.
 func (s *Server) Register(rcvr GettyRPCService) error {
+	name := reflect.Indirect(reflect.ValueOf(rcvr)).Type().Name()
+	if name == "" {
+		s := "rpc.Register: no service name for type " + reflect.TypeOf(rcvr).String()
+		log.Error(s)
+		return jerrors.New(s)
+	}
+	if !isExported(name) {
+		s := "rpc.Register: type " + name + " is not exported"
+		log.Error(s)
+		return jerrors.New(s)
+	}
+
+	return jerrors.Trace(s.RegisterName(name, rcvr))
+}
+
+// RegisterName is like Register but uses @name as the service name instead of the type
+// name of @rcvr.
+func (s *Server) RegisterName(name string, rcvr GettyRPCService) error {
+	return jerrors.Trace(s.register(name, rcvr, nil))
+}
+
+// RegisterDispatchTable is like RegisterName, but the methods in @table are dispatched by their
+// pre-bound handlers without reflection, and the other methods of @rcvr still fall back to
+// reflection. It is used by the service stubs generated by cmd/gettygen.
+func (s *Server) RegisterDispatchTable(name string, rcvr GettyRPCService, table DispatchTable) error {
+	return jerrors.Trace(s.register(name, rcvr, table))
+}
+
+func (s *Server) register(name string, rcvr GettyRPCService, table DispatchTable) error {
 	svc := &service{
 		typ:  reflect.TypeOf(rcvr),
 		rcvr: reflect.ValueOf(rcvr),
-		name: reflect.Indirect(reflect.ValueOf(rcvr)).Type().Name(),
+		name: name,
 		// Install the methods
 		method: suitableMethods(reflect.TypeOf(rcvr)),
 	}
 	if svc.name == "" {
-		s := "rpc.Register: no service name for type " + svc.typ.String()
-		log.Error(s)
-		return jerrors.New(s)
-	}
-	if !isExported(svc.name) {
-		s := "rpc.Register: type " + svc.name + " is not exported"
+		s := "rpc.RegisterName: empty service name for type " + svc.typ.String()
 		log.Error(s)
 		return jerrors.New(s)
 	}
-	if _, present := s.serviceMap[svc.name]; present {
-		return jerrors.New("rpc: service already defined: " + svc.name)
-	}
-
 	if len(svc.method) == 0 {
 		// To help the user, see if a pointer receiver would work.
 		method := suitableMethods(reflect.PtrTo(svc.typ))
@@ -136,7 +261,23 @@ func (s *Server) Register(rcvr GettyRPCService) error {
 		return jerrors.New(str)
 	}
 
+	for mname, handler := range table {
+		mtype, ok := svc.method[mname]
+		if !ok {
+			return jerrors.Errorf("rpc.Register: type %s has no method %s of suitable type", svc.name, mname)
+		}
+		if err := mtype.bind(handler); err != nil {
+			return jerrors.Trace(err)
+		}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, present := s.serviceMap[svc.name]; present {
+		return jerrors.New("rpc: service already defined: " + svc.name)
+	}
 	s.serviceMap[svc.name] = svc
+	s.health.set(svc.name, HealthServing)
 	if s.registry != nil {
 		sa := s.sa
 		sa.Service = rcvr.Service()
@@ -145,97 +286,416 @@ func (s *Server) Register(rcvr GettyRPCService) error {
 		if err := s.registry.Register(service); err != nil {
 			return jerrors.Trace(err)
 		}
+		s.services = append(s.services, service)
 	}
 
 	return nil
 }
 
-func (s *Server) newSession(session getty.Session) error {
-	var (
-		ok      bool
-		tcpConn *net.TCPConn
-	)
+// lookupService returns the service @name, or nil if it has not been registered.
+func (s *Server) lookupService(name string) *service {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.serviceMap[name]
+}
 
-	if s.conf.GettySessionParam.CompressEncoding {
-		session.SetCompressType(getty.CompressZip)
+// serviceList returns all registered services, including the built-in ones.
+func (s *Server) serviceList() []*service {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	services := make([]*service, 0, len(s.serviceMap))
+	for _, svc := range s.serviceMap {
+		services = append(services, svc)
 	}
 
-	if tcpConn, ok = session.Conn().(*net.TCPConn); !ok {
-		panic(fmt.Sprintf("%s, session.conn{%#v} is not tcp connection\n", session.Stat(), session.Conn()))
-	}
+	return services
+}
 
-	tcpConn.SetNoDelay(s.conf.GettySessionParam.TcpNoDelay)
-	tcpConn.SetKeepAlive(s.conf.GettySessionParam.TcpKeepAlive)
-	if s.conf.GettySessionParam.TcpKeepAlive {
-		tcpConn.SetKeepAlivePeriod(s.conf.GettySessionParam.keepAlivePeriod)
+func (s *Server) newSession(session getty.Session) error {
+	conf := s.config()
+	if conf.GettySessionParam.CompressEncoding {
+		session.SetCompressType(getty.CompressZip)
 	}
-	tcpConn.SetReadBuffer(s.conf.GettySessionParam.TcpRBufSize)
-	tcpConn.SetWriteBuffer(s.conf.GettySessionParam.TcpWBufSize)
 
-	session.SetName(s.conf.GettySessionParam.SessionName)
-	session.SetMaxMsgLen(s.conf.GettySessionParam.MaxMsgLen)
+	setTCPParams(session.Conn(), &conf.GettySessionParam)
+
+	session.SetName(conf.GettySessionParam.SessionName)
+	session.SetMaxMsgLen(conf.GettySessionParam.MaxMsgLen)
 	session.SetPkgHandler(NewRpcServerPackageHandler(s))
-	session.SetEventListener(NewRpcServerHandler(s.conf.SessionNumber, s.conf.sessionTimeout))
-	session.SetRQLen(s.conf.GettySessionParam.PkgRQSize)
-	session.SetWQLen(s.conf.GettySessionParam.PkgWQSize)
-	session.SetReadTimeout(s.conf.GettySessionParam.tcpReadTimeout)
-	session.SetWriteTimeout(s.conf.GettySessionParam.tcpWriteTimeout)
-	session.SetCronPeriod((int)(s.conf.sessionTimeout.Nanoseconds() / 1e6))
-	session.SetWaitTime(s.conf.GettySessionParam.waitTimeout)
+	session.SetEventListener(s.handler)
+	session.SetRQLen(conf.GettySessionParam.PkgRQSize)
+	session.SetWQLen(conf.GettySessionParam.PkgWQSize)
+	session.SetReadTimeout(conf.GettySessionParam.tcpReadTimeout)
+	session.SetWriteTimeout(conf.GettySessionParam.tcpWriteTimeout)
+	session.SetCronPeriod((int)(conf.sessionTimeout.Nanoseconds() / 1e6))
+	session.SetWaitTime(conf.GettySessionParam.waitTimeout)
 	log.Debug("app accepts new session:%s\n", session.Stat())
 
 	return nil
 }
 
+// listen starts a getty server of @conf on @port.
+func (s *Server) listen(conf *ServerConfig, port string) (tcpServer getty.Server, err error) {
+	addr := port
+	if conf.Transport != TransportUnix {
+		addr = gxnet.HostAddress2(conf.Host, port)
+	}
+	defer func() {
+		// getty.Server.RunEventLoop panics if it fails to listen on @addr
+		if r := recover(); r != nil {
+			tcpServer = nil
+			err = jerrors.Errorf("failed to listen on %s: %v", addr, r)
+		}
+	}()
+
+	tcpServer = newGettyServer(conf, port)
+	tcpServer.RunEventLoop(s.newSession)
+	log.Debug("s bind addr{%s} ok!", addr)
+
+	return tcpServer, nil
+}
+
+// Init starts the server as Start does, but it panics on error.
 func (s *Server) Init() {
-	var (
-		addr      string
-		portList  []string
-		tcpServer getty.Server
-	)
+	if err := s.Start(); err != nil {
+		panic(jerrors.ErrorStack(err))
+	}
+}
+
+// Start listens on all ports and starts the admin server. It does not block,
+// and it does not touch the signal handlers or the global logger.
+func (s *Server) Start() error {
+	if s.IsDraining() {
+		return jerrors.New("server is stopping")
+	}
+
+	conf := s.config()
+	if len(conf.Ports) == 0 {
+		return jerrors.New("portList is nil")
+	}
 
-	portList = s.conf.Ports
-	if len(portList) == 0 {
-		panic("portList is nil")
+	s.lock.RLock()
+	started := len(s.tcpServerMap) != 0
+	s.lock.RUnlock()
+	if started {
+		return jerrors.New("server has been started")
 	}
-	for _, port := range portList {
-		addr = gxnet.HostAddress2(s.conf.Host, port)
-		tcpServer = getty.NewTCPServer(
-			getty.WithLocalAddress(addr),
-		)
-		tcpServer.RunEventLoop(s.newSession)
-		log.Debug("s bind addr{%s} ok!", addr)
-		s.tcpServerList = append(s.tcpServerList, tcpServer)
+
+	tcpServerMap := make(map[string]getty.Server, len(conf.Ports))
+	for _, port := range conf.Ports {
+		tcpServer, err := s.listen(conf, port)
+		if err != nil {
+			for _, tcpServer := range tcpServerMap {
+				tcpServer.Close()
+			}
+			return jerrors.Trace(err)
+		}
+		tcpServerMap[port] = tcpServer
 	}
+	s.lock.Lock()
+	for port, tcpServer := range tcpServerMap {
+		s.tcpServerMap[port] = tcpServer
+	}
+	s.lock.Unlock()
+	if conf.EnableAdmin {
+		s.admin = startAdminServer(conf.AdminHost, conf.ProfilePort, s.adminMux())
+	}
+	log.Info("%s starts successfull! its version=%s, its listen ends=%s:%s\n",
+		conf.AppName, getty.Version, conf.Host, conf.Ports)
+
+	return nil
 }
 
-func (s *Server) Stop() {
-	for _, tcpServer := range s.tcpServerList {
-		tcpServer.Close()
+// RateLimitStats returns the statistics of all keys of the rate limiters. A limiter keeps 4096 buckets
+// at most, whose idle ones may have been evicted, and the statistics of the evicted ones & the keys
+// over the limit are aggregated under the key "(other)".
+func (s *Server) RateLimitStats() []RateLimitStat {
+	return s.limiter().stats()
+}
+
+// InflightNum returns the number of requests which have been read but not finished, including
+// the ones waiting for the workers of the session pools or for their turns in the ordered queues.
+func (s *Server) InflightNum() int {
+	return int(atomic.LoadInt32(&s.inflight))
+}
+
+// IsDraining returns true after Stop has been invoked.
+func (s *Server) IsDraining() bool {
+	return atomic.LoadInt32(&s.draining) == 1
+}
+
+func (s *Server) deregister() {
+	if s.registry == nil {
+		return
 	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, service := range s.services {
+		if err := s.registry.Deregister(service); err != nil {
+			log.Warn("registry.Deregister(service{%#v}) = error{%s}", service.Attr, jerrors.ErrorStack(err))
+		}
+	}
+	s.services = nil
 }
 
-func (s *Server) initSignal() {
+// waitInflight waits for the in-flight requests to be finished until @ctx expires.
+func (s *Server) waitInflight(ctx context.Context) error {
+	ticker := time.NewTicker(drainCheckInterval)
+	defer ticker.Stop()
+	for atomic.LoadInt32(&s.inflight) > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+// Stop shuts down the server as Shutdown does, and it waits the in-flight requests
+// to be finished at most FailFastTimeout.
+func (s *Server) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config().failFastTimeout)
+	defer cancel()
+	s.Shutdown(ctx)
+}
+
+// Shutdown shuts down the server gracefully. It sets all serving status NOT_SERVING and
+// deregisters the services from the registry first,
+// stops accepting new connections, sends a go-away frame to every client so that it will not
+// route new calls to this server, waits the in-flight requests to be finished until @ctx expires
+// and closes all sessions at last. It returns the error of @ctx if there are still in-flight requests.
+// Only the first invocation takes effect.
+func (s *Server) Shutdown(ctx context.Context) error {
+	var err error
+	s.stopOnce.Do(func() {
+		atomic.StoreInt32(&s.draining, 1)
+		s.health.stop()
+		s.deregister()
+
+		s.lock.Lock()
+		conf := s.conf
+		tcpServerMap := s.tcpServerMap
+		s.tcpServerMap = make(map[string]getty.Server)
+		s.lock.Unlock()
+		// do not close the getty servers while holding s.lock, because
+		// their accept goroutines may be waiting for it in s.newSession.
+		for _, tcpServer := range tcpServerMap {
+			tcpServer.Close()
+		}
+
+		s.handler.goAway()
+		if err = s.waitInflight(ctx); err != nil {
+			log.Warn("%s stops with %d in-flight requests, error{%s}",
+				conf.AppName, atomic.LoadInt32(&s.inflight), err)
+		}
+		s.handler.closeSessions()
+		stopAdminServer(s.admin)
+	})
+
+	return jerrors.Trace(err)
+}
+
+// HandleSignals blocks until SIGINT, SIGQUIT or SIGTERM arrives, and then shuts down @servers
+// concurrently, each of which waits its in-flight requests at most FailFastTimeout. SIGHUP
+// reloads the config files of @servers. It does not touch the global logger.
+func HandleSignals(servers ...*Server) os.Signal {
 	signals := make(chan os.Signal, 1)
 	// It is impossible to block SIGKILL or syscall.SIGSTOP
-	signal.Notify(signals, os.Interrupt, os.Kill, syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGINT)
+	signal.Notify(signals, os.Interrupt, syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(signals)
 	for {
 		sig := <-signals
 		log.Info("get signal %s", sig.String())
-		switch sig {
-		case syscall.SIGHUP:
-		// reload()
-		default:
-			go time.AfterFunc(s.conf.failFastTimeout, func() {
-				log.Exit("app exit now by force...")
-				log.Close()
-			})
-
-			// if @s can not stop in s.conf.failFastTimeout, getty will Force Quit.
-			s.Stop()
-			log.Exit("app exit now...")
-			log.Close()
-			return
+		if sig == syscall.SIGHUP {
+			for _, s := range servers {
+				if s.confFile == "" {
+					continue
+				}
+				if err := s.Reload(); err != nil {
+					log.Error("failed to reload config file %s: %s", s.confFile, jerrors.ErrorStack(err))
+				}
+			}
+			continue
+		}
+
+		var wg sync.WaitGroup
+		for _, s := range servers {
+			wg.Add(1)
+			go func(s *Server) {
+				defer wg.Done()
+				s.Stop()
+			}(s)
 		}
+		wg.Wait()
+
+		return sig
 	}
 }
+
+// Reload loads the config file again and applies its runtime parameters: session timeout,
+// session number limit, GettySessionParam of new sessions, log config file, rate limits, dispatch
+// modes and listen ports. The new config will be dropped if it is illegal, if it changes any field
+// which can not be changed at runtime, or if the server fails to listen on its new ports.
+func (s *Server) Reload() error {
+	if s.confFile == "" {
+		return jerrors.New("server is not created by a config file")
+	}
+	conf, err := loadServerConf(s.confFile)
+	if err != nil {
+		return jerrors.Trace(err)
+	}
+
+	return jerrors.Trace(s.reload(conf))
+}
+
+// reload applies the runtime parameters of @conf, which has passed (ServerConfig)CheckValidity.
+// It listens on the new ports without holding @s.lock, which is only locked to swap the config
+// and the getty servers, so that the requests are not blocked by the slow listening.
+func (s *Server) reload(conf *ServerConfig) error {
+	if s.IsDraining() {
+		return jerrors.New("server is stopping")
+	}
+
+	s.reloadLock.Lock()
+	defer s.reloadLock.Unlock()
+
+	var closedServers []getty.Server
+	defer func() {
+		for _, tcpServer := range closedServers {
+			tcpServer.Close()
+		}
+	}()
+
+	s.lock.RLock()
+	if field := immutableDiff(s.conf, conf); field != "" {
+		s.lock.RUnlock()
+		return jerrors.Errorf("%s can not be changed by reload", field)
+	}
+	// keep the tls config which has been loaded
+	conf.TLS = s.conf.TLS
+	listening := make(map[string]bool, len(s.tcpServerMap))
+	for port := range s.tcpServerMap {
+		listening[port] = true
+	}
+	s.lock.RUnlock()
+
+	// listen on new ports, and close the servers of the removed ports after the new ones are ready.
+	// @s.tcpServerMap is only changed by reload & Shutdown, and the former is serialized by @s.reloadLock.
+	newServers := make(map[string]getty.Server)
+	portSet := make(map[string]bool, len(conf.Ports))
+	for _, port := range conf.Ports {
+		portSet[port] = true
+		if listening[port] {
+			continue
+		}
+		tcpServer, err := s.listen(conf, port)
+		if err != nil {
+			for _, tcpServer := range newServers {
+				closedServers = append(closedServers, tcpServer)
+			}
+			return jerrors.Trace(err)
+		}
+		newServers[port] = tcpServer
+		log.Info("reload: listen on new port %s", port)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.IsDraining() {
+		for _, tcpServer := range newServers {
+			closedServers = append(closedServers, tcpServer)
+		}
+		return jerrors.New("server is stopping")
+	}
+	for port, tcpServer := range newServers {
+		s.tcpServerMap[port] = tcpServer
+	}
+	for port, tcpServer := range s.tcpServerMap {
+		if !portSet[port] {
+			closedServers = append(closedServers, tcpServer)
+			delete(s.tcpServerMap, port)
+			log.Info("reload: stop listening on port %s", port)
+		}
+	}
+	s.updateRegistry(conf.Ports)
+
+	if conf.LogConfFile != "" {
+		log.LoadConfiguration(conf.LogConfFile)
+	}
+	s.conf = conf
+	s.rateLimiter = s.rateLimiter.reload(conf.RateLimit)
+	s.dispatcher.setModes(conf.Dispatch)
+	s.handler.setSessionParams(conf.SessionNumber, conf.sessionTimeout)
+	log.Info("%s reloads config file %s successfully, its listen ends=%s:%s",
+		conf.AppName, s.confFile, conf.Host, conf.Ports)
+
+	return nil
+}
+
+// immutableDiff returns the name of the first field which differs between @old and @conf
+// and can not be changed by reload, or "" if there is none.
+func immutableDiff(old, conf *ServerConfig) string {
+	oldTLS, newTLS := old.TLS, conf.TLS
+	oldTLS.tlsConfig, newTLS.tlsConfig = nil, nil
+	fields := []struct {
+		name     string
+		old, new interface{}
+	}{
+		{"AppName", old.AppName, conf.AppName},
+		{"Host", old.Host, conf.Host},
+		{"ProfilePort", old.ProfilePort, conf.ProfilePort},
+		{"EnableAdmin", old.EnableAdmin, conf.EnableAdmin},
+		{"AdminHost", old.AdminHost, conf.AdminHost},
+		{"CodecType", old.CodecType, conf.CodecType},
+		{"Transport", old.Transport, conf.Transport},
+		{"WSPath", old.WSPath, conf.WSPath},
+		{"DisableReflection", old.DisableReflection, conf.DisableReflection},
+		{"Tracing", old.Tracing, conf.Tracing},
+		{"TLS", oldTLS, newTLS},
+		{"Auth", old.Auth, conf.Auth},
+		{"Registry", old.Registry, conf.Registry},
+	}
+	for _, f := range fields {
+		if !reflect.DeepEqual(f.old, f.new) {
+			return f.name
+		}
+	}
+
+	return ""
+}
+
+// updateRegistry registers the services again with the nodes of @ports.
+// Pls make sure that @s.lock has been locked.
+func (s *Server) updateRegistry(ports []string) {
+	if s.registry == nil || equalPorts(ports, s.conf.Ports) {
+		return
+	}
+
+	s.nodes = s.registryNodes(ports)
+	for i, service := range s.services {
+		if err := s.registry.Deregister(service); err != nil {
+			log.Warn("registry.Deregister(service{%#v}) = error{%s}", service.Attr, jerrors.ErrorStack(err))
+		}
+		service.Nodes = s.nodes
+		if err := s.registry.Register(service); err != nil {
+			log.Error("registry.Register(service{%#v}) = error{%s}", service.Attr, jerrors.ErrorStack(err))
+		}
+		s.services[i] = service
+	}
+}
+
+func equalPorts(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,192 @@
+package rpc
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+import (
+	jerrors "github.com/juju/errors"
+)
+
+// goSleep calls Arith.Sleep(@ms) in a goroutine, and waits until the server handles it.
+func goSleep(t *testing.T, server *Server, client *Client, ms int) <-chan error {
+	errs := make(chan error, 1)
+	go func() {
+		var reply int
+		err := client.Call("Arith", "Sleep", ms, &reply)
+		if err == nil && reply != ms {
+			err = jerrors.Errorf("Arith.Sleep(%d) = %d", ms, reply)
+		}
+		errs <- err
+	}()
+	if !waitUntil(func() bool { return server.InflightNum() == 1 }) {
+		t.Fatalf("in-flight request number = %d, want 1", server.InflightNum())
+	}
+
+	return errs
+}
+
+func TestShutdownWaitsInflight(t *testing.T) {
+	server, port := newTestServer(t)
+	client := newTestClient(t, port)
+	if err := waitReady(client); err != nil {
+		t.Fatalf("WaitReady() = error{%v}", err)
+	}
+	errs := goSleep(t, server, client, 500)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() = error{%v}", err)
+	}
+	if n := server.InflightNum(); n != 0 {
+		t.Errorf("in-flight request number after Shutdown() = %d, want 0", n)
+	}
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Errorf("in-flight Arith.Sleep(500) = error{%v}", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("in-flight Arith.Sleep(500) does not return")
+	}
+
+	// the client does not route new calls to the server which has sent the go-away frame
+	ctx, cancel = context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	var sum int
+	if err := client.CallWithContext(ctx, "Arith", "Add", 1, &sum); jerrors.Cause(err) != errSessionNotExist {
+		t.Errorf("Arith.Add(1) after Shutdown() = error{%v}, want errSessionNotExist", err)
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	server, port := newTestServer(t)
+	client := newTestClient(t, port)
+	if err := waitReady(client); err != nil {
+		t.Fatalf("WaitReady() = error{%v}", err)
+	}
+	goSleep(t, server, client, 5000)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := server.Shutdown(ctx); jerrors.Cause(err) != context.DeadlineExceeded {
+		t.Errorf("Shutdown() with an in-flight request = error{%v}, want context.DeadlineExceeded", err)
+	}
+	if cost := time.Since(start); cost > 2*time.Second {
+		t.Errorf("Shutdown() costs %s, want about 200ms", cost)
+	}
+}
+
+// reloadConf returns a copy of the config of @server modified by @modify.
+func reloadConf(t *testing.T, server *Server, modify func(*ServerConfig)) *ServerConfig {
+	conf := *server.config()
+	modify(&conf)
+	if err := conf.CheckValidity(); err != nil {
+		t.Fatalf("CheckValidity() = error{%v}", err)
+	}
+
+	return &conf
+}
+
+func TestReload(t *testing.T) {
+	server, port := newTestServer(t)
+	oldPort, newPort := strconv.Itoa(port), strconv.Itoa(freePort(t))
+
+	t.Run("immutable field", func(t *testing.T) {
+		conf := reloadConf(t, server, func(c *ServerConfig) { c.CodecType = "protobuf" })
+		if err := server.reload(conf); err == nil || !strings.Contains(err.Error(), "CodecType") {
+			t.Errorf("reload(CodecType) = error{%v}, want CodecType can not be changed", err)
+		}
+		if codec := server.config().CodecType; codec != "json" {
+			t.Errorf("CodecType after rejected reload = %s, want json", codec)
+		}
+	})
+	t.Run("port in use", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("net.Listen() = error{%v}", err)
+		}
+		defer l.Close()
+		usedPort := strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+		conf := reloadConf(t, server, func(c *ServerConfig) {
+			c.Ports = []string{oldPort, usedPort}
+			c.SessionNumber++
+		})
+		if err := server.reload(conf); err == nil {
+			t.Errorf("reload(port %s in use) = nil error", usedPort)
+		}
+		if ports := server.config().Ports; !reflect.DeepEqual(ports, []string{oldPort}) {
+			t.Errorf("Ports after rejected reload = %v, want [%s]", ports, oldPort)
+		}
+	})
+	t.Run("concurrent reloads", func(t *testing.T) {
+		extraPort := strconv.Itoa(freePort(t))
+		conf := reloadConf(t, server, func(c *ServerConfig) { c.Ports = []string{oldPort, extraPort} })
+		// the reloads listening on the same new port are serialized, and only the first one listens on it
+		var wg sync.WaitGroup
+		start := make(chan struct{})
+		errs := make([]error, 8)
+		for i := range errs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				c := *conf
+				<-start
+				errs[i] = server.reload(&c)
+			}(i)
+		}
+		close(start)
+		wg.Wait()
+		for i, err := range errs {
+			if err != nil {
+				t.Errorf("reload() #%d = error{%v}", i, err)
+			}
+		}
+		server.lock.RLock()
+		n := len(server.tcpServerMap)
+		server.lock.RUnlock()
+		if n != 2 {
+			t.Errorf("getty server number after reloads = %d, want 2", n)
+		}
+	})
+	t.Run("runtime fields", func(t *testing.T) {
+		conf := reloadConf(t, server, func(c *ServerConfig) {
+			c.Ports = []string{newPort}
+			c.RateLimit = RateLimitConfig{Method: RateLimitParam{Rate: 0.001, Burst: 1}}
+		})
+		if err := server.reload(conf); err != nil {
+			t.Fatalf("reload() = error{%v}", err)
+		}
+
+		if !waitUntil(func() bool {
+			c, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", oldPort))
+			if err == nil {
+				c.Close()
+			}
+			return err != nil
+		}) {
+			t.Errorf("server still listens on the removed port %s", oldPort)
+		}
+		port, _ := strconv.Atoi(newPort)
+		client := newTestClient(t, port)
+		if err := waitReady(client); err != nil {
+			t.Fatalf("WaitReady() on the new port = error{%v}", err)
+		}
+		var sum int
+		if err := client.Call("Arith", "Add", 1, &sum); err != nil {
+			t.Errorf("Arith.Add(1) = error{%v}", err)
+		}
+		if err := client.Call("Arith", "Add", 1, &sum); jerrors.Cause(err) != ErrRateLimited {
+			t.Errorf("Arith.Add(1) over the reloaded limit = error{%v}, want ErrRateLimited", err)
+		}
+	})
+}
@@ -0,0 +1,116 @@
+package rpc
+
+import (
+	"crypto/tls"
+	"net"
+)
+
+import (
+	"github.com/AlexStocks/getty"
+	jerrors "github.com/juju/errors"
+)
+
+var (
+	clientAuthTypes = map[string]tls.ClientAuthType{
+		"":                   tls.NoClientCert,
+		"none":               tls.NoClientCert,
+		"request":            tls.RequestClientCert,
+		"require":            tls.RequireAnyClientCert,
+		"verify-if-given":    tls.VerifyClientCertIfGiven,
+		"require-and-verify": tls.RequireAndVerifyClientCert,
+	}
+)
+
+// buildServerConfig loads the certificates of @c for the server if tls is enabled.
+func (c *TLSConfig) buildServerConfig() error {
+	c.tlsConfig = nil
+	if !c.Enable {
+		return nil
+	}
+
+	clientAuth, ok := clientAuthTypes[c.ClientAuth]
+	if !ok {
+		return jerrors.Errorf("illegal ClientAuth{%s}", c.ClientAuth)
+	}
+	if c.CertFile == "" || c.KeyFile == "" {
+		return jerrors.New("tls server needs both CertFile and KeyFile")
+	}
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return jerrors.Annotatef(err, "tls.LoadX509KeyPair(cert{%s}, key{%s})", c.CertFile, c.KeyFile)
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   clientAuth,
+		MinVersion:   tls.VersionTLS12,
+	}
+	if c.CAFile != "" {
+		if config.ClientCAs, err = getty.LoadCertPool(c.CAFile); err != nil {
+			return jerrors.Trace(err)
+		}
+	} else if clientAuth == tls.VerifyClientCertIfGiven || clientAuth == tls.RequireAndVerifyClientCert {
+		return jerrors.Errorf("ClientAuth{%s} needs CAFile", c.ClientAuth)
+	}
+	c.tlsConfig = config
+
+	return nil
+}
+
+// buildClientConfig loads the certificates of @c for the client if tls is enabled.
+// @serverHost is the default server name.
+func (c *TLSConfig) buildClientConfig(serverHost string) error {
+	c.tlsConfig = nil
+	if !c.Enable {
+		return nil
+	}
+
+	config := &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+	if config.ServerName == "" {
+		config.ServerName = serverHost
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return jerrors.New("tls client needs both CertFile and KeyFile in mutual tls")
+	}
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return jerrors.Annotatef(err, "tls.LoadX509KeyPair(cert{%s}, key{%s})", c.CertFile, c.KeyFile)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if c.CAFile != "" {
+		var err error
+		if config.RootCAs, err = getty.LoadCertPool(c.CAFile); err != nil {
+			return jerrors.Trace(err)
+		}
+	}
+	c.tlsConfig = config
+
+	return nil
+}
+
+// underlyingTCPConn returns the tcp connection under @conn, which may be a tls connection.
+func underlyingTCPConn(conn net.Conn) (*net.TCPConn, bool) {
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+	tcpConn, ok := conn.(*net.TCPConn)
+
+	return tcpConn, ok
+}
+
+// tlsConnectionState returns the tls state of @conn, or nil if it is not a tls connection.
+func tlsConnectionState(conn net.Conn) *tls.ConnectionState {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+	state := tlsConn.ConnectionState()
+
+	return &state
+}
@@ -0,0 +1,167 @@
+package rpc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCert is a certificate & private key pair generated by the tests.
+type testCert struct {
+	cert     *x509.Certificate
+	key      *ecdsa.PrivateKey
+	certFile string
+	keyFile  string
+}
+
+// newTestCert generates a certificate of @tmpl signed by @parent, or a self-signed one if @parent
+// is nil, and writes its pem files into @dir.
+func newTestCert(t *testing.T, dir, name string, tmpl *x509.Certificate, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey() = error{%v}", err)
+	}
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+	signer, signerKey := tmpl, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("x509.CreateCertificate(%s) = error{%v}", name, err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("x509.ParseCertificate(%s) = error{%v}", name, err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("x509.MarshalECPrivateKey(%s) = error{%v}", name, err)
+	}
+
+	c := &testCert{
+		cert:     cert,
+		key:      key,
+		certFile: filepath.Join(dir, name+".pem"),
+		keyFile:  filepath.Join(dir, name+".key"),
+	}
+	if err = ioutil.WriteFile(c.certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatalf("ioutil.WriteFile(%s) = error{%v}", c.certFile, err)
+	}
+	if err = ioutil.WriteFile(c.keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatalf("ioutil.WriteFile(%s) = error{%v}", c.keyFile, err)
+	}
+
+	return c
+}
+
+func newTestCA(t *testing.T, dir, name string) *testCert {
+	return newTestCert(t, dir, name, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}, nil)
+}
+
+func newTestLeaf(t *testing.T, dir, name string, serial int64, usage x509.ExtKeyUsage, ca *testCert) *testCert {
+	return newTestCert(t, dir, name, &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}, ca)
+}
+
+// tlsCall calls Arith.Add by a client of the tls server on @port.
+func tlsCall(t *testing.T, port int, tls TLSConfig) error {
+	client := newTestClient(t, port, WithClientTLS(tls))
+	if err := waitReady(client); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	var sum int
+	if err := client.CallWithContext(ctx, "Arith", "Add", 1, &sum); err != nil {
+		return err
+	}
+	if sum != 2 {
+		t.Errorf("Arith.Add(1) = %d, want 2", sum)
+	}
+
+	return nil
+}
+
+func TestTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "ca")
+	otherCA := newTestCA(t, dir, "other-ca")
+	server := newTestLeaf(t, dir, "server", 2, x509.ExtKeyUsageServerAuth, ca)
+	client := newTestLeaf(t, dir, "client", 3, x509.ExtKeyUsageClientAuth, ca)
+
+	serverTLS := TLSConfig{
+		Enable:   true,
+		CertFile: server.certFile,
+		KeyFile:  server.keyFile,
+	}
+	_, port := newTestServer(t, WithServerTLS(serverTLS))
+
+	t.Run("success", func(t *testing.T) {
+		if err := tlsCall(t, port, TLSConfig{Enable: true, CAFile: ca.certFile}); err != nil {
+			t.Errorf("tls call = error{%v}", err)
+		}
+	})
+	t.Run("wrong CA", func(t *testing.T) {
+		if err := tlsCall(t, port, TLSConfig{Enable: true, CAFile: otherCA.certFile}); err == nil {
+			t.Errorf("tls call succeeds with the server certificate which is not signed by the client CA")
+		}
+	})
+
+	serverTLS.CAFile = ca.certFile
+	serverTLS.ClientAuth = "require-and-verify"
+	_, mutualPort := newTestServer(t, WithServerTLS(serverTLS))
+
+	t.Run("mutual tls success", func(t *testing.T) {
+		clientTLS := TLSConfig{
+			Enable:   true,
+			CertFile: client.certFile,
+			KeyFile:  client.keyFile,
+			CAFile:   ca.certFile,
+		}
+		if err := tlsCall(t, mutualPort, clientTLS); err != nil {
+			t.Errorf("mutual tls call = error{%v}", err)
+		}
+	})
+	t.Run("mutual tls without client certificate", func(t *testing.T) {
+		if err := tlsCall(t, mutualPort, TLSConfig{Enable: true, CAFile: ca.certFile}); err == nil {
+			t.Errorf("mutual tls call succeeds without the client certificate")
+		}
+	})
+	t.Run("mutual tls with client certificate of wrong CA", func(t *testing.T) {
+		other := newTestLeaf(t, dir, "other-client", 4, x509.ExtKeyUsageClientAuth, otherCA)
+		clientTLS := TLSConfig{
+			Enable:   true,
+			CertFile: other.certFile,
+			KeyFile:  other.keyFile,
+			CAFile:   ca.certFile,
+		}
+		if err := tlsCall(t, mutualPort, clientTLS); err == nil {
+			t.Errorf("mutual tls call succeeds with the client certificate which is not signed by the server CA")
+		}
+	})
+}
@@ -0,0 +1,347 @@
+package rpc
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+import (
+	log "github.com/AlexStocks/log4go"
+	jerrors "github.com/juju/errors"
+)
+
+// W3C trace context, https://www.w3.org/TR/trace-context/
+const (
+	TraceparentKey = "traceparent"
+	TracestateKey  = "tracestate"
+
+	traceparentVersion = "00"
+	traceparentLen     = 55 // "00-" + 32 hex trace id + "-" + 16 hex span id + "-" + 2 hex flags
+	traceFlagSampled   = 0x01
+
+	TraceExporterNone   = "none"
+	TraceExporterStdout = "stdout"
+)
+
+var (
+	ErrIllegalTraceparent   = jerrors.New("illegal traceparent")
+	ErrIllegalTraceExporter = jerrors.New("illegal trace exporter")
+)
+
+////////////////////////////////////////////
+// SpanContext
+////////////////////////////////////////////
+
+type TraceID [16]byte
+
+func (t TraceID) IsValid() bool {
+	return t != TraceID{}
+}
+
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+func (t TraceID) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+type SpanID [8]byte
+
+func (s SpanID) IsValid() bool {
+	return s != SpanID{}
+}
+
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+func (s SpanID) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// SpanContext is the part of a span which is propagated to the remote peer.
+type SpanContext struct {
+	TraceID    TraceID `json:"trace_id"`
+	SpanID     SpanID  `json:"span_id"`
+	Sampled    bool    `json:"sampled"`
+	TraceState string  `json:"trace_state,omitempty"`
+	Remote     bool    `json:"remote,omitempty"`
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Traceparent returns the W3C traceparent header value of @sc.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+
+	return traceparentVersion + "-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// ParseTraceparent parses the W3C traceparent header value @value.
+func ParseTraceparent(value string) (SpanContext, error) {
+	var (
+		sc    SpanContext
+		flags [1]byte
+	)
+
+	value = strings.TrimSpace(value)
+	// a future version may append more fields after flags.
+	if len(value) < traceparentLen || value[2] != '-' || value[35] != '-' || value[52] != '-' ||
+		(len(value) > traceparentLen && value[traceparentLen] != '-') {
+		return sc, jerrors.Annotatef(ErrIllegalTraceparent, "traceparent{%s}", value)
+	}
+	version := value[:2]
+	if version == "ff" || (version == traceparentVersion && len(value) != traceparentLen) {
+		return sc, jerrors.Annotatef(ErrIllegalTraceparent, "traceparent{%s}", value)
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(value[3:35])); err != nil {
+		return sc, jerrors.Annotatef(ErrIllegalTraceparent, "traceparent{%s}", value)
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(value[36:52])); err != nil {
+		return sc, jerrors.Annotatef(ErrIllegalTraceparent, "traceparent{%s}", value)
+	}
+	if _, err := hex.Decode(flags[:], []byte(value[53:55])); err != nil {
+		return sc, jerrors.Annotatef(ErrIllegalTraceparent, "traceparent{%s}", value)
+	}
+	if !sc.IsValid() {
+		return sc, jerrors.Annotatef(ErrIllegalTraceparent, "traceparent{%s}", value)
+	}
+	sc.Sampled = flags[0]&traceFlagSampled != 0
+	sc.Remote = true
+
+	return sc, nil
+}
+
+// inject writes @sc into the request metadata @meta.
+func (sc SpanContext) inject(meta map[string]string) {
+	meta[TraceparentKey] = sc.Traceparent()
+	if sc.TraceState != "" {
+		meta[TracestateKey] = sc.TraceState
+	}
+}
+
+// extractSpanContext reads the remote span context from the request metadata @meta.
+func extractSpanContext(meta map[string]string) (SpanContext, bool) {
+	value, ok := meta[TraceparentKey]
+	if !ok {
+		return SpanContext{}, false
+	}
+	sc, err := ParseTraceparent(value)
+	if err != nil {
+		log.Warn("ParseTraceparent(%s) = error{%s}", value, err)
+		return SpanContext{}, false
+	}
+	sc.TraceState = meta[TracestateKey]
+
+	return sc, true
+}
+
+////////////////////////////////////////////
+// Span
+////////////////////////////////////////////
+
+type SpanKind string
+
+const (
+	SpanKindClient SpanKind = "client"
+	SpanKindServer SpanKind = "server"
+)
+
+type Span struct {
+	Name         string            `json:"name"`
+	Kind         SpanKind          `json:"kind"`
+	SpanContext  SpanContext       `json:"span_context"`
+	ParentSpanID SpanID            `json:"parent_span_id"`
+	Start        time.Time         `json:"start"`
+	End          time.Time         `json:"end"`
+	Attributes   map[string]string `json:"attributes,omitempty"`
+	Error        string            `json:"error,omitempty"`
+
+	lock     sync.Mutex
+	exporter SpanExporter
+}
+
+// SetAttribute sets a key-value attribute of the span.
+func (s *Span) SetAttribute(key, value string) {
+	s.lock.Lock()
+	if s.Attributes == nil {
+		s.Attributes = make(map[string]string)
+	}
+	s.Attributes[key] = value
+	s.lock.Unlock()
+}
+
+// finish ends the span and exports it if it is sampled.
+func (s *Span) finish(err error) {
+	s.lock.Lock()
+	s.End = time.Now()
+	if err != nil {
+		s.Error = err.Error()
+	}
+	s.lock.Unlock()
+
+	if s.exporter != nil && s.SpanContext.Sampled {
+		s.exporter.ExportSpan(s)
+	}
+}
+
+type spanContextKey struct{}
+
+// ContextWithSpan returns a copy of @ctx which carries @span.
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, span)
+}
+
+// SpanFromContext returns the span carried by @ctx, or nil if there is none.
+func SpanFromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	span, _ := ctx.Value(spanContextKey{}).(*Span)
+
+	return span
+}
+
+////////////////////////////////////////////
+// SpanExporter
+////////////////////////////////////////////
+
+// SpanExporter receives finished spans. It must be goroutine-safe.
+type SpanExporter interface {
+	ExportSpan(span *Span)
+}
+
+// StdoutExporter writes every span as a json line.
+type StdoutExporter struct {
+	lock sync.Mutex
+	w    io.Writer
+}
+
+// NewStdoutExporter returns an exporter which writes spans into @w, which is os.Stdout if it is nil.
+func NewStdoutExporter(w io.Writer) *StdoutExporter {
+	if w == nil {
+		w = os.Stdout
+	}
+
+	return &StdoutExporter{w: w}
+}
+
+func (e *StdoutExporter) ExportSpan(span *Span) {
+	span.lock.Lock()
+	data, err := json.Marshal(span)
+	span.lock.Unlock()
+	if err != nil {
+		log.Warn("json.Marshal(span{%s}) = error{%s}", span.Name, err)
+		return
+	}
+
+	e.lock.Lock()
+	e.w.Write(append(data, '\n'))
+	e.lock.Unlock()
+}
+
+// InMemoryExporter keeps all spans in memory. It is useful for tests.
+type InMemoryExporter struct {
+	lock  sync.Mutex
+	spans []*Span
+}
+
+func NewInMemoryExporter() *InMemoryExporter {
+	return &InMemoryExporter{}
+}
+
+func (e *InMemoryExporter) ExportSpan(span *Span) {
+	e.lock.Lock()
+	e.spans = append(e.spans, span)
+	e.lock.Unlock()
+}
+
+// Spans returns the exported spans in finishing order.
+func (e *InMemoryExporter) Spans() []*Span {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return append([]*Span(nil), e.spans...)
+}
+
+func (e *InMemoryExporter) Reset() {
+	e.lock.Lock()
+	e.spans = nil
+	e.lock.Unlock()
+}
+
+func newSpanExporter(conf TracingConfig) (SpanExporter, error) {
+	switch conf.Exporter {
+	case "", TraceExporterNone:
+		return nil, nil
+	case TraceExporterStdout:
+		return NewStdoutExporter(os.Stdout), nil
+	}
+
+	return nil, jerrors.Annotatef(ErrIllegalTraceExporter, "exporter{%s}", conf.Exporter)
+}
+
+////////////////////////////////////////////
+// tracer
+////////////////////////////////////////////
+
+type tracer struct {
+	lock     sync.RWMutex
+	exporter SpanExporter
+}
+
+func (t *tracer) setExporter(exporter SpanExporter) {
+	t.lock.Lock()
+	t.exporter = exporter
+	t.lock.Unlock()
+}
+
+func (t *tracer) spanExporter() SpanExporter {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.exporter
+}
+
+// startSpan starts a span whose parent is @parent. It returns nil if there is
+// neither a valid parent nor an exporter, so that tracing costs nothing when it is not used.
+func (t *tracer) startSpan(name string, kind SpanKind, parent SpanContext) *Span {
+	exporter := t.spanExporter()
+	if exporter == nil && !parent.IsValid() {
+		return nil
+	}
+
+	span := &Span{
+		Name:     name,
+		Kind:     kind,
+		Start:    time.Now(),
+		exporter: exporter,
+	}
+	if parent.IsValid() {
+		span.SpanContext.TraceID = parent.TraceID
+		span.SpanContext.Sampled = parent.Sampled
+		span.SpanContext.TraceState = parent.TraceState
+		span.ParentSpanID = parent.SpanID
+	} else {
+		for !span.SpanContext.TraceID.IsValid() {
+			rand.Read(span.SpanContext.TraceID[:])
+		}
+		span.SpanContext.Sampled = true
+	}
+	for !span.SpanContext.SpanID.IsValid() {
+		rand.Read(span.SpanContext.SpanID[:])
+	}
+
+	return span
+}
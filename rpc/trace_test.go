@@ -0,0 +1,67 @@
+package rpc
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTraceContextRoundTrip(t *testing.T) {
+	server, port := newTestServer(t)
+	serverSpans := NewInMemoryExporter()
+	server.SetSpanExporter(serverSpans)
+	client := newTestClient(t, port)
+	clientSpans := NewInMemoryExporter()
+	client.SetSpanExporter(clientSpans)
+	if err := waitReady(client); err != nil {
+		t.Fatalf("WaitReady() = error{%v}", err)
+	}
+
+	// the span of the caller, e.g. the server span of an upstream service
+	parent, err := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if err != nil {
+		t.Fatalf("ParseTraceparent() = error{%v}", err)
+	}
+	ctx := ContextWithSpan(context.Background(), &Span{SpanContext: parent})
+	var traceparent string
+	if err = client.CallWithContext(ctx, "Arith", "Traceparent", 0, &traceparent); err != nil {
+		t.Fatalf("Call(Arith.Traceparent) = error{%v}", err)
+	}
+
+	spans := clientSpans.Spans()
+	if len(spans) != 1 {
+		t.Fatalf("client span number = %d, want 1", len(spans))
+	}
+	clientSpan := spans[0]
+	if clientSpan.Kind != SpanKindClient || clientSpan.Name != "Arith.Traceparent" {
+		t.Errorf("client span = {kind:%s, name:%s}", clientSpan.Kind, clientSpan.Name)
+	}
+	if clientSpan.SpanContext.TraceID != parent.TraceID || clientSpan.ParentSpanID != parent.SpanID {
+		t.Errorf("client span {trace:%s, parent:%s}, want {trace:%s, parent:%s}",
+			clientSpan.SpanContext.TraceID, clientSpan.ParentSpanID, parent.TraceID, parent.SpanID)
+	}
+
+	// the server span is exported after the response has been sent
+	deadline := time.Now().Add(3 * time.Second)
+	for len(serverSpans.Spans()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	spans = serverSpans.Spans()
+	if len(spans) != 1 {
+		t.Fatalf("server span number = %d, want 1", len(spans))
+	}
+	serverSpan := spans[0]
+	if serverSpan.Kind != SpanKindServer || serverSpan.Name != "Arith.Traceparent" {
+		t.Errorf("server span = {kind:%s, name:%s}", serverSpan.Kind, serverSpan.Name)
+	}
+	if serverSpan.SpanContext.TraceID != parent.TraceID || serverSpan.ParentSpanID != clientSpan.SpanContext.SpanID {
+		t.Errorf("server span {trace:%s, parent:%s}, want {trace:%s, parent:%s}",
+			serverSpan.SpanContext.TraceID, serverSpan.ParentSpanID, parent.TraceID, clientSpan.SpanContext.SpanID)
+	}
+	if !serverSpan.SpanContext.Sampled {
+		t.Errorf("server span is not sampled")
+	}
+	if traceparent != serverSpan.SpanContext.Traceparent() {
+		t.Errorf("traceparent in the service method = %s, want %s", traceparent, serverSpan.SpanContext.Traceparent())
+	}
+}
@@ -0,0 +1,122 @@
+package rpc
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+)
+
+import (
+	"github.com/AlexStocks/getty"
+	"github.com/AlexStocks/goext/net"
+	jerrors "github.com/juju/errors"
+)
+
+const (
+	TransportTCP  = "tcp"
+	TransportWS   = "ws"
+	TransportWSS  = "wss"
+	TransportUnix = "unix"
+)
+
+var (
+	ErrIllegalTransport = jerrors.New("illegal transport")
+)
+
+// checkTransport checks whether @transport is legal and matches the tls switch @tlsEnable.
+// tcp, which is the default transport, may use tls. wss must use tls, and ws & unix can not use tls.
+func checkTransport(transport string, tlsEnable bool) error {
+	switch transport {
+	case "", TransportTCP:
+		return nil
+	case TransportWSS:
+		if !tlsEnable {
+			return jerrors.New("wss transport needs tls config")
+		}
+		return nil
+	case TransportWS, TransportUnix:
+		if tlsEnable {
+			return jerrors.Errorf("%s transport does not support tls", transport)
+		}
+		return nil
+	}
+
+	return jerrors.Annotatef(ErrIllegalTransport, "transport{%s}", transport)
+}
+
+// newGettyServer builds a getty server listening on @port, which is the socket file path in unix transport.
+func newGettyServer(conf *ServerConfig, port string) getty.Server {
+	switch conf.Transport {
+	case TransportWS:
+		return getty.NewWSServer(
+			getty.WithLocalAddress(gxnet.HostAddress2(conf.Host, port)),
+			getty.WithWebsocketServerPath(conf.WSPath),
+		)
+	case TransportWSS:
+		// the same tls config of tcp transport, which carries all tls settings of @conf, e.g. ClientAuth
+		return getty.NewWSSServer(
+			getty.WithLocalAddress(gxnet.HostAddress2(conf.Host, port)),
+			getty.WithWebsocketServerPath(conf.WSPath),
+			getty.WithServerTLSConfig(conf.TLS.tlsConfig),
+		)
+	case TransportUnix:
+		return getty.NewUnixServer(
+			getty.WithLocalAddress(port),
+		)
+	}
+
+	return getty.NewTCPServer(
+		getty.WithLocalAddress(gxnet.HostAddress2(conf.Host, port)),
+		getty.WithServerTLSConfig(conf.TLS.tlsConfig),
+	)
+}
+
+func wsURL(conf *ClientConfig) string {
+	return fmt.Sprintf("%s://%s%s", conf.Transport,
+		net.JoinHostPort(conf.ServerHost, strconv.Itoa(conf.ServerPort)), conf.WSPath)
+}
+
+// newGettyClient builds a getty client connecting to the server of @conf.
+func newGettyClient(conf *ClientConfig) getty.Client {
+	switch conf.Transport {
+	case TransportWS:
+		return getty.NewWSClient(
+			getty.WithServerAddress(wsURL(conf)),
+			getty.WithConnectionNumber((int)(conf.ConnectionNum)),
+		)
+	case TransportWSS:
+		return getty.NewWSSClient(
+			getty.WithServerAddress(wsURL(conf)),
+			getty.WithConnectionNumber((int)(conf.ConnectionNum)),
+			getty.WithClientTLSConfig(conf.TLS.tlsConfig),
+		)
+	case TransportUnix:
+		return getty.NewUnixClient(
+			getty.WithServerAddress(conf.ServerHost),
+			getty.WithConnectionNumber((int)(conf.ConnectionNum)),
+		)
+	}
+
+	return getty.NewTCPClient(
+		getty.WithServerAddress(gxnet.HostAddress(conf.ServerHost, conf.ServerPort)),
+		getty.WithConnectionNumber((int)(conf.ConnectionNum)),
+		getty.WithClientTLSConfig(conf.TLS.tlsConfig),
+	)
+}
+
+// setTCPParams applies the tcp socket parameters of @param to @conn. It does
+// nothing if there is no tcp connection under @conn, eg. a unix domain socket.
+func setTCPParams(conn net.Conn, param *GettySessionParam) {
+	tcpConn, ok := underlyingTCPConn(conn)
+	if !ok {
+		return
+	}
+
+	tcpConn.SetNoDelay(param.TcpNoDelay)
+	tcpConn.SetKeepAlive(param.TcpKeepAlive)
+	if param.TcpKeepAlive {
+		tcpConn.SetKeepAlivePeriod(param.keepAlivePeriod)
+	}
+	tcpConn.SetReadBuffer(param.TcpRBufSize)
+	tcpConn.SetWriteBuffer(param.TcpWBufSize)
+}
@@ -0,0 +1,145 @@
+package rpc
+
+import (
+	"context"
+	"crypto/x509"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+import (
+	jerrors "github.com/juju/errors"
+)
+
+func TestCheckTransport(t *testing.T) {
+	tests := []struct {
+		transport string
+		tlsEnable bool
+		ok        bool
+	}{
+		{"", false, true},
+		{TransportTCP, true, true},
+		{TransportWS, false, true},
+		{TransportWS, true, false},
+		{TransportWSS, true, true},
+		{TransportWSS, false, false},
+		{TransportUnix, false, true},
+		{TransportUnix, true, false},
+		{"udp", false, false},
+	}
+	for _, test := range tests {
+		if err := checkTransport(test.transport, test.tlsEnable); (err == nil) != test.ok {
+			t.Errorf("checkTransport(%q, tls %t) = error{%v}, want ok %t", test.transport, test.tlsEnable, err, test.ok)
+		}
+	}
+	if err := checkTransport("udp", false); jerrors.Cause(err) != ErrIllegalTransport {
+		t.Errorf("checkTransport(udp) = error{%v}, want ErrIllegalTransport", err)
+	}
+}
+
+func TestUnixTransport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rpc.sock")
+	newTestServer(t, func(c *ServerConfig) {
+		c.Transport = TransportUnix
+		c.Ports = []string{path}
+	})
+	client := newTestClient(t, 0, func(c *ClientConfig) {
+		c.Transport = TransportUnix
+		c.ServerHost = path
+	})
+	if err := waitReady(client); err != nil {
+		t.Fatalf("WaitReady() = error{%v}", err)
+	}
+
+	var sum int
+	if err := client.Call("Arith", "Add", 1, &sum); err != nil || sum != 2 {
+		t.Errorf("Arith.Add(1) over unix socket = (%d, error{%v}), want 2", sum, err)
+	}
+}
+
+// transportCall calls Arith.Add by @client, which fails if the client can not connect to its server.
+func transportCall(t *testing.T, client *Client) error {
+	if err := waitReady(client); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	var sum int
+	if err := client.CallWithContext(ctx, "Arith", "Add", 1, &sum); err != nil {
+		return err
+	}
+	if sum != 2 {
+		t.Errorf("Arith.Add(1) = %d, want 2", sum)
+	}
+
+	return nil
+}
+
+func TestWSTransport(t *testing.T) {
+	_, port := newTestServer(t, func(c *ServerConfig) {
+		c.Transport = TransportWS
+		c.WSPath = "/rpc"
+	})
+	client := newTestClient(t, port, func(c *ClientConfig) {
+		c.Transport = TransportWS
+		c.WSPath = "/rpc"
+	})
+	if err := transportCall(t, client); err != nil {
+		t.Errorf("Arith.Add(1) over ws = error{%v}", err)
+	}
+}
+
+func TestWSSTransport(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "ca")
+	serverCert := newTestLeaf(t, dir, "server", 2, x509.ExtKeyUsageServerAuth, ca)
+	clientCert := newTestLeaf(t, dir, "client", 3, x509.ExtKeyUsageClientAuth, ca)
+	_, port := newTestServer(t, func(c *ServerConfig) {
+		c.Transport = TransportWSS
+		c.TLS = TLSConfig{
+			Enable:     true,
+			CertFile:   serverCert.certFile,
+			KeyFile:    serverCert.keyFile,
+			CAFile:     ca.certFile,
+			ClientAuth: "require-and-verify",
+		}
+	})
+	wssClient := func(tls TLSConfig) *Client {
+		return newTestClient(t, port, func(c *ClientConfig) {
+			c.Transport = TransportWSS
+			c.TLS = tls
+		})
+	}
+
+	t.Run("mutual tls", func(t *testing.T) {
+		client := wssClient(TLSConfig{
+			Enable:   true,
+			CertFile: clientCert.certFile,
+			KeyFile:  clientCert.keyFile,
+			CAFile:   ca.certFile,
+		})
+		if err := transportCall(t, client); err != nil {
+			t.Errorf("Arith.Add(1) over wss = error{%v}", err)
+		}
+	})
+	t.Run("without client certificate", func(t *testing.T) {
+		client := wssClient(TLSConfig{Enable: true, CAFile: ca.certFile})
+		if err := transportCall(t, client); err == nil {
+			t.Errorf("wss call succeeds without the client certificate required by ClientAuth")
+		}
+	})
+	t.Run("wrong server name", func(t *testing.T) {
+		client := wssClient(TLSConfig{
+			Enable:     true,
+			CertFile:   clientCert.certFile,
+			KeyFile:    clientCert.keyFile,
+			CAFile:     ca.certFile,
+			ServerName: "other.example.com",
+		})
+		if err := transportCall(t, client); err == nil {
+			t.Errorf("wss call succeeds with the server certificate which does not match ServerName")
+		}
+	})
+}
@@ -17,6 +17,7 @@ import (
 	"io/ioutil"
 	"net"
 	"net/http"
+	"os"
 	"sync"
 	"time"
 )
@@ -76,6 +77,26 @@ func NewTCPServer(opts ...ServerOption) Server {
 	return newServer(TCP_SERVER, opts...)
 }
 
+// NewTCPTLSServer builds a tcp server which accepts tls connections. Its tls config is built by
+// the WithServerTLS* options on the base of WithServerTLSConfig. Its sessions behave exactly
+// like the ones of NewTCPServer.
+func NewTCPTLSServer(opts ...ServerOption) Server {
+	s := newServer(TCP_SERVER, opts...)
+
+	config, err := s.tlsOpts.buildServerConfig(s.tlsConfig)
+	if err != nil {
+		panic(fmt.Sprintf("@addr:%s, tls config error{%s}", s.addr, jerrors.ErrorStack(err)))
+	}
+	s.tlsConfig = config
+
+	return s
+}
+
+// NewUnixServer builds a unix domain socket server. Its local address is the socket file path.
+func NewUnixServer(opts ...ServerOption) Server {
+	return newServer(UNIX_SERVER, opts...)
+}
+
 // NewUDPEndPoint builds a unconnected udp server.
 func NewUDPPEndPoint(opts ...ServerOption) Server {
 	return newServer(UDP_ENDPOINT, opts...)
@@ -86,11 +107,12 @@ func NewWSServer(opts ...ServerOption) Server {
 	return newServer(WS_SERVER, opts...)
 }
 
-// NewWSSServer builds a secure websocket server.
+// NewWSSServer builds a secure websocket server. Its tls config is the one of WithServerTLSConfig
+// if it is set, otherwise it is loaded from the certificate files of WithWebsocketServer* options.
 func NewWSSServer(opts ...ServerOption) Server {
 	s := newServer(WSS_SERVER, opts...)
 
-	if s.addr == "" || s.cert == "" || s.privateKey == "" {
+	if s.addr == "" || (s.tlsConfig == nil && (s.cert == "" || s.privateKey == "")) {
 		panic(fmt.Sprintf("@addr:%s, @cert:%s, @privateKey:%s, @caCert:%s",
 			s.addr, s.cert, s.privateKey, s.caCert))
 	}
@@ -160,6 +182,9 @@ func (s *server) listenTCP() error {
 	if err != nil {
 		return jerrors.Annotatef(err, "net.Listen(tcp, addr:%s))", s.addr)
 	}
+	if s.endPointType == TCP_SERVER && s.tlsConfig != nil {
+		streamListener = tls.NewListener(streamListener, s.tlsConfig)
+	}
 
 	s.streamListener = streamListener
 
@@ -190,11 +215,36 @@ func (s *server) listenUDP() error {
 	return nil
 }
 
+func (s *server) listenUnix() error {
+	var (
+		err            error
+		fileInfo       os.FileInfo
+		streamListener net.Listener
+	)
+
+	// remove the socket file left by the last process
+	if fileInfo, err = os.Lstat(s.addr); err == nil && fileInfo.Mode()&os.ModeSocket != 0 {
+		if err = os.Remove(s.addr); err != nil {
+			return jerrors.Annotatef(err, "os.Remove(%s)", s.addr)
+		}
+	}
+	streamListener, err = net.Listen("unix", s.addr)
+	if err != nil {
+		return jerrors.Annotatef(err, "net.Listen(unix, addr:%s))", s.addr)
+	}
+
+	s.streamListener = streamListener
+
+	return nil
+}
+
 // Listen announces on the local network address.
 func (s *server) listen() error {
 	switch s.endPointType {
 	case TCP_SERVER, WS_SERVER, WSS_SERVER:
 		return jerrors.Trace(s.listenTCP())
+	case UNIX_SERVER:
+		return jerrors.Trace(s.listenUnix())
 	case UDP_ENDPOINT:
 		return jerrors.Trace(s.listenUDP())
 	}
@@ -207,7 +257,7 @@ func (s *server) accept(newSession NewSessionCallback) (Session, error) {
 	if err != nil {
 		return nil, jerrors.Trace(err)
 	}
-	if gxnet.IsSameAddr(conn.RemoteAddr(), conn.LocalAddr()) {
+	if s.endPointType != UNIX_SERVER && gxnet.IsSameAddr(conn.RemoteAddr(), conn.LocalAddr()) {
 		log.Warn("conn.localAddr{%s} == conn.RemoteAddr", conn.LocalAddr().String(), conn.RemoteAddr().String())
 		return nil, errSelfConnect
 	}
@@ -378,30 +428,36 @@ func (s *server) runWSSEventLoop(newSession NewSessionCallback) {
 		)
 		defer s.wg.Done()
 
-		if certificate, err = tls.LoadX509KeyPair(s.cert, s.privateKey); err != nil {
-			panic(fmt.Sprintf("tls.LoadX509KeyPair(cert{%s}, privateKey{%s}) = err{%s}",
-				s.cert, s.privateKey, jerrors.ErrorStack(err)))
-			return
-		}
-		config = &tls.Config{
-			InsecureSkipVerify: true, // do not verify peer cert
-			ClientAuth:         tls.NoClientCert,
-			NextProtos:         []string{"http/1.1"},
-			Certificates:       []tls.Certificate{certificate},
-		}
-
-		if s.caCert != "" {
-			certPem, err = ioutil.ReadFile(s.caCert)
-			if err != nil {
-				panic(fmt.Errorf("ioutil.ReadFile(certFile{%s}) = err{%s}", s.caCert, jerrors.ErrorStack(err)))
+		if s.tlsConfig != nil {
+			// the tls config of WithServerTLSConfig takes the place of the certificate files
+			config = s.tlsConfig.Clone()
+			config.NextProtos = []string{"http/1.1"}
+		} else {
+			if certificate, err = tls.LoadX509KeyPair(s.cert, s.privateKey); err != nil {
+				panic(fmt.Sprintf("tls.LoadX509KeyPair(cert{%s}, privateKey{%s}) = err{%s}",
+					s.cert, s.privateKey, jerrors.ErrorStack(err)))
+				return
+			}
+			config = &tls.Config{
+				InsecureSkipVerify: true, // do not verify peer cert
+				ClientAuth:         tls.NoClientCert,
+				NextProtos:         []string{"http/1.1"},
+				Certificates:       []tls.Certificate{certificate},
 			}
-			certPool = x509.NewCertPool()
-			if ok := certPool.AppendCertsFromPEM(certPem); !ok {
-				panic("failed to parse root certificate file")
+
+			if s.caCert != "" {
+				certPem, err = ioutil.ReadFile(s.caCert)
+				if err != nil {
+					panic(fmt.Errorf("ioutil.ReadFile(certFile{%s}) = err{%s}", s.caCert, jerrors.ErrorStack(err)))
+				}
+				certPool = x509.NewCertPool()
+				if ok := certPool.AppendCertsFromPEM(certPem); !ok {
+					panic("failed to parse root certificate file")
+				}
+				config.ClientCAs = certPool
+				config.ClientAuth = tls.RequireAndVerifyClientCert
+				config.InsecureSkipVerify = false
 			}
-			config.ClientCAs = certPool
-			config.ClientAuth = tls.RequireAndVerifyClientCert
-			config.InsecureSkipVerify = false
 		}
 
 		handler = newWSHandler(s, newSession)
@@ -417,7 +473,8 @@ func (s *server) runWSSEventLoop(newSession NewSessionCallback) {
 		s.server = server
 		s.lock.Unlock()
 		err = server.Serve(tls.NewListener(s.streamListener, config))
-		if err != nil {
+		// Serve returns http.ErrServerClosed after the server is stopped
+		if err != nil && err != http.ErrServerClosed {
 			log.Error("http.server.Serve(addr{%s}) = err{%s}", s.addr, jerrors.ErrorStack(err))
 			panic(err)
 		}
@@ -432,7 +489,7 @@ func (s *server) RunEventLoop(newSession NewSessionCallback) {
 	}
 
 	switch s.endPointType {
-	case TCP_SERVER:
+	case TCP_SERVER, UNIX_SERVER:
 		s.runTcpEventLoop(newSession)
 	case UDP_ENDPOINT:
 		s.runUDPEventLoop(newSession)
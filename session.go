@@ -181,13 +181,39 @@ func (s *session) Stat() string {
 	return fmt.Sprintf(
 		outputFormat,
 		s.sessionToken(),
-		atomic.LoadUint32(&(conn.readBytes)),
-		atomic.LoadUint32(&(conn.writeBytes)),
-		atomic.LoadUint32(&(conn.readPkgNum)),
-		atomic.LoadUint32(&(conn.writePkgNum)),
+		atomic.LoadUint64(&(conn.readBytes)),
+		atomic.LoadUint64(&(conn.writeBytes)),
+		atomic.LoadUint64(&(conn.readPkgNum)),
+		atomic.LoadUint64(&(conn.writePkgNum)),
 	)
 }
 
+// return the snapshot of connect statistic data and queue depths
+func (s *session) Statistic() SessionStatistic {
+	var stat SessionStatistic
+
+	if conn := s.gettyConn(); conn != nil {
+		stat.ReadBytes = atomic.LoadUint64(&(conn.readBytes))
+		stat.WriteBytes = atomic.LoadUint64(&(conn.writeBytes))
+		stat.ReadPkgNum = atomic.LoadUint64(&(conn.readPkgNum))
+		stat.WritePkgNum = atomic.LoadUint64(&(conn.writePkgNum))
+	}
+
+	s.lock.RLock()
+	if s.rQ != nil {
+		stat.RQLen, stat.RQCap = len(s.rQ), cap(s.rQ)
+	}
+	if s.wQ != nil {
+		stat.WQLen, stat.WQCap = len(s.wQ), cap(s.wQ)
+	}
+	if s.pool != nil {
+		stat.PoolWorkers, stat.PoolQueueLen = s.pool.Workers(), s.pool.QueueLen()
+	}
+	s.lock.RUnlock()
+
+	return stat
+}
+
 // check whether the session has been closed.
 func (s *session) IsClosed() bool {
 	select {
@@ -334,6 +360,7 @@ func (s *session) WritePkg(pkg interface{}, timeout time.Duration) error {
 
 	case <-wheel.After(timeout):
 		log.Warn("%s, [session.WritePkg] wQ{len:%d, cap:%d}", s.Stat(), len(s.wQ), cap(s.wQ))
+		metrics.incBlockedWrite(s.EndPoint().EndPointType())
 		return ErrSessionBlocked
 	}
 
@@ -422,6 +449,7 @@ func (s *session) run() {
 		s.Close()
 		return
 	}
+	metrics.addSession(s)
 
 	atomic.AddInt32(&(s.grNum), 2)
 	go s.handleLoop()
@@ -455,6 +483,9 @@ func (s *session) handleLoop() {
 		grNum = atomic.AddInt32(&(s.grNum), -1)
 		// if !s.errFlag {
 		s.listener.OnClose(s)
+		for len(s.rQ) != 0 {
+			s.dropPackage(<-s.rQ)
+		}
 		// }
 		log.Info("%s, [session.handleLoop] goroutine exit now, left gr num %d", s.Stat(), grNum)
 		s.gc()
@@ -489,12 +520,17 @@ LOOP:
 			if flag {
 				log.Debug("%#v <-s.rQ", inPkg)
 				pkg := inPkg
-				s.pool.ScheduleTimeout(s.wait, func() {
+				if err = s.pool.ScheduleTimeout(s.wait, func() {
 					s.listener.OnMessage(s, pkg)
-				})
+				}); err != nil {
+					log.Warn("%s, [session.handleLoop] drop package{%#v}, error{%s}", s.sessionToken(), pkg, err)
+					metrics.incScheduleTimeout(s.EndPoint().EndPointType())
+					s.dropPackage(pkg)
+				}
 				s.incReadPkgNum()
 			} else {
 				log.Info("[session.handleLoop] drop readin package{%#v}", inPkg)
+				s.dropPackage(inPkg)
 			}
 
 		case outPkg = <-s.wQ:
@@ -783,7 +819,16 @@ func (s *session) stop() {
 	}
 }
 
+// dropPackage notifies the listener that @pkg will not be handled.
+func (s *session) dropPackage(pkg interface{}) {
+	if l, ok := s.listener.(PackageDropListener); ok {
+		l.OnDrop(s, pkg)
+	}
+}
+
 func (s *session) gc() {
+	metrics.removeSession(s)
+
 	s.lock.Lock()
 	if s.attrs != nil {
 		s.attrs = nil
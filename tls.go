@@ -0,0 +1,117 @@
+/******************************************************
+# DESC       : tls settings of tcp endpoints
+# MAINTAINER : Alex Stocks
+# LICENCE    : Apache License 2.0
+# EMAIL      : alexstocks@foxmail.com
+# MOD        : 2026-10-19 16:40
+# FILE       : tls.go
+******************************************************/
+
+package getty
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+)
+
+import (
+	jerrors "github.com/juju/errors"
+)
+
+// tlsCertFile is a pair of certificate file & private key file.
+type tlsCertFile struct {
+	cert string
+	key  string
+}
+
+// tlsOptions are the file based tls settings of tcp endpoints, which NewTCPTLSServer &
+// NewTCPTLSClient load into their tls configs.
+type tlsOptions struct {
+	certFiles    []tlsCertFile
+	caFile       string
+	serverName   string
+	minVersion   uint16
+	cipherSuites []uint16
+}
+
+// LoadCertPool returns the cert pool of the pem certificates in @caFile.
+func LoadCertPool(caFile string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, jerrors.Annotatef(err, "ioutil.ReadFile(caFile{%s})", caFile)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, jerrors.Errorf("no certificate in caFile{%s}", caFile)
+	}
+
+	return pool, nil
+}
+
+// build returns the tls config of @o based on a clone of @config, which may be nil.
+func (o *tlsOptions) build(config *tls.Config) (*tls.Config, error) {
+	if config == nil {
+		config = &tls.Config{}
+	} else {
+		config = config.Clone()
+	}
+
+	for _, f := range o.certFiles {
+		cert, err := tls.LoadX509KeyPair(f.cert, f.key)
+		if err != nil {
+			return nil, jerrors.Annotatef(err, "tls.LoadX509KeyPair(cert{%s}, key{%s})", f.cert, f.key)
+		}
+		config.Certificates = append(config.Certificates, cert)
+	}
+	if o.minVersion != 0 {
+		config.MinVersion = o.minVersion
+	} else if config.MinVersion == 0 {
+		config.MinVersion = tls.VersionTLS12
+	}
+	if len(o.cipherSuites) != 0 {
+		config.CipherSuites = o.cipherSuites
+	}
+
+	return config, nil
+}
+
+// buildServerConfig returns the tls config of tcp tls server. The server selects its certificate
+// by the SNI of the client if it has several certificates, and verifies the client certificates
+// by the client CA if there is.
+func (o *tlsOptions) buildServerConfig(config *tls.Config) (*tls.Config, error) {
+	config, err := o.build(config)
+	if err != nil {
+		return nil, jerrors.Trace(err)
+	}
+	if len(config.Certificates) == 0 && config.GetCertificate == nil && config.GetConfigForClient == nil {
+		return nil, jerrors.New("tls server needs a certificate")
+	}
+	if o.caFile != "" {
+		if config.ClientCAs, err = LoadCertPool(o.caFile); err != nil {
+			return nil, jerrors.Trace(err)
+		}
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return config, nil
+}
+
+// buildClientConfig returns the tls config of tcp tls client. Its certificate is sent to the
+// server in mutual tls, and its server name is the host of the server address if it is empty.
+func (o *tlsOptions) buildClientConfig(config *tls.Config) (*tls.Config, error) {
+	config, err := o.build(config)
+	if err != nil {
+		return nil, jerrors.Trace(err)
+	}
+	if o.caFile != "" {
+		if config.RootCAs, err = LoadCertPool(o.caFile); err != nil {
+			return nil, jerrors.Trace(err)
+		}
+	}
+	if o.serverName != "" {
+		config.ServerName = o.serverName
+	}
+
+	return config, nil
+}
@@ -0,0 +1,378 @@
+/******************************************************
+# DESC       : tests of tcp tls endpoints
+# MAINTAINER : Alex Stocks
+# LICENCE    : Apache License 2.0
+# EMAIL      : alexstocks@foxmail.com
+# MOD        : 2026-10-19 19:10
+# FILE       : tls_test.go
+******************************************************/
+
+package getty
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+import (
+	jerrors "github.com/juju/errors"
+)
+
+// testCert is a certificate & private key pair generated by the tests.
+type testCert struct {
+	cert     *x509.Certificate
+	key      *ecdsa.PrivateKey
+	certFile string
+	keyFile  string
+}
+
+// newTestCert generates a certificate of @tmpl signed by @parent, or a self-signed one if @parent
+// is nil, and writes its pem files into @dir.
+func newTestCert(t *testing.T, dir, name string, tmpl *x509.Certificate, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey() = error{%v}", err)
+	}
+	tmpl.SerialNumber = big.NewInt(time.Now().UnixNano())
+	tmpl.Subject = pkix.Name{CommonName: name}
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+	signer, signerKey := tmpl, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("x509.CreateCertificate(%s) = error{%v}", name, err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("x509.ParseCertificate(%s) = error{%v}", name, err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("x509.MarshalECPrivateKey(%s) = error{%v}", name, err)
+	}
+
+	c := &testCert{
+		cert:     cert,
+		key:      key,
+		certFile: filepath.Join(dir, name+".pem"),
+		keyFile:  filepath.Join(dir, name+".key"),
+	}
+	if err = ioutil.WriteFile(c.certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatalf("ioutil.WriteFile(%s) = error{%v}", c.certFile, err)
+	}
+	if err = ioutil.WriteFile(c.keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatalf("ioutil.WriteFile(%s) = error{%v}", c.keyFile, err)
+	}
+
+	return c
+}
+
+func newTestCA(t *testing.T, dir, name string) *testCert {
+	return newTestCert(t, dir, name, &x509.Certificate{
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}, nil)
+}
+
+// newTestLeaf generates a certificate of @dnsNames signed by @ca.
+func newTestLeaf(t *testing.T, dir, name string, usage x509.ExtKeyUsage, ca *testCert, dnsNames ...string) *testCert {
+	return newTestCert(t, dir, name, &x509.Certificate{
+		DNSNames:    dnsNames,
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{usage},
+	}, ca)
+}
+
+// lineHandler reads & writes packages of lines.
+type lineHandler struct{}
+
+func (h lineHandler) Read(ss Session, data []byte) (interface{}, int, error) {
+	n := bytes.IndexByte(data, '\n')
+	if n < 0 {
+		return nil, 0, nil
+	}
+
+	return string(data[:n]), n + 1, nil
+}
+
+func (h lineHandler) Write(ss Session, pkg interface{}) error {
+	return ss.WriteBytes([]byte(pkg.(string) + "\n"))
+}
+
+// lineListener echoes the lines if @echo is true, and reports the lines & the closed sessions.
+type lineListener struct {
+	echo   bool
+	opened chan Session
+	lines  chan string
+	closed chan Session
+}
+
+func newLineListener(echo bool) *lineListener {
+	return &lineListener{
+		echo:   echo,
+		opened: make(chan Session, 8),
+		lines:  make(chan string, 8),
+		closed: make(chan Session, 8),
+	}
+}
+
+func (l *lineListener) OnOpen(ss Session) error {
+	l.opened <- ss
+	return nil
+}
+
+func (l *lineListener) OnClose(ss Session) {
+	l.closed <- ss
+}
+
+func (l *lineListener) OnError(ss Session, err error) {}
+
+func (l *lineListener) OnCron(ss Session) {}
+
+func (l *lineListener) OnMessage(ss Session, pkg interface{}) {
+	l.lines <- pkg.(string)
+	if l.echo {
+		ss.WritePkg(pkg, -1)
+	}
+}
+
+// newLineSession returns the session callback of @listener.
+func newLineSession(listener *lineListener) NewSessionCallback {
+	return func(ss Session) error {
+		ss.SetPkgHandler(lineHandler{})
+		ss.SetEventListener(listener)
+		ss.SetRQLen(8)
+		ss.SetWQLen(8)
+		ss.SetReadTimeout(time.Second)
+		ss.SetWriteTimeout(time.Second)
+		ss.SetCronPeriod(1000)
+		ss.SetWaitTime(time.Second)
+		return nil
+	}
+}
+
+// testAddress returns a local address which is not in use now.
+func testAddress(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen() = error{%v}", err)
+	}
+	defer l.Close()
+
+	return "127.0.0.1:" + strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+}
+
+// startTLSServer starts an echo tcp tls server of @opts, which is closed at the end of the test.
+func startTLSServer(t *testing.T, opts ...ServerOption) (string, *lineListener) {
+	addr := testAddress(t)
+	server := NewTCPTLSServer(append([]ServerOption{WithLocalAddress(addr)}, opts...)...)
+	listener := newLineListener(true)
+	server.RunEventLoop(newLineSession(listener))
+	t.Cleanup(server.Close)
+
+	return addr, listener
+}
+
+// startTLSClient starts a tcp tls client of @opts, which is closed at the end of the test.
+func startTLSClient(t *testing.T, addr string, opts ...ClientOption) (Client, *lineListener) {
+	opts = append([]ClientOption{WithServerAddress(addr), WithConnectionNumber(1)}, opts...)
+	client := NewTCPTLSClient(opts...)
+	listener := newLineListener(false)
+	client.RunEventLoop(newLineSession(listener))
+	t.Cleanup(client.Close)
+
+	return client, listener
+}
+
+// echoLine writes @line by the session of @listener and waits for its echo. It returns the session.
+func echoLine(listener *lineListener, line string) (Session, error) {
+	var ss Session
+	select {
+	case ss = <-listener.opened:
+	case <-time.After(3 * time.Second):
+		return nil, jerrors.New("no session is opened")
+	}
+	if err := ss.WritePkg(line, -1); err != nil {
+		return ss, err
+	}
+	select {
+	case echo := <-listener.lines:
+		if echo != line {
+			return ss, jerrors.Errorf("echo %s, want %s", echo, line)
+		}
+		return ss, nil
+	case <-listener.closed:
+		return ss, jerrors.New("session is closed")
+	case <-time.After(3 * time.Second):
+		return ss, jerrors.New("no echo")
+	}
+}
+
+// peerName returns the common name of the peer certificate of @ss.
+func peerName(ss Session) string {
+	state := ss.Conn().(*tls.Conn).ConnectionState()
+	if len(state.PeerCertificates) == 0 {
+		return ""
+	}
+
+	return state.PeerCertificates[0].Subject.CommonName
+}
+
+func TestTCPTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "ca")
+	a := newTestLeaf(t, dir, "a", x509.ExtKeyUsageServerAuth, ca, "a.test")
+	b := newTestLeaf(t, dir, "b", x509.ExtKeyUsageServerAuth, ca, "b.test")
+	addr, server := startTLSServer(t, WithServerTLSCertFile(a.certFile, a.keyFile), WithServerTLSCertFile(b.certFile, b.keyFile))
+
+	// the server selects its certificate by the SNI of the client
+	for _, name := range []string{"a", "b"} {
+		client, listener := startTLSClient(t, addr, WithClientTLSRootCAFile(ca.certFile), WithClientTLSServerName(name+".test"))
+		ss, err := echoLine(listener, "ping")
+		if err != nil {
+			t.Fatalf("echo over tls with server name %s.test = error{%v}", name, err)
+		}
+		if peer := peerName(ss); peer != name {
+			t.Errorf("server certificate of server name %s.test = %s, want %s", name, peer, name)
+		}
+		serverSession := <-server.opened
+		<-server.lines
+
+		// (gettyTCPConn)close closes the tls connection of the client
+		client.Close()
+		select {
+		case closed := <-server.closed:
+			if closed != serverSession {
+				t.Errorf("closed session = %s, want %s", closed.Stat(), serverSession.Stat())
+			}
+		case <-time.After(3 * time.Second):
+			t.Errorf("server session is not closed after the tls client is closed")
+		}
+	}
+
+	// the client does not trust the server certificate without the root CA
+	_, listener := startTLSClient(t, addr, WithClientTLSServerName("a.test"))
+	select {
+	case ss := <-listener.opened:
+		t.Errorf("tls session %s is opened with the untrusted server certificate", ss.Stat())
+	case <-time.After(500 * time.Millisecond):
+	}
+}
+
+func TestTCPMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "ca")
+	otherCA := newTestCA(t, dir, "other-ca")
+	serverCert := newTestLeaf(t, dir, "server", x509.ExtKeyUsageServerAuth, ca, "localhost")
+	addr, server := startTLSServer(t,
+		WithServerTLSCertFile(serverCert.certFile, serverCert.keyFile),
+		WithServerTLSClientCAFile(ca.certFile),
+	)
+
+	tests := []struct {
+		name   string
+		client *testCert
+		ok     bool
+	}{
+		{"client certificate", newTestLeaf(t, dir, "client", x509.ExtKeyUsageClientAuth, ca), true},
+		{"no client certificate", nil, false},
+		{"client certificate of other CA", newTestLeaf(t, dir, "other", x509.ExtKeyUsageClientAuth, otherCA), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts := []ClientOption{WithClientTLSRootCAFile(ca.certFile), WithClientTLSServerName("localhost")}
+			if test.client != nil {
+				opts = append(opts, WithClientTLSCertFile(test.client.certFile, test.client.keyFile))
+			}
+			client, listener := startTLSClient(t, addr, opts...)
+			defer client.Close()
+			_, err := echoLine(listener, "ping")
+			if (err == nil) != test.ok {
+				t.Fatalf("echo = error{%v}, want ok %t", err, test.ok)
+			}
+			if !test.ok {
+				return
+			}
+			if peer := peerName(<-server.opened); peer != "client" {
+				t.Errorf("client certificate = %s, want client", peer)
+			}
+			<-server.lines
+		})
+	}
+}
+
+func TestTLSOptionsBuild(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "ca")
+	cert := newTestLeaf(t, dir, "server", x509.ExtKeyUsageServerAuth, ca, "localhost")
+	missing := filepath.Join(dir, "missing.pem")
+
+	base := &tls.Config{ServerName: "base"}
+	config, err := (&tlsOptions{}).buildClientConfig(base)
+	if err != nil || config == base || config.ServerName != "base" || config.MinVersion != tls.VersionTLS12 {
+		t.Errorf("buildClientConfig(base) = (%+v, error{%v}), want a clone of base with tls 1.2", config, err)
+	}
+	if base.MinVersion != 0 {
+		t.Errorf("buildClientConfig(base) modifies base")
+	}
+
+	opts := tlsOptions{
+		certFiles:    []tlsCertFile{{cert: cert.certFile, key: cert.keyFile}},
+		caFile:       ca.certFile,
+		minVersion:   tls.VersionTLS13,
+		cipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+	}
+	config, err = opts.buildServerConfig(nil)
+	if err != nil {
+		t.Fatalf("buildServerConfig() = error{%v}", err)
+	}
+	if len(config.Certificates) != 1 || config.ClientCAs == nil || config.ClientAuth != tls.RequireAndVerifyClientCert ||
+		config.MinVersion != tls.VersionTLS13 || len(config.CipherSuites) != 1 {
+		t.Errorf("buildServerConfig() = %+v, want the certificate, client CA, tls 1.3 and the cipher suite", config)
+	}
+
+	errTests := []struct {
+		name  string
+		build func() (*tls.Config, error)
+	}{
+		{"server without certificate", func() (*tls.Config, error) {
+			return (&tlsOptions{}).buildServerConfig(nil)
+		}},
+		{"missing certificate file", func() (*tls.Config, error) {
+			return (&tlsOptions{certFiles: []tlsCertFile{{cert: missing, key: cert.keyFile}}}).buildServerConfig(nil)
+		}},
+		{"missing server CA file", func() (*tls.Config, error) {
+			return (&tlsOptions{certFiles: opts.certFiles, caFile: missing}).buildServerConfig(nil)
+		}},
+		{"client CA file without certificate", func() (*tls.Config, error) {
+			return (&tlsOptions{caFile: cert.keyFile}).buildClientConfig(nil)
+		}},
+	}
+	for _, test := range errTests {
+		if config, err := test.build(); err == nil {
+			t.Errorf("%s: build = %+v, want error", test.name, config)
+		}
+	}
+
+	if _, err = LoadCertPool(ca.certFile); err != nil {
+		t.Errorf("LoadCertPool(%s) = error{%v}", ca.certFile, err)
+	}
+}